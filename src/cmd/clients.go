@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"goAuth/internal/database"
+	"goAuth/internal/database/model"
+	"goAuth/internal/service/client"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const clientsUsage = `Usage: main clients <command> [flags]
+
+Commands:
+  list                  List registered clients
+  create -name <name>   Register a client and print its credentials
+  delete <client_id>    Remove a client
+  policy <client_id>    Show or override the client's OTP policy:
+      -length 8 -alphabet alphanumeric -ttl 5m -resend-interval 30s
+      -max-sends 3 -send-window 10m -max-verify-attempts 5
+      Unset flags keep the server's value; -reset removes the override.
+  redirect-uris <client_id>
+                        Show or change where magic links may redirect:
+      -add https://app.example.com/callback -remove <uri> -reset
+`
+
+// runClientsCommand implements the "clients" subcommand used to manage the
+// OAuth clients allowed to call client-authenticated endpoints.
+func runClientsCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, clientsUsage)
+		return errors.New("missing clients command")
+	}
+
+	db := database.New().GetDBInstance()
+	if err := db.AutoMigrate(&model.Client{}); err != nil {
+		return fmt.Errorf("failed to migrate clients: %w", err)
+	}
+	clientService := client.NewClientService(db)
+
+	cmd, args := args[0], args[1:]
+	flags := flag.NewFlagSet("clients "+cmd, flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, clientsUsage) }
+
+	switch cmd {
+	case "list":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		clients, err := clientService.List()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CLIENT_ID\tNAME\tCREATED")
+		for _, c := range clients {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.ClientID, c.Name, c.CreatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+
+	case "create":
+		name := flags.String("name", "", "human readable client name")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+		c, secret, err := clientService.Create(*name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("client_id:     %s\nclient_secret: %s\n", c.ClientID, secret)
+		fmt.Println("The secret is not stored and cannot be shown again.")
+		return nil
+
+	case "delete":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("expected exactly one client id")
+		}
+		if err := clientService.Delete(flags.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %s\n", flags.Arg(0))
+		return nil
+
+	case "policy":
+		var policy model.OTPPolicy
+		flags.IntVar(&policy.Length, "length", 0, "code length")
+		flags.StringVar(&policy.Alphabet, "alphabet", "", "numeric or alphanumeric")
+		flags.DurationVar(&policy.TTL, "ttl", 0, "how long a code is valid")
+		flags.DurationVar(&policy.ResendInterval, "resend-interval", 0, "minimum time between two codes")
+		flags.IntVar(&policy.MaxSends, "max-sends", 0, "codes per send window")
+		flags.DurationVar(&policy.SendWindow, "send-window", 0, "window of -max-sends")
+		flags.IntVar(&policy.MaxVerifyAttempts, "max-verify-attempts", 0, "wrong guesses before a code is burned")
+		reset := flags.Bool("reset", false, "remove the override")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("expected exactly one client id")
+		}
+
+		// Without flags the current policy is shown; flags merge into it.
+		current, err := clientService.Get(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if *reset {
+			policy = model.OTPPolicy{}
+		} else {
+			policy = current.OTPPolicy.Merge(policy)
+		}
+		if *reset || flags.NFlag() > 0 {
+			if current, err = clientService.SetOTPPolicy(flags.Arg(0), policy); err != nil {
+				return err
+			}
+		}
+		printOTPPolicy(current.OTPPolicy)
+		return nil
+
+	case "redirect-uris":
+		var add, remove stringList
+		flags.Var(&add, "add", "allow a redirect uri (repeatable)")
+		flags.Var(&remove, "remove", "disallow a redirect uri (repeatable)")
+		reset := flags.Bool("reset", false, "remove every redirect uri")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("expected exactly one client id")
+		}
+
+		current, err := clientService.Get(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if *reset || flags.NFlag() > 0 {
+			var uris []string
+			if !*reset {
+				uris = current.RedirectURIs
+			}
+			uris = slices.DeleteFunc(slices.Clone(uris), func(uri string) bool { return slices.Contains(remove, uri) })
+			for _, uri := range add {
+				if !slices.Contains(uris, uri) {
+					uris = append(uris, uri)
+				}
+			}
+			if current, err = clientService.SetRedirectURIs(flags.Arg(0), uris); err != nil {
+				return err
+			}
+		}
+		if len(current.RedirectURIs) == 0 {
+			fmt.Println("no redirect uris, magic links answer with tokens instead")
+		}
+		for _, uri := range current.RedirectURIs {
+			fmt.Println(uri)
+		}
+		return nil
+
+	default:
+		fmt.Fprint(os.Stderr, clientsUsage)
+		return fmt.Errorf("unknown clients command %q", cmd)
+	}
+}
+
+// printOTPPolicy prints the fields a client overrides.
+func printOTPPolicy(policy model.OTPPolicy) {
+	if policy == (model.OTPPolicy{}) {
+		fmt.Println("no override, the server's OTP policy applies")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, field := range []struct {
+		name  string
+		value any
+		set   bool
+	}{
+		{"length", policy.Length, policy.Length != 0},
+		{"alphabet", policy.Alphabet, policy.Alphabet != ""},
+		{"ttl", policy.TTL, policy.TTL != 0},
+		{"resend-interval", policy.ResendInterval, policy.ResendInterval != 0},
+		{"max-sends", policy.MaxSends, policy.MaxSends != 0},
+		{"send-window", policy.SendWindow, policy.SendWindow != 0},
+		{"max-verify-attempts", policy.MaxVerifyAttempts, policy.MaxVerifyAttempts != 0},
+	} {
+		if field.set {
+			fmt.Fprintf(w, "%s\t%v\n", field.name, field.value)
+		}
+	}
+	w.Flush()
+}
+
+// stringList is a flag that may be given several times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: main [command]
+
+Without a command the HTTP server is started.
+
+Commands:
+  keys      Manage the token signing key ring
+  clients   Manage OAuth clients
+  users     Grant and revoke user roles
+  otp-stub  Run a local stand-in for the HTTP OTP gateways
+`
+
+// runCommand dispatches the administrative subcommands.
+func runCommand(name string, args []string) error {
+	switch name {
+	case "keys":
+		return runKeysCommand(args)
+	case "clients":
+		return runClientsCommand(args)
+	case "users":
+		return runUsersCommand(args)
+	case "otp-stub":
+		return runOTPStubCommand(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"goAuth/internal/service/signing"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const keysUsage = `Usage: main keys <command> [flags]
+
+Commands:
+  list                          List the keys in the ring
+  generate [-promote] [-retire-after 24h]
+                                Add a new JWT_ALGORITHM key; it is published
+                                in the JWKS right away and signs tokens once
+                                promoted
+  promote [-retire-after 24h] <kid>
+                                Make <kid> the signing key and retire the
+                                previous one after -retire-after
+  retire [-at RFC3339 | -after 1h] <kid>
+                                Schedule <kid> to stop verifying tokens
+  prune [-max-retired 3]        Delete expired keys and the oldest retired
+                                keys beyond -max-retired
+
+The ring lives in JWT_KEYS_DIR (default ./keys). -retire-after defaults to
+ACCESS_EXPIRY so tokens signed with the old key stay valid until they expire.
+`
+
+// runKeysCommand implements the "keys" subcommand used to rotate signing keys.
+func runKeysCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return errors.New("missing keys command")
+	}
+
+	ring, err := signing.OpenRing(signing.Algorithm(), signing.KeysDir())
+	if err != nil {
+		return fmt.Errorf("failed to open key ring: %w", err)
+	}
+
+	defaultRetireAfter, _ := time.ParseDuration(os.Getenv("ACCESS_EXPIRY"))
+
+	cmd, args := args[0], args[1:]
+	flags := flag.NewFlagSet("keys "+cmd, flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, keysUsage) }
+
+	switch cmd {
+	case "list":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		return printKeys(ring)
+
+	case "generate":
+		promote := flags.Bool("promote", false, "make the new key active immediately")
+		retireAfter := flags.Duration("retire-after", defaultRetireAfter, "how long the previous key keeps verifying tokens")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		key, err := ring.Generate()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("generated %s key %s\n", key.Algorithm, key.ID)
+		if *promote {
+			if err := ring.Promote(key.ID, *retireAfter); err != nil {
+				return err
+			}
+			fmt.Printf("promoted %s\n", key.ID)
+		}
+		return nil
+
+	case "promote":
+		retireAfter := flags.Duration("retire-after", defaultRetireAfter, "how long the previous key keeps verifying tokens")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		kid, err := kidArg(flags)
+		if err != nil {
+			return err
+		}
+		if err := ring.Promote(kid, *retireAfter); err != nil {
+			return err
+		}
+		fmt.Printf("promoted %s\n", kid)
+		return nil
+
+	case "retire":
+		at := flags.String("at", "", "retirement time in RFC3339")
+		after := flags.Duration("after", 0, "retire after this duration")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		kid, err := kidArg(flags)
+		if err != nil {
+			return err
+		}
+		retireAt := time.Now().Add(*after)
+		if *at != "" {
+			if retireAt, err = time.Parse(time.RFC3339, *at); err != nil {
+				return fmt.Errorf("invalid -at: %w", err)
+			}
+		}
+		if err := ring.Retire(kid, retireAt); err != nil {
+			return err
+		}
+		fmt.Printf("%s retires at %s\n", kid, retireAt.Format(time.RFC3339))
+		return nil
+
+	case "prune":
+		maxRetired := flags.Int("max-retired", defaultMaxRetired(), "number of retired keys to keep, -1 for all")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		removed, err := ring.Prune(*maxRetired)
+		if err != nil {
+			return err
+		}
+		for _, kid := range removed {
+			fmt.Printf("removed %s\n", kid)
+		}
+		return nil
+
+	default:
+		fmt.Fprint(os.Stderr, keysUsage)
+		return fmt.Errorf("unknown keys command %q", cmd)
+	}
+}
+
+func printKeys(ring *signing.KeyRing) error {
+	activeID, keys := ring.Keys()
+	now := time.Now()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALG\tSTATUS\tCREATED\tRETIRES")
+	for _, k := range keys {
+		retires := "-"
+		if k.RetireAt != nil {
+			retires = k.RetireAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.ID, k.Algorithm, k.Status(activeID, now), k.CreatedAt.Format(time.RFC3339), retires)
+	}
+	return w.Flush()
+}
+
+func kidArg(flags *flag.FlagSet) (string, error) {
+	if flags.NArg() != 1 {
+		return "", errors.New("expected exactly one key id")
+	}
+	return flags.Arg(0), nil
+}
+
+func defaultMaxRetired() int {
+	if n, err := strconv.Atoi(os.Getenv("JWT_KEYRING_MAX_RETIRED")); err == nil {
+		return n
+	}
+	return 3
+}
@@ -3,11 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
+	"goAuth/internal/common"
 	"goAuth/internal/database/model"
 	"goAuth/internal/server"
 	"goAuth/internal/service/auth"
+	"goAuth/internal/service/client"
+	"goAuth/internal/service/delivery"
 	inmemory "goAuth/internal/service/in-memory"
+	"goAuth/internal/service/signing"
 	"goAuth/internal/service/user"
+	"goAuth/internal/utils/password"
 	"log"
 	"os"
 	"os/signal"
@@ -16,9 +21,10 @@ import (
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	"go.uber.org/zap"
 )
 
-func gracefulShutdown(fiberServer *server.FiberServer, done chan bool) {
+func gracefulShutdown(fiberServer *server.FiberServer, otpQueue *delivery.Queue, done chan bool) {
 	// Create context that listens for the interrupt signal from the OS.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -37,6 +43,16 @@ func gracefulShutdown(fiberServer *server.FiberServer, done chan bool) {
 		log.Printf("Server forced to shutdown with error: %v", err)
 	}
 
+	// Deliver the OTPs that are already due; the rest stay queued in the
+	// database for the next start.
+	if otpQueue != nil {
+		drainCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := otpQueue.Drain(drainCtx); err != nil {
+			log.Printf("OTP delivery queue did not drain: %v", err)
+		}
+	}
+
 	log.Println("Server exiting")
 
 	// Notify the main goroutine that the shutdown is complete
@@ -44,17 +60,121 @@ func gracefulShutdown(fiberServer *server.FiberServer, done chan bool) {
 }
 
 func main() {
+	logger := newLogger()
+	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
+
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fiberServer := server.New()
+	dbInstance := fiberServer.DB.GetDBInstance()
+
+	makeMigration(fiberServer)
 
-	server := server.New()
-	dbInstance := server.DB.GetDBInstance()
+	keyRing, err := signing.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+	go keyRing.Watch(time.Minute, func(err error) {
+		log.Printf("failed to reload signing keys: %v", err)
+	})
 
-	makeMigration(server)
+	routing, err := delivery.RoutingFromEnv()
+	if err != nil {
+		log.Fatalf("failed to configure OTP delivery: %v", err)
+	}
+	otpRouter, err := delivery.NewRouter(routing)
+	if err != nil {
+		log.Fatalf("failed to configure OTP delivery: %v", err)
+	}
+	otpTracking := delivery.NewTracking(dbInstance, routing.WebhookSecrets())
+	otpRouter.SetTracker(otpTracking)
+
+	otpTemplates, err := delivery.TemplatesFromEnv()
+	if err != nil {
+		log.Fatalf("failed to load OTP templates: %v", err)
+	}
+	go otpTemplates.Watch(time.Minute, func(err error) {
+		log.Printf("failed to reload OTP templates: %v", err)
+	})
+	localizedRouter := otpTemplates.Localize(otpRouter)
+
+	var (
+		otpSender = otpTracking.Track(localizedRouter)
+		otpQueue  *delivery.Queue
+	)
+	queueConfig, err := delivery.QueueConfigFromEnv()
+	if err != nil {
+		log.Fatalf("failed to load OTP delivery queue config: %v", err)
+	}
+	if queueConfig.Workers > 0 {
+		queueConfig.SendTimeout = otpRouter.Timeout()
+		otpQueue, err = delivery.NewQueue(dbInstance, localizedRouter, queueConfig)
+		if err != nil {
+			log.Fatalf("failed to create OTP delivery queue: %v", err)
+		}
+		otpQueue.SetTracker(otpTracking)
+		otpQueue.Start()
+		otpSender = otpQueue
+	}
+
+	passwordPolicy, err := password.PolicyFromEnv()
+	if err != nil {
+		log.Fatalf("failed to load password policy: %v", err)
+	}
 
 	inMemoService := inmemory.NewInMemoryStore()
-	authService := auth.NewAuthenticationService(dbInstance, inMemoService)
+	authService := auth.NewAuthenticationService(dbInstance, inMemoService, keyRing, otpSender, otpRouter)
+	authService.SetPasswordPolicy(passwordPolicy)
+	magicLinkCallback, err := auth.MagicLinkCallbackFromEnv()
+	if err != nil {
+		log.Fatalf("failed to configure magic links: %v", err)
+	}
+	authService.SetMagicLinkCallback(magicLinkCallback)
+	if otpQueue == nil {
+		// Delivering inline, a request waits for every provider of a route
+		// to get its own timeout before giving up.
+		authService.SetSendTimeout(otpRouter.Timeout())
+	}
 	userService := user.NewUserService(dbInstance)
+	clientService := client.NewClientService(dbInstance)
+
+	if updated, err := userService.NormalizePhoneNumbers(); err != nil {
+		log.Printf("failed to normalize stored phone numbers: %v", err)
+	} else if updated > 0 {
+		log.Printf("normalized %d stored phone numbers to E.164", updated)
+	}
 
-	server.SetupRoutes(authService, userService)
+	if updated, err := userService.BackfillRoles(); err != nil {
+		log.Printf("failed to backfill user roles: %v", err)
+	} else if updated > 0 {
+		log.Printf("gave the user role to %d accounts without roles", updated)
+	}
+
+	if err := authService.RestoreRevocations(); err != nil {
+		log.Printf("failed to restore revoked tokens: %v", err)
+	}
+
+	fiberServer.SetupRoutes(server.Services{
+		Auth:          authService,
+		MFA:           authService,
+		Passkeys:      authService,
+		Sessions:      authService,
+		User:          userService,
+		Keys:          authService,
+		Tokens:        authService,
+		Roles:         userService,
+		Introspection: authService,
+		Clients:       clientService,
+		Delivery:      otpRouter,
+		Tracking:      otpTracking,
+		StepUpMaxAge:  auth.StepUpMaxAge(),
+	})
 
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
@@ -65,14 +185,14 @@ func main() {
 		if host == "" {
 			host = "0.0.0.0"
 		}
-		err := server.Listen(fmt.Sprintf("%s:%d", host, port))
+		err := fiberServer.Listen(fmt.Sprintf("%s:%d", host, port))
 		if err != nil {
 			panic(fmt.Sprintf("http server error: %s", err))
 		}
 	}()
 
 	// Run graceful shutdown in a separate goroutine
-	go gracefulShutdown(server, done)
+	go gracefulShutdown(fiberServer, otpQueue, done)
 
 	// Wait for the graceful shutdown to complete
 	<-done
@@ -80,5 +200,23 @@ func main() {
 }
 
 func makeMigration(server *server.FiberServer) {
-	server.DB.AutoMigrate(&model.User{})
+	server.DB.AutoMigrate(&model.User{}, &model.RefreshToken{}, &model.RevokedToken{}, &model.Client{}, &model.OTPDelivery{}, &model.OTPDeadLetter{}, &model.OTPMessage{}, &model.TOTPFactor{}, &model.RecoveryCode{}, &model.WebAuthnCredential{}, &model.Session{})
+}
+
+// newLogger returns the global logger: human readable in development mode,
+// JSON otherwise.
+func newLogger() *zap.Logger {
+	var (
+		logger *zap.Logger
+		err    error
+	)
+	if common.DevMode() {
+		logger, err = zap.NewDevelopment()
+	} else {
+		logger, err = zap.NewProduction()
+	}
+	if err != nil {
+		log.Fatalf("failed to create logger: %v", err)
+	}
+	return logger
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const otpStubUsage = `Usage: main otp-stub [-addr :9090]
+
+Runs a stand-in for the HTTP OTP gateways (SMS, voice and messaging app) that
+prints every message it receives. Point SMS_GATEWAY_URL, OTP_VOICE_URL or
+OTP_MESSAGING_APP_URL at it to try OTP delivery locally.
+`
+
+// runOTPStubCommand implements the "otp-stub" subcommand. It accepts the
+// payload HTTPSender posts on any path and answers 202 with a message id.
+func runOTPStubCommand(args []string) error {
+	flags := flag.NewFlagSet("otp-stub", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, otpStubUsage) }
+	addr := flags.String("addr", ":9090", "address to listen on")
+	flags.Parse(args)
+
+	var sent atomic.Uint64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var payload struct {
+			To        string `json:"to"`
+			Channel   string `json:"channel"`
+			Message   string `json:"message"`
+			Reference string `json:"reference"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.To == "" {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		id := fmt.Sprintf("stub-%d", sent.Add(1))
+		fmt.Printf("%s [%s] %s to=%s reference=%s id=%s\n%s\n",
+			time.Now().Format(time.RFC3339), payload.Channel, r.URL.Path, payload.To, payload.Reference, id, payload.Message)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message_id": id})
+	})
+
+	fmt.Fprintf(os.Stderr, "otp stub listening on %s\n", *addr)
+	return http.ListenAndServe(*addr, handler)
+}
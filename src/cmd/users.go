@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"goAuth/internal/database"
+	"goAuth/internal/database/model"
+	"goAuth/internal/service/user"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const usersUsage = `Usage: main users <command> [flags]
+
+Commands:
+  roles <user_id>                 Show the user's roles
+  grant -role admin <user_id>     Give the user a role
+  revoke -role admin <user_id>    Take a role from the user
+
+Roles are user and admin. Role checks read the stored roles, so a change
+applies to the user's current access tokens at once.
+`
+
+// runUsersCommand implements the "users" subcommand used to manage the roles
+// of accounts.
+func runUsersCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usersUsage)
+		return errors.New("missing users command")
+	}
+
+	db := database.New().GetDBInstance()
+	if !db.Migrator().HasTable(&model.User{}) {
+		return errors.New("no users yet, start the server first")
+	}
+	userService := user.NewUserService(db)
+
+	cmd, args := args[0], args[1:]
+	flags := flag.NewFlagSet("users "+cmd, flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usersUsage) }
+	role := flags.String("role", "", "role to grant or revoke")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expected exactly one user id")
+	}
+	userID, err := strconv.ParseUint(flags.Arg(0), 10, 8)
+	if err != nil {
+		return fmt.Errorf("invalid user id %q", flags.Arg(0))
+	}
+
+	var roles []string
+	switch cmd {
+	case "roles":
+		roles, err = userService.Roles(uint8(userID))
+	case "grant":
+		roles, err = userService.GrantRole(uint8(userID), *role)
+	case "revoke":
+		roles, err = userService.RevokeRole(uint8(userID), *role)
+	default:
+		fmt.Fprint(os.Stderr, usersUsage)
+		return fmt.Errorf("unknown users command %q", cmd)
+	}
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		fmt.Println("no roles")
+		return nil
+	}
+	fmt.Println(strings.Join(roles, " "))
+	return nil
+}
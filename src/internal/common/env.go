@@ -0,0 +1,16 @@
+package common
+
+import "os"
+
+// DevMode reports whether APP_ENV is "development". Development mode enables
+// conveniences that must never run in production.
+func DevMode() bool {
+	return os.Getenv("APP_ENV") == "development"
+}
+
+// LogOTPCodes reports whether OTP codes may be written to logs, stdout or the
+// file sender. It needs development mode and OTP_LOG_CODES=true, so codes are
+// never exposed by a forgotten APP_ENV alone.
+func LogOTPCodes() bool {
+	return DevMode() && os.Getenv("OTP_LOG_CODES") == "true"
+}
@@ -1,9 +1,85 @@
 package common
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	ErrGetOTP     = errors.New("fetching registered otp code faild")
 	ErrCompareOTP = errors.New("wrong otp code")
 	ErrInvalidOTP = errors.New("invalid otp")
+
+	ErrOTPAttemptsExceeded = errors.New("too many failed otp attempts")
+	ErrOTPRateLimited      = errors.New("too many otp requests")
+	ErrOTPResendTooSoon    = errors.New("otp requested again too soon")
+
+	ErrOTPDeliveryFailed      = errors.New("otp delivery failed")
+	ErrOTPDeliveryUnavailable = errors.New("otp delivery provider unavailable")
+	ErrChannelUnavailable     = errors.New("otp channel unavailable")
+
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrInvalidDeliveryReceipt  = errors.New("invalid delivery receipt")
+	ErrMessageNotFound         = errors.New("otp message not found")
+	ErrReceiptReplayed         = errors.New("delivery receipt already applied")
+
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+
+	ErrInvalidToken = errors.New("invalid access token")
+	ErrTokenRevoked = errors.New("access token revoked")
+
+	ErrInvalidClient = errors.New("invalid client credentials")
+
+	ErrInvalidIdentifier = errors.New("missing phone number or email")
+	ErrEmailTaken        = errors.New("email belongs to another account")
+
+	ErrPhoneRegionNotAllowed = errors.New("phone numbers of this region are not accepted")
+
+	ErrMFAUnavailable      = errors.New("two-factor authentication is not configured")
+	ErrMFANotEnrolled      = errors.New("no authenticator app enrolled")
+	ErrMFAAlreadyEnrolled  = errors.New("authenticator app already enrolled")
+	ErrInvalidMFAToken     = errors.New("invalid or expired mfa token")
+	ErrInvalidMFACode      = errors.New("incorrect authenticator or recovery code")
+	ErrMFAAttemptsExceeded = errors.New("too many incorrect mfa codes")
+	ErrMFARequired         = errors.New("account must use its authenticator app")
+
+	ErrInvalidCredentials       = errors.New("incorrect identifier or password")
+	ErrPasswordAttemptsExceeded = errors.New("too many incorrect passwords")
+	ErrPasswordAlreadySet       = errors.New("account already has a password")
+	ErrPasswordNotSet           = errors.New("account has no password")
+	ErrPasswordBusy             = errors.New("too many password checks in progress")
+	ErrWeakPassword             = errors.New("password not accepted")
+	ErrIdentifierNotOwned       = errors.New("identifier is not a verified identifier of the account")
+
+	ErrPasskeyUnavailable   = errors.New("passkeys are not configured")
+	ErrPasskeyNotFound      = errors.New("passkey not found")
+	ErrInvalidPasskey       = errors.New("passkey verification failed")
+	ErrPasskeyCounterReused = errors.New("passkey signature counter did not increase")
+
+	ErrSessionNotFound = errors.New("session not found")
+
+	ErrUserNotFound = errors.New("user not found")
+	ErrUnknownRole  = errors.New("unknown role")
+
+	ErrInvalidRedirectURI   = errors.New("redirect uri not registered for client")
+	ErrInvalidMagicLink     = errors.New("invalid or expired magic link")
+	ErrMagicLinkUnavailable = errors.New("magic links are not configured")
 )
+
+// RetryAfterError is returned when a request was refused for now and may be
+// retried after RetryAfter.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v: retry after %s", e.Err, e.RetryAfter)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
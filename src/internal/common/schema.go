@@ -33,6 +33,12 @@ var BadParamsErrorResponse = ErrorResponse{
 	Message:    "bad parameters",
 }
 
+var UnauthorizedErrorResponse = ErrorResponse{
+	StatusCode: http.StatusUnauthorized,
+	Status:     "error",
+	Message:    "invalid or missing access token",
+}
+
 var InternalServerErrorResponse = ErrorResponse{
 	StatusCode: http.StatusInternalServerError,
 	Status:     "error",
@@ -61,7 +61,7 @@ func New() Service {
 		db:     db,
 		logger: zap.L(),
 	}
-	dbInstance.AutoMigrate(&model.User{})
+	dbInstance.AutoMigrate(&model.User{}, &model.RefreshToken{}, &model.RevokedToken{}, &model.Client{}, &model.OTPDelivery{}, &model.OTPDeadLetter{}, &model.OTPMessage{}, &model.TOTPFactor{}, &model.RecoveryCode{}, &model.WebAuthnCredential{}, &model.Session{})
 	return dbInstance
 }
 
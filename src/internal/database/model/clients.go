@@ -0,0 +1,26 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// Client is an application allowed to call goAuth's client-authenticated
+// endpoints, such as token introspection. Its OTPPolicy overrides the
+// server's for OTPs requested on its behalf, and RedirectURIs lists where
+// magic-link logins started on its behalf may send the user with tokens.
+type Client struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	ClientID   string `gorm:"uniqueIndex;not null"`
+	SecretHash string `gorm:"not null"`
+	Name       string
+	OTPPolicy  OTPPolicy `gorm:"serializer:json"`
+	// RedirectURIs are compared exactly, including scheme, port and path.
+	RedirectURIs []string `gorm:"serializer:json"`
+}
+
+// AllowsRedirect reports whether uri is one of the client's redirect URIs.
+func (c *Client) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
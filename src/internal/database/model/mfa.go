@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// TOTPFactor is a user's authenticator-app second factor. Secret is stored
+// encrypted. ConfirmedAt stays nil until the user has entered a code from the
+// app; only confirmed factors are asked for at login.
+type TOTPFactor struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UserID      uint8  `gorm:"uniqueIndex;not null"`
+	User        User   `gorm:"constraint:OnDelete:CASCADE"`
+	Secret      string `gorm:"not null"`
+	ConfirmedAt *time.Time
+	// LastStep is the time step of the last accepted code. Codes of earlier
+	// or equal steps are refused, so each code works once.
+	LastStep int64
+}
+
+// RecoveryCode is a one-time code standing in for a TOTP code when the
+// authenticator is lost. Only its hash is stored.
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint8  `gorm:"index;not null"`
+	User      User   `gorm:"constraint:OnDelete:CASCADE"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+}
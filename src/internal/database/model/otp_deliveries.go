@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// OTPDelivery is a queued OTP message waiting to be handed to the provider.
+// Payload holds the encrypted message so codes are never stored in the clear.
+type OTPDelivery struct {
+	ID            uint `gorm:"primarykey"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	RequestID     string
+	Recipient     string
+	Payload       []byte
+	ExpiresAt     time.Time
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index"`
+	LockedUntil   *time.Time
+	LastError     string
+}
+
+// OTPDeadLetter records an OTP message that could not be delivered. The code
+// itself is dropped.
+type OTPDeadLetter struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	RequestID  string `gorm:"index"`
+	Recipient  string `gorm:"index"`
+	EnqueuedAt time.Time
+	Attempts   int
+	LastError  string
+}
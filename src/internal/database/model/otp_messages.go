@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Delivery states of an OTPMessage.
+const (
+	MessageQueued    = "queued"
+	MessageSent      = "sent"
+	MessageDelivered = "delivered"
+	MessageFailed    = "failed"
+)
+
+// OTPMessage tracks the delivery of one OTP request so support can tell
+// whether a user was sent, and received, their code.
+type OTPMessage struct {
+	ID                uint `gorm:"primarykey"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	RequestID         string `gorm:"uniqueIndex"`
+	Recipient         string `gorm:"index"`
+	Channel           string
+	Status            string
+	Provider          string
+	ProviderMessageID string
+	Error             string
+	SentAt            *time.Time
+	DeliveredAt       *time.Time
+	FailedAt          *time.Time
+}
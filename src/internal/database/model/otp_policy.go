@@ -0,0 +1,82 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OTP code alphabets.
+const (
+	AlphabetNumeric      = "numeric"
+	AlphabetAlphanumeric = "alphanumeric"
+)
+
+// Bounds of OTPPolicy.Length.
+const (
+	MinOTPLength = 4
+	MaxOTPLength = 12
+)
+
+// OTPPolicy governs how OTP codes are generated, sent and verified. The
+// server's policy comes from the environment; a client's policy overrides
+// it field by field, zero fields keeping the server's value.
+type OTPPolicy struct {
+	// Length is the number of characters in a code.
+	Length int `json:"length,omitempty"`
+	// Alphabet is AlphabetNumeric or AlphabetAlphanumeric.
+	Alphabet string `json:"alphabet,omitempty"`
+	// TTL is how long a code can be verified.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// ResendInterval is the minimum time between two codes for a number.
+	ResendInterval time.Duration `json:"resend_interval,omitempty"`
+	// MaxSends codes may be sent to a number per SendWindow.
+	MaxSends   int           `json:"max_sends,omitempty"`
+	SendWindow time.Duration `json:"send_window,omitempty"`
+	// MaxVerifyAttempts wrong guesses burn a code.
+	MaxVerifyAttempts int `json:"max_verify_attempts,omitempty"`
+}
+
+// Merge returns p with the non-zero fields of override applied.
+func (p OTPPolicy) Merge(override OTPPolicy) OTPPolicy {
+	if override.Length != 0 {
+		p.Length = override.Length
+	}
+	if override.Alphabet != "" {
+		p.Alphabet = override.Alphabet
+	}
+	if override.TTL != 0 {
+		p.TTL = override.TTL
+	}
+	if override.ResendInterval != 0 {
+		p.ResendInterval = override.ResendInterval
+	}
+	if override.MaxSends != 0 {
+		p.MaxSends = override.MaxSends
+	}
+	if override.SendWindow != 0 {
+		p.SendWindow = override.SendWindow
+	}
+	if override.MaxVerifyAttempts != 0 {
+		p.MaxVerifyAttempts = override.MaxVerifyAttempts
+	}
+	return p
+}
+
+// Validate checks the fields that are set.
+func (p OTPPolicy) Validate() error {
+	var errs []error
+	if p.Length != 0 && (p.Length < MinOTPLength || p.Length > MaxOTPLength) {
+		errs = append(errs, fmt.Errorf("length must be between %d and %d", MinOTPLength, MaxOTPLength))
+	}
+	if p.Alphabet != "" && p.Alphabet != AlphabetNumeric && p.Alphabet != AlphabetAlphanumeric {
+		errs = append(errs, fmt.Errorf("alphabet must be %q or %q", AlphabetNumeric, AlphabetAlphanumeric))
+	}
+	if p.TTL < 0 || p.ResendInterval < 0 || p.SendWindow < 0 {
+		errs = append(errs, errors.New("durations must not be negative"))
+	}
+	if p.MaxSends < 0 || p.MaxVerifyAttempts < 0 {
+		errs = append(errs, errors.New("limits must not be negative"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+// UserHandle is the opaque user ID the authenticator stores with the
+// credential; all credentials of a user share it.
+type WebAuthnCredential struct {
+	ID              uint `gorm:"primarykey"`
+	CreatedAt       time.Time
+	UserID          uint8  `gorm:"index;not null"`
+	User            User   `gorm:"constraint:OnDelete:CASCADE"`
+	Name            string `gorm:"size:64"`
+	CredentialID    []byte `gorm:"uniqueIndex;not null"`
+	UserHandle      []byte `gorm:"index;not null"`
+	PublicKey       []byte `gorm:"not null"`
+	AttestationType string
+	Transports      []string `gorm:"serializer:json"`
+	AAGUID          []byte
+	// SignCount is the last signature counter the authenticator reported.
+	// A login reporting a counter that did not increase is refused.
+	SignCount      uint32
+	BackupEligible bool
+	BackupState    bool
+	LastUsedAt     *time.Time
+}
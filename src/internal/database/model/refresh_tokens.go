@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// RefreshToken is a single-use refresh token issued alongside an access token.
+// Tokens issued from the same login share a FamilyID so that the whole chain
+// can be revoked when a consumed token is presented again.
+type RefreshToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint8  `gorm:"index;not null"`
+	User      User   `gorm:"constraint:OnDelete:CASCADE"`
+	FamilyID  string `gorm:"index;not null"`
+	SessionID *uint  `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	// AuthTime and AMR record the login the family started with; rotated
+	// tokens carry them over.
+	AuthTime time.Time
+	AMR      []string `gorm:"serializer:json"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// RevokedToken records a revoked access token so revocations survive restarts.
+// A row with a SessionID revokes every token of that session. When both are
+// empty it revokes every token of UserID issued at or before CreatedAt.
+type RevokedToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	JTI       string    `gorm:"index"`
+	SessionID uint      `gorm:"index"`
+	UserID    uint8     `gorm:"index"`
+	ExpiresAt time.Time `gorm:"index"`
+}
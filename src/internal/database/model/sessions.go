@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Session is a login on one device. It starts with the first refresh token
+// of a login; every token rotated from it belongs to the same session, and
+// access tokens name it in their sid claim.
+type Session struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint8  `gorm:"index;not null"`
+	User       User   `gorm:"constraint:OnDelete:CASCADE"`
+	DeviceName string `gorm:"size:64"`
+	UserAgent  string `gorm:"size:512"`
+	IP         string `gorm:"size:64"`
+	LastSeenAt time.Time
+	RevokedAt  *time.Time
+}
@@ -2,8 +2,29 @@ package model
 
 import "time"
 
+const (
+	// RoleUser is the role given to every registered user.
+	RoleUser = "user"
+	// RoleAdmin may read and manage every user.
+	RoleAdmin = "admin"
+)
+
+// Roles lists every role a user can be granted.
+var Roles = []string{RoleUser, RoleAdmin}
+
+// User is an account. It signs in with its phone number, its email address
+// or either; at least one of them is set. PasswordHash is an Argon2id PHC
+// string, nil for accounts without a password.
 type User struct {
-	ID          uint8 `gorm:"primarykey"`
-	CreatedAt   time.Time
-	PhoneNumber string `gorm:"unique;not null" validate:"required,regexp=^09[0-9]{9}$"`
+	ID            uint8 `gorm:"primarykey"`
+	CreatedAt     time.Time
+	PhoneNumber   *string  `gorm:"unique"`
+	PhoneVerified bool     `gorm:"not null;default:false"`
+	Email         *string  `gorm:"unique"`
+	EmailVerified bool     `gorm:"not null;default:false"`
+	Roles         []string `gorm:"serializer:json"`
+	Tenant        string
+
+	PasswordHash      *string `json:"-"`
+	PasswordChangedAt *time.Time
 }
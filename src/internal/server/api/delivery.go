@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/utils/phonenumber"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type DeliveryService interface {
+	Stats() []schema.ProviderStats
+}
+
+type TrackingService interface {
+	History(recipient string, limit int) ([]schema.DeliveryMessage, error)
+	HandleReceipt(provider string, body []byte, timestamp, signature string) error
+}
+
+type DeliveryHandler struct {
+	logger   *zap.Logger
+	service  DeliveryService
+	tracking TrackingService
+}
+
+func NewDeliveryHandler(service DeliveryService, tracking TrackingService) *DeliveryHandler {
+	return &DeliveryHandler{
+		logger:   zap.L(),
+		service:  service,
+		tracking: tracking,
+	}
+}
+
+// ProviderStats godoc
+//
+//	@Summary		OTP provider statistics
+//	@Description	Reports the success rate and latency of every OTP provider. Degraded providers are tried last. Requires the admin role.
+//	@Tags			Delivery
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{array}		schema.ProviderStats
+//	@Failure		401	{object}	common.ErrorResponse
+//	@Failure		403	{object}	common.ErrorResponse
+//	@Router			/api/v1/delivery/providers [get]
+func (h *DeliveryHandler) ProviderStats(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(h.service.Stats())
+}
+
+// History godoc
+//
+//	@Summary		OTP delivery history
+//	@Description	Lists the most recent OTP messages sent to a phone number or an email address, given by exactly one of phone_number and email, with their delivery status. Requires the admin role.
+//	@Tags			Delivery
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			phone_number	query		string	false	"Phone number, international or national"
+//	@Param			email			query		string	false	"Email address"
+//	@Param			limit			query		int		false	"Maximum number of messages (default 20, max 100)"
+//	@Success		200				{array}		schema.DeliveryMessage
+//	@Failure		400				{object}	common.ErrorResponse
+//	@Failure		401				{object}	common.ErrorResponse
+//	@Failure		403				{object}	common.ErrorResponse
+//	@Failure		500				{object}	common.ErrorResponse
+//	@Router			/api/v1/delivery/messages [get]
+func (h *DeliveryHandler) History(c *fiber.Ctx) error {
+	var recipient string
+	switch phoneNumber, email := c.Query("phone_number"), c.Query("email"); {
+	case phoneNumber != "" && email == "":
+		normalized, err := phonenumber.Normalize(phoneNumber)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+		}
+		recipient = normalized
+	case email != "" && phoneNumber == "":
+		if common.Validate.Var(email, "email,max=254") != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+		}
+		recipient = schema.EmailIdentifier(email).Value
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+
+	history, err := h.tracking.History(recipient, c.QueryInt("limit"))
+	if err != nil {
+		h.logger.Error("failed to load delivery history", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+	return c.Status(fiber.StatusOK).JSON(history)
+}
+
+// Receipt godoc
+//
+//	@Summary		Delivery receipt webhook
+//	@Description	Receives delivery receipts from an OTP provider. The X-Signature header carries "sha256=" and the hex HMAC-SHA256, under the provider's webhook secret, of the X-Signature-Timestamp value, a dot and the raw body. Each signed receipt is applied once, and a message's status only moves forward.
+//	@Tags			Delivery
+//	@Accept			json
+//	@Produce		json
+//	@Param			provider				path		string					true	"Provider name"
+//	@Param			X-Signature				header		string					true	"sha256=<hex hmac>"
+//	@Param			X-Signature-Timestamp	header		string					true	"Unix timestamp in seconds"
+//	@Param			DeliveryReceipt			body		schema.DeliveryReceipt	true	"Delivery receipt"
+//	@Success		200						{object}	common.BasicResponse
+//	@Failure		400						{object}	common.ErrorResponse
+//	@Failure		401						{object}	common.ErrorResponse
+//	@Failure		404						{object}	common.ErrorResponse
+//	@Failure		409						{object}	common.ErrorResponse
+//	@Failure		500						{object}	common.ErrorResponse
+//	@Router			/api/v1/delivery/receipts/{provider} [post]
+func (h *DeliveryHandler) Receipt(c *fiber.Ctx) error {
+	err := h.tracking.HandleReceipt(c.Params("provider"), c.Body(), c.Get("X-Signature-Timestamp"), c.Get("X-Signature"))
+	switch {
+	case err == nil:
+		return c.Status(fiber.StatusOK).JSON(common.OkBasicResponse)
+	case errors.Is(err, common.ErrInvalidWebhookSignature):
+		h.logger.Warn("rejected delivery receipt", zap.String("provider", c.Params("provider")), zap.Error(err))
+		return c.Status(fiber.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: fiber.StatusUnauthorized,
+			Status:     "error",
+			Message:    "invalid signature",
+		})
+	case errors.Is(err, common.ErrInvalidDeliveryReceipt):
+		return c.Status(fiber.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: fiber.StatusBadRequest,
+			Status:     "error",
+			Message:    err.Error(),
+		})
+	case errors.Is(err, common.ErrMessageNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(common.ErrorResponse{
+			StatusCode: fiber.StatusNotFound,
+			Status:     "error",
+			Message:    "message not found",
+		})
+	case errors.Is(err, common.ErrReceiptReplayed):
+		return c.Status(fiber.StatusConflict).JSON(common.ErrorResponse{
+			StatusCode: fiber.StatusConflict,
+			Status:     "error",
+			Message:    err.Error(),
+		})
+	default:
+		h.logger.Error("failed to apply delivery receipt", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+}
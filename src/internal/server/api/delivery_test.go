@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"goAuth/internal/server/api/schema"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// recipientTracking records the recipient History was asked for.
+type recipientTracking struct {
+	TrackingService
+	recipient string
+}
+
+func (t *recipientTracking) History(recipient string, limit int) ([]schema.DeliveryMessage, error) {
+	t.recipient = recipient
+	return []schema.DeliveryMessage{}, nil
+}
+
+func TestDeliveryHistoryRecipients(t *testing.T) {
+	tests := []struct {
+		query      url.Values
+		wantStatus int
+		want       string
+	}{
+		{url.Values{"phone_number": {"+989123456789"}}, http.StatusOK, "+989123456789"},
+		{url.Values{"email": {"Bob@Example.com"}}, http.StatusOK, "bob@example.com"},
+		{url.Values{"email": {"not-an-email"}}, http.StatusBadRequest, ""},
+		{url.Values{"phone_number": {"+989123456789"}, "email": {"bob@example.com"}}, http.StatusBadRequest, ""},
+		{url.Values{}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		tracking := &recipientTracking{}
+		app := fiber.New()
+		app.Get("/api/v1/delivery/messages", NewDeliveryHandler(nil, tracking).History)
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/delivery/messages?"+tt.query.Encode(), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.wantStatus || tracking.recipient != tt.want {
+			t.Errorf("History(%s) = %d for %q, want %d for %q", tt.query.Encode(), resp.StatusCode, tracking.recipient, tt.wantStatus, tt.want)
+		}
+	}
+}
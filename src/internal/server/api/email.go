@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/server/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// LinkEmail godoc
+//
+//	@Summary		Add an email address
+//	@Description	Sends a code to the given email address. Verifying it with /api/v1/auth/email/verify adds the address to the caller's account, after which the account can also sign in by email.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			EmailLinkRequest	body		schema.EmailLinkRequest	true	"Email address"
+//	@Success		200					{object}	common.BasicResponse	"Code sent"
+//	@Failure		400					{object}	common.ErrorResponse	"Invalid request body or email not deliverable"
+//	@Failure		401					{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		409					{object}	common.ErrorResponse	"Email belongs to another account"
+//	@Failure		429					{object}	common.ErrorResponse	"Too many OTP requests"
+//	@Failure		503					{object}	common.ErrorResponse	"Email provider unavailable, retry later"
+//	@Router			/api/v1/auth/email [post]
+func (h *LoginHandler) LinkEmail(c *fiber.Ctx) error {
+	req := new(schema.EmailLinkRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Any("req", req), zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+	if req.Locale == "" {
+		req.Locale = c.Get(fiber.HeaderAcceptLanguage)
+	}
+
+	requestID, err := h.service.RequestEmailLink(principal.UserID, req.Email, req.Locale)
+	if errors.Is(err, common.ErrEmailTaken) {
+		return emailTaken(c)
+	}
+	if err != nil {
+		return otpRequestFailed(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Message:    "OTP sent successfully",
+		},
+		Data: map[string]string{"request_id": requestID},
+	})
+}
+
+// VerifyEmail godoc
+//
+//	@Summary		Verify an added email address
+//	@Description	Checks the code sent by /api/v1/auth/email and adds the address to the caller's account as verified.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			EmailVerifyRequest	body		schema.EmailVerifyRequest	true	"Email address and code"
+//	@Success		200					{object}	common.BasicResponse		"Email verified"
+//	@Failure		400					{object}	common.ErrorResponse		"Invalid request body"
+//	@Failure		401					{object}	common.ErrorResponse		"Incorrect code or missing access token"
+//	@Failure		404					{object}	common.ErrorResponse		"OTP not found or expired"
+//	@Failure		409					{object}	common.ErrorResponse		"Email belongs to another account"
+//	@Failure		429					{object}	common.ErrorResponse		"Too many incorrect codes"
+//	@Router			/api/v1/auth/email/verify [post]
+func (h *LoginHandler) VerifyEmail(c *fiber.Ctx) error {
+	req := new(schema.EmailVerifyRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Any("req", req), zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	err := h.service.VerifyEmailLink(principal.UserID, req.Email, req.OTPCode)
+	if errors.Is(err, common.ErrEmailTaken) {
+		return emailTaken(c)
+	}
+	if err != nil {
+		return otpVerifyFailed(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponse{
+		StatusCode: http.StatusOK,
+		Status:     "Ok",
+		Message:    "Email verified",
+	})
+}
+
+func emailTaken(c *fiber.Ctx) error {
+	return c.Status(http.StatusConflict).JSON(common.ErrorResponse{
+		StatusCode: http.StatusConflict,
+		Status:     "error",
+		Message:    "Email belongs to another account",
+	})
+}
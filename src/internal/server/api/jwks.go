@@ -0,0 +1,37 @@
+package api
+
+import (
+	"goAuth/internal/server/api/schema"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type KeyService interface {
+	JWKS() schema.JWKS
+}
+
+type KeyHandler struct {
+	logger  *zap.Logger
+	service KeyService
+}
+
+func NewKeyHandler(service KeyService) *KeyHandler {
+	return &KeyHandler{
+		logger:  zap.L(),
+		service: service,
+	}
+}
+
+// JWKS godoc
+//
+//	@Summary		JSON Web Key Set
+//	@Description	Returns the public keys used to verify access tokens. Empty when tokens are signed with a shared secret.
+//	@Tags			Keys
+//	@Produce		json
+//	@Success		200	{object}	schema.JWKS
+//	@Router			/.well-known/jwks.json [get]
+func (h *KeyHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(h.service.JWKS())
+}
@@ -5,18 +5,34 @@ import (
 	"fmt"
 	"goAuth/internal/common"
 	"goAuth/internal/server/api/schema"
-	"goAuth/internal/utils/ratelimit"
+	"goAuth/internal/server/middleware"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 )
 
 type LoginService interface {
-	OTPRequest(phoneNumber string) error
-	OTPVerify(phoneNumber string, otpCode string) (bool, error)
-	RegisterUser(phoneNumber string) (created bool, err error)
-	GenerateToken(phoneNumber string) (accessToken string, err error)
+	OTPRequest(req schema.OTPRequest) (requestID, usedChannel string, err error)
+	OTPVerify(id schema.Identifier, otpCode string) (bool, error)
+	RegisterUser(id schema.Identifier) (created bool, err error)
+	IssueTokens(id schema.Identifier, method string, client schema.SessionClient) (accessToken, refreshToken string, err error)
+	RequestEmailLink(userID uint8, email, locale string) (requestID string, err error)
+	VerifyEmailLink(userID uint8, email, otpCode string) error
+	RequestMagicLink(req schema.MagicLinkRequest) (requestID string, err error)
+	ConsumeMagicLink(token string) (id schema.Identifier, redirectURI string, err error)
+	MFAChallenge(id schema.Identifier, method string) (mfaToken string, err error)
+	CompleteMFA(req schema.MFAVerifyRequest, client schema.SessionClient) (accessToken, refreshToken string, err error)
+	PasswordLogin(id schema.Identifier, password string) error
+	SetPassword(userID uint8, req schema.PasswordOTPRequest) error
+	ChangePassword(userID uint8, req schema.ChangePasswordRequest) error
+	ResetPassword(req schema.PasswordOTPRequest) error
+	StepUp(accessToken string, req schema.StepUpRequest) (schema.StepUpToken, error)
+	RefreshToken(refreshToken string, client schema.SessionClient) (accessToken string, newRefreshToken string, err error)
+	Logout(accessToken, refreshToken string) error
+	LogoutAll(accessToken string) error
 }
 
 type LoginHandler struct {
@@ -34,51 +50,54 @@ func NewLoginHandler(service LoginService) *LoginHandler {
 // RequestOTP godoc
 //
 //	@Summary		Request OTP
-//	@Description	Requests an OTP to be sent to the given phone number.
+//	@Description	Requests an OTP to be sent to the given phone number. Code length, alphabet, lifetime and send limits follow the OTP policy of the client when it authenticates with its credentials (HTTP Basic), or the server policy otherwise. The message language comes from the locale field, or the Accept-Language header when it is empty. Without a channel the code goes by SMS, and a new request shortly after the previous one falls back to the next channel (messaging app, then voice call). The response names the channel used; its request_id identifies the message in the delivery history.
 //	@Tags			Auth
 //	@Accept			json
 //	@Produce		json
-//	@Param			OTPRequest	body		schema.OTPRequest		true	"Phone number for OTP"
+//	@Param			OTPRequest		body		schema.OTPRequest		true	"Phone number for OTP"
+//	@Param			Accept-Language	header		string					false	"Preferred message languages"
 //	@Success		200			{object}	common.BasicResponse	"OTP sent successfully"
-//	@Failure		400			{object}	common.ErrorResponse	"Invalid request body"
-//	@Failure		429			{object}	common.ErrorResponse	"Too many OTP requests"
+//	@Failure		400			{object}	common.ErrorResponse	"Invalid request body or phone number, unsupported country or unavailable channel"
+//	@Failure		401			{object}	common.ErrorResponse	"Invalid client credentials"
+//	@Failure		429			{object}	common.ErrorResponse	"Too many OTP requests or requested again too soon"
 //	@Failure		500			{object}	common.ErrorResponse	"Internal server error"
+//	@Failure		502			{object}	common.ErrorResponse	"OTP provider rejected the message"
+//	@Failure		503			{object}	common.ErrorResponse	"OTP provider unavailable, retry later"
 //	@Router			/api/v1/auth/request [post]
 func (h *LoginHandler) RequestOTP(c *fiber.Ctx) error {
 	req := new(schema.OTPRequest)
-	common.Validate.RegisterValidation("regex", schema.PhoneNumberValidator)
-
 	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
 		h.logger.Debug("req body is not valid", zap.Any("req", req), zap.Error(errors.Join(errParse, errValidate)))
 		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
 	}
 
-	limited, retryAfter := ratelimit.RateLimit("otp:"+req.PhoneNumber, 3, 10*60)
-	if limited {
-		return c.Status(http.StatusTooManyRequests).JSON(common.ErrorResponse{
-			StatusCode: http.StatusTooManyRequests,
-			Status:     "error",
-			Message:    fmt.Sprintf("Too many OTP requests. Please try again after %d minutes.", (retryAfter+59)/60),
-		})
+	if _, ok := req.Identifier(); !ok {
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	if req.Locale == "" {
+		req.Locale = c.Get(fiber.HeaderAcceptLanguage)
+	}
+	if client, ok := middleware.ClientFrom(c); ok {
+		req.ClientID = client.ClientID
 	}
 
-	if err := h.service.OTPRequest(req.PhoneNumber); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(common.ErrorResponse{
-			StatusCode: http.StatusInternalServerError,
-			Status:     "error",
-			Message:    "OTP Creation faild",
-		})
+	requestID, channel, err := h.service.OTPRequest(*req)
+	if err != nil {
+		return otpRequestFailed(c, err)
 	}
-	return c.Status(http.StatusOK).JSON(common.BasicResponse{
-		StatusCode: http.StatusOK,
-		Message:    "OTP sent successfully",
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Message:    "OTP sent successfully",
+		},
+		Data: map[string]string{"request_id": requestID, "channel": channel},
 	})
 }
 
 // VerifyOTP godoc
 //
 //	@Summary		Verify OTP
-//	@Description	Verifies the OTP code for the given phone number and returns an access token.
+//	@Description	Verifies the OTP code for the given phone number and returns an access token and a refresh token. Accounts with an authenticator app get an mfa_token to complete at /api/v1/auth/mfa/verify instead.
 //	@Tags			Auth
 //	@Accept			json
 //	@Produce		json
@@ -87,78 +106,377 @@ func (h *LoginHandler) RequestOTP(c *fiber.Ctx) error {
 //	@Failure		400				{object}	common.ErrorResponse	"Invalid request body"
 //	@Failure		401				{object}	common.ErrorResponse	"Incorrect OTP code or verification failed"
 //	@Failure		404				{object}	common.ErrorResponse	"OTP not found or expired"
+//	@Failure		429				{object}	common.ErrorResponse	"Too many incorrect OTP codes, request a new one"
 //	@Failure		500				{object}	common.ErrorResponse	"Internal server error"
 //	@Router			/api/v1/auth/verify [post]
 func (h *LoginHandler) VerifyOTP(c *fiber.Ctx) error {
-	common.Validate.RegisterValidation("regex", schema.PhoneNumberValidator)
-
 	req := new(schema.LoginRequest)
 	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
 		h.logger.Debug("req body is not valid", zap.Any("req", req), zap.Error(errors.Join(errParse, errValidate)))
 		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
 	}
 
-	verified, err := h.service.OTPVerify(req.PhoneNumber, req.OTPCode)
+	id, ok := req.Identifier()
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+
+	verified, err := h.service.OTPVerify(id, req.OTPCode)
+	if err != nil {
+		return otpVerifyFailed(c, err)
+	}
+
+	if !verified {
+		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: http.StatusUnauthorized,
+			Status:     "error",
+			Message:    "OTP verification failed",
+		})
+	}
+
+	tokens, failure := h.signIn(c, id, schema.MethodOTP)
+	if failure != nil {
+		return c.Status(failure.StatusCode).JSON(failure)
+	}
+	message := "OTP verified successfully"
+	if _, ok := tokens["mfa_token"]; ok {
+		message = "Second factor required"
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Message:    message,
+			Status:     "Ok",
+		},
+		Data: tokens,
+	})
+}
+
+// signIn registers the account of the identifier id, just verified with
+// method, when it is new and issues its access and refresh tokens. Accounts
+// with a second factor get an mfa_token for /api/v1/auth/mfa/verify instead.
+// On failure it returns the error response to answer with.
+func (h *LoginHandler) signIn(c *fiber.Ctx, id schema.Identifier, method string) (map[string]string, *common.ErrorResponse) {
+	if _, err := h.service.RegisterUser(id); err != nil {
+		return nil, &common.ErrorResponse{
+			StatusCode: http.StatusInternalServerError,
+			Status:     "error",
+			Message:    "Error creating new user",
+		}
+	}
+	return h.issueTokens(c, id, method)
+}
+
+// issueTokens starts a session for the existing account of id, which just
+// authenticated with method, on the device making request c and returns its
+// access and refresh tokens, or an mfa_token when the account has a second
+// factor.
+func (h *LoginHandler) issueTokens(c *fiber.Ctx, id schema.Identifier, method string) (map[string]string, *common.ErrorResponse) {
+	mfaToken, err := h.service.MFAChallenge(id, method)
+	if err != nil {
+		h.logger.Error("failed to check second factor", zap.Error(err))
+		return nil, &common.InternalServerErrorResponse
+	}
+	if mfaToken != "" {
+		return map[string]string{"mfa_token": mfaToken, "mfa_method": "totp"}, nil
+	}
+	accessToken, refreshToken, err := h.service.IssueTokens(id, method, sessionClient(c))
+	if err != nil {
+		h.logger.Error("failed to issue tokens", zap.Error(err))
+		return nil, &common.ErrorResponse{
+			StatusCode: http.StatusInternalServerError,
+			Status:     "error",
+			Message:    "Error creating tokens",
+		}
+	}
+	return map[string]string{"access_token": accessToken, "refresh_token": refreshToken}, nil
+}
+
+// VerifyMFA godoc
+//
+//	@Summary		Complete a login with a second factor
+//	@Description	Accounts with an authenticator app get an mfa_token instead of tokens from /api/v1/auth/verify and the magic-link callback. Exchanging it here with a current code from the app, or an unused recovery code, returns the access and refresh tokens. The mfa_token lives 5 minutes and is burned after 5 incorrect codes.
+//	@Tags			MFA
+//	@Accept			json
+//	@Produce		json
+//	@Param			MFAVerifyRequest	body		schema.MFAVerifyRequest	true	"MFA token and code"
+//	@Success		200					{object}	common.BasicResponse	"Signed in"
+//	@Failure		400					{object}	common.ErrorResponse	"Invalid request body"
+//	@Failure		401					{object}	common.ErrorResponse	"Incorrect code, or invalid or expired mfa_token"
+//	@Failure		429					{object}	common.ErrorResponse	"Too many incorrect codes, log in again"
+//	@Failure		500					{object}	common.ErrorResponse	"Internal server error"
+//	@Router			/api/v1/auth/mfa/verify [post]
+func (h *LoginHandler) VerifyMFA(c *fiber.Ctx) error {
+	req := new(schema.MFAVerifyRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+
+	accessToken, refreshToken, err := h.service.CompleteMFA(*req, sessionClient(c))
+	switch {
+	case errors.Is(err, common.ErrInvalidMFAToken):
+		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: http.StatusUnauthorized,
+			Status:     "error",
+			Message:    "Invalid or expired mfa_token, log in again",
+		})
+	case errors.Is(err, common.ErrInvalidMFACode):
+		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: http.StatusUnauthorized,
+			Status:     "error",
+			Message:    "Incorrect code",
+		})
+	case errors.Is(err, common.ErrMFAAttemptsExceeded):
+		return c.Status(http.StatusTooManyRequests).JSON(common.ErrorResponse{
+			StatusCode:  http.StatusTooManyRequests,
+			Status:      "error",
+			Message:     "Too many incorrect codes, log in again",
+			NeedRetry:   true,
+			RetryReason: "mfa_attempts_exceeded",
+		})
+	case err != nil:
+		h.logger.Error("failed to complete mfa login", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Message:    "Signed in",
+			Status:     "Ok",
+		},
+		Data: map[string]string{"access_token": accessToken, "refresh_token": refreshToken},
+	})
+}
+
+// RefreshToken godoc
+//
+//	@Summary		Refresh tokens
+//	@Description	Exchanges a refresh token for a new access token and a new refresh token. Each refresh token can be used once; reusing one revokes every token issued from the same login.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			RefreshRequest	body		schema.RefreshRequest	true	"Refresh token"
+//	@Success		200				{object}	common.BasicResponse	"Tokens refreshed successfully"
+//	@Failure		400				{object}	common.ErrorResponse	"Invalid request body"
+//	@Failure		401				{object}	common.ErrorResponse	"Invalid, expired or reused refresh token"
+//	@Failure		500				{object}	common.ErrorResponse	"Internal server error"
+//	@Router			/api/v1/auth/refresh [post]
+func (h *LoginHandler) RefreshToken(c *fiber.Ctx) error {
+	req := new(schema.RefreshRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+
+	accessToken, refreshToken, err := h.service.RefreshToken(req.RefreshToken, sessionClient(c))
 	if err != nil {
 		switch {
-		case errors.Is(err, common.ErrGetOTP):
-			return c.Status(http.StatusNotFound).JSON(common.ErrorResponse{
-				StatusCode: http.StatusNotFound,
+		case errors.Is(err, common.ErrInvalidRefreshToken):
+			return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+				StatusCode: http.StatusUnauthorized,
 				Status:     "error",
-				Message:    "OTP not found or expired",
+				Message:    "Invalid refresh token",
 			})
-		case errors.Is(err, common.ErrInvalidOTP):
-			return c.Status(http.StatusInternalServerError).JSON(common.ErrorResponse{
-				StatusCode: http.StatusInternalServerError,
+		case errors.Is(err, common.ErrRefreshTokenExpired):
+			return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+				StatusCode: http.StatusUnauthorized,
 				Status:     "error",
-				Message:    "Internal error verifying OTP",
+				Message:    "Refresh token expired",
 			})
-		case errors.Is(err, common.ErrCompareOTP):
+		case errors.Is(err, common.ErrRefreshTokenReused):
 			return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
 				StatusCode: http.StatusUnauthorized,
 				Status:     "error",
-				Message:    "Incorrect OTP code",
+				Message:    "Refresh token already used, session revoked",
 			})
 		default:
 			return c.Status(http.StatusInternalServerError).JSON(common.ErrorResponse{
 				StatusCode: http.StatusInternalServerError,
 				Status:     "error",
-				Message:    "Unknown error verifying OTP",
+				Message:    "Unknown error refreshing token",
 			})
 		}
 	}
 
-	if !verified {
-		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
-			StatusCode: http.StatusUnauthorized,
-			Status:     "error",
-			Message:    "OTP verification failed",
-		})
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Message:    "Tokens refreshed successfully",
+			Status:     "Ok",
+		},
+		Data: map[string]string{"access_token": accessToken, "refresh_token": refreshToken},
+	})
+}
+
+// Logout godoc
+//
+//	@Summary		Logout
+//	@Description	Revokes the access token sent in the Authorization header and, if provided, the refresh token of the same session.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			LogoutRequest	body		schema.LogoutRequest	false	"Refresh token of the current session"
+//	@Success		200				{object}	common.BasicResponse	"Logged out successfully"
+//	@Failure		400				{object}	common.ErrorResponse	"Invalid request body"
+//	@Failure		401				{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		500				{object}	common.ErrorResponse	"Internal server error"
+//	@Router			/api/v1/auth/logout [post]
+func (h *LoginHandler) Logout(c *fiber.Ctx) error {
+	accessToken, ok := middleware.BearerToken(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
 	}
 
-	_, err = h.service.RegisterUser(req.PhoneNumber)
-	if err != nil {
+	req := new(schema.LogoutRequest)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(req); err != nil {
+			h.logger.Debug("req body is not valid", zap.Error(err))
+			return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+		}
+	}
+
+	if err := h.service.Logout(accessToken, req.RefreshToken); err != nil {
+		return h.logoutError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponse{
+		StatusCode: http.StatusOK,
+		Status:     "Ok",
+		Message:    "Logged out successfully",
+	})
+}
+
+// LogoutAll godoc
+//
+//	@Summary		Logout from all sessions
+//	@Description	Revokes every access and refresh token issued to the user owning the access token in the Authorization header.
+//	@Tags			Auth
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	common.BasicResponse	"Logged out from all sessions"
+//	@Failure		401	{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		500	{object}	common.ErrorResponse	"Internal server error"
+//	@Router			/api/v1/auth/logout-all [post]
+func (h *LoginHandler) LogoutAll(c *fiber.Ctx) error {
+	accessToken, ok := middleware.BearerToken(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	if err := h.service.LogoutAll(accessToken); err != nil {
+		return h.logoutError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponse{
+		StatusCode: http.StatusOK,
+		Status:     "Ok",
+		Message:    "Logged out from all sessions",
+	})
+}
+
+func (h *LoginHandler) logoutError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, common.ErrInvalidToken), errors.Is(err, common.ErrTokenRevoked):
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	default:
+		h.logger.Error("logout failed", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+}
+
+// otpVerifyFailed answers a request whose OTP verification returned err.
+func otpVerifyFailed(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, common.ErrGetOTP):
+		return c.Status(http.StatusNotFound).JSON(common.ErrorResponse{
+			StatusCode: http.StatusNotFound,
+			Status:     "error",
+			Message:    "OTP not found or expired",
+		})
+	case errors.Is(err, common.ErrInvalidOTP):
 		return c.Status(http.StatusInternalServerError).JSON(common.ErrorResponse{
 			StatusCode: http.StatusInternalServerError,
 			Status:     "error",
-			Message:    "Error creating new user",
+			Message:    "Internal error verifying OTP",
 		})
-	}
-	accessToken, err := h.service.GenerateToken(req.PhoneNumber)
-	if err != nil {
+	case errors.Is(err, common.ErrCompareOTP):
+		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: http.StatusUnauthorized,
+			Status:     "error",
+			Message:    "Incorrect OTP code",
+		})
+	case errors.Is(err, common.ErrOTPAttemptsExceeded):
+		return c.Status(http.StatusTooManyRequests).JSON(common.ErrorResponse{
+			StatusCode:  http.StatusTooManyRequests,
+			Status:      "error",
+			Message:     "Too many incorrect OTP codes, the code has been invalidated",
+			NeedRetry:   true,
+			RetryReason: "otp_attempts_exceeded",
+		})
+	default:
 		return c.Status(http.StatusInternalServerError).JSON(common.ErrorResponse{
 			StatusCode: http.StatusInternalServerError,
 			Status:     "error",
-			Message:    fmt.Sprintf("err: %v\n", err),
+			Message:    "Unknown error verifying OTP",
 		})
 	}
+}
 
-	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
-		BasicResponse: common.BasicResponse{
-			StatusCode: http.StatusOK,
-			Message:    "OTP verified successfully",
-			Status:     "Ok",
-		},
-		Data: map[string]string{"access_token": accessToken},
+// otpRequestFailed answers a request whose OTP could not be issued with err.
+func otpRequestFailed(c *fiber.Ctx, err error) error {
+	var retry *common.RetryAfterError
+	switch {
+	case errors.As(err, &retry):
+		seconds := int64((retry.RetryAfter + time.Second - 1) / time.Second)
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(seconds, 10))
+		message := fmt.Sprintf("Too many OTP requests. Please try again after %d minutes.", (seconds+59)/60)
+		if errors.Is(err, common.ErrOTPResendTooSoon) {
+			message = fmt.Sprintf("Please wait %d seconds before requesting another code.", seconds)
+		}
+		return c.Status(http.StatusTooManyRequests).JSON(common.ErrorResponse{
+			StatusCode: http.StatusTooManyRequests,
+			Status:     "error",
+			Message:    message,
+		})
+	case errors.Is(err, common.ErrInvalidClient):
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "Unknown client",
+		})
+	case errors.Is(err, common.ErrPhoneRegionNotAllowed):
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "Phone numbers from this country are not supported",
+		})
+	case errors.Is(err, common.ErrInvalidIdentifier):
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	case errors.Is(err, common.ErrChannelUnavailable):
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "OTP cannot be sent over this channel",
+		})
+	case errors.Is(err, common.ErrOTPDeliveryUnavailable):
+		return c.Status(http.StatusServiceUnavailable).JSON(common.ErrorResponse{
+			StatusCode:  http.StatusServiceUnavailable,
+			Status:      "error",
+			Message:     "OTP could not be sent right now, please try again",
+			NeedRetry:   true,
+			RetryReason: "otp_delivery_unavailable",
+		})
+	case errors.Is(err, common.ErrOTPDeliveryFailed):
+		return c.Status(http.StatusBadGateway).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadGateway,
+			Status:     "error",
+			Message:    "OTP could not be delivered",
+		})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(common.ErrorResponse{
+		StatusCode: http.StatusInternalServerError,
+		Status:     "error",
+		Message:    "OTP Creation faild",
 	})
 }
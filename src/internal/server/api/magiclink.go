@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/server/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// RequestMagicLink godoc
+//
+//	@Summary		Request a magic link
+//	@Description	Emails a single-use sign-in link to the given address. The link points at MAGIC_LINK_CALLBACK_URL. The link expires after MAGIC_LINK_TTL (15 minutes by default) and counts against the OTP send limits of the address. With a redirect_uri registered for client_id, following the link redirects there with the tokens in the URL fragment; otherwise the callback answers with the tokens. A client that authenticates with its credentials (HTTP Basic) gets its OTP policy's send limits.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			MagicLinkRequest	body		schema.MagicLinkRequest	true	"Email address"
+//	@Param			Accept-Language		header		string					false	"Preferred message languages"
+//	@Success		200					{object}	common.BasicResponse	"Magic link sent"
+//	@Failure		400					{object}	common.ErrorResponse	"Invalid request body, unknown client, unregistered redirect_uri or email not deliverable"
+//	@Failure		401					{object}	common.ErrorResponse	"Invalid client credentials"
+//	@Failure		429					{object}	common.ErrorResponse	"Too many requests for this address"
+//	@Failure		502					{object}	common.ErrorResponse	"Email provider rejected the message"
+//	@Failure		503					{object}	common.ErrorResponse	"Email provider unavailable or magic links not configured"
+//	@Router			/api/v1/auth/magic-link [post]
+func (h *LoginHandler) RequestMagicLink(c *fiber.Ctx) error {
+	req := new(schema.MagicLinkRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Any("req", req), zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	if req.Locale == "" {
+		req.Locale = c.Get(fiber.HeaderAcceptLanguage)
+	}
+	if client, ok := middleware.ClientFrom(c); ok {
+		if req.ClientID != "" && req.ClientID != client.ClientID {
+			return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+				StatusCode: http.StatusBadRequest,
+				Status:     "error",
+				Message:    "client_id does not match the client credentials",
+			})
+		}
+		req.ClientID, req.ClientAuthenticated = client.ClientID, true
+	}
+
+	requestID, err := h.service.RequestMagicLink(*req)
+	if errors.Is(err, common.ErrInvalidRedirectURI) {
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "redirect_uri is not registered for this client",
+		})
+	}
+	if errors.Is(err, common.ErrMagicLinkUnavailable) {
+		return c.Status(http.StatusServiceUnavailable).JSON(common.ErrorResponse{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "error",
+			Message:    "Magic links are not configured",
+		})
+	}
+	if err != nil {
+		return otpRequestFailed(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Message:    "Magic link sent",
+		},
+		Data: map[string]string{"request_id": requestID},
+	})
+}
+
+// MagicLinkCallback godoc
+//
+//	@Summary		Follow a magic link
+//	@Description	Consumes the token of a magic link, creating the account on first sign-in. When the link was requested with a redirect_uri, answers with a redirect to it carrying access_token, refresh_token and token_type in the URL fragment; otherwise returns the tokens like /api/v1/auth/verify. Accounts with an authenticator app get mfa_token and mfa_method instead of tokens. Each link works once.
+//	@Tags			Auth
+//	@Produce		json
+//	@Param			token	query		string					true	"Token from the emailed link"
+//	@Success		200		{object}	common.BasicResponse	"Signed in"
+//	@Success		302		{string}	string					"Redirect to the client with the tokens"
+//	@Failure		401		{object}	common.ErrorResponse	"Invalid, expired or already used link"
+//	@Failure		500		{object}	common.ErrorResponse	"Internal server error"
+//	@Router			/api/v1/auth/magic-link/callback [get]
+func (h *LoginHandler) MagicLinkCallback(c *fiber.Ctx) error {
+	// The URL and the tokens must not outlive this response.
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderReferrerPolicy, "no-referrer")
+
+	id, redirectURI, err := h.service.ConsumeMagicLink(c.Query("token"))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: http.StatusUnauthorized,
+			Status:     "error",
+			Message:    "Invalid or expired magic link",
+		})
+	}
+
+	tokens, failure := h.signIn(c, id, schema.MethodMagicLink)
+	if failure != nil {
+		return c.Status(failure.StatusCode).JSON(failure)
+	}
+	_, needsMFA := tokens["mfa_token"]
+	if redirectURI != "" {
+		// The fragment keeps the tokens out of server logs and Referer headers.
+		fragment := url.Values{}
+		for name, value := range tokens {
+			fragment.Set(name, value)
+		}
+		if !needsMFA {
+			fragment.Set("token_type", "Bearer")
+		}
+		return c.Redirect(redirectURI+"#"+fragment.Encode(), http.StatusFound)
+	}
+	message := "Signed in"
+	if needsMFA {
+		message = "Second factor required"
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Message:    message,
+			Status:     "Ok",
+		},
+		Data: tokens,
+	})
+}
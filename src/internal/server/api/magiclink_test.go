@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/auth"
+	"goAuth/internal/service/delivery"
+	inmemory "goAuth/internal/service/in-memory"
+	"goAuth/internal/service/signing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRequestMagicLinkIgnoresHostHeader(t *testing.T) {
+	const callback = "https://auth.example.com/api/v1/auth/magic-link/callback"
+	sender := &delivery.RecordingSender{}
+	service := auth.NewAuthenticationService(nil, inmemory.NewInMemoryStore(), nil, sender, nil)
+	service.SetMagicLinkCallback(callback)
+
+	app := fiber.New()
+	app.Post("/api/v1/auth/magic-link", NewLoginHandler(service).RequestMagicLink)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/magic-link", strings.NewReader(`{"email":"bob@example.com"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Host = "attacker.example.net"
+	req.Header.Set("X-Forwarded-Host", "attacker.example.net")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	msg, ok := sender.Last()
+	if !ok || !strings.HasPrefix(msg.Link, callback+"?token=") {
+		t.Fatalf("sent link %q, want one to %s", msg.Link, callback)
+	}
+}
+
+func TestMagicLinkCallbackRecordsMethod(t *testing.T) {
+	const callback = "https://auth.example.com/api/v1/auth/magic-link/callback"
+	t.Setenv("ACCESS_EXPIRY", "1h")
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "auth.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.Client{}, &model.RefreshToken{}, &model.TOTPFactor{}, &model.Session{}); err != nil {
+		t.Fatal(err)
+	}
+	sender := &delivery.RecordingSender{}
+	service := auth.NewAuthenticationService(db, inmemory.NewInMemoryStore(), signing.NewStaticRing(signing.NewSecretKey([]byte("test-secret"))), sender, nil)
+	service.SetMagicLinkCallback(callback)
+
+	app := fiber.New()
+	handler := NewLoginHandler(service)
+	app.Post("/api/v1/auth/magic-link", handler.RequestMagicLink)
+	app.Get("/api/v1/auth/magic-link/callback", handler.MagicLinkCallback)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/magic-link", strings.NewReader(`{"email":"bob@example.com"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("magic link request = %v, %v", resp, err)
+	}
+	msg, _ := sender.Last()
+	link, err := url.Parse(msg.Link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/auth/magic-link/callback?"+link.RawQuery, nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("callback = %v, %v", resp, err)
+	}
+	var body common.BasicResponseData[map[string]string]
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := service.ValidateToken(body.Data["access_token"])
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if !slices.Equal(claims.AMR, []string{schema.MethodMagicLink}) {
+		t.Fatalf("amr = %v, want [%s]", claims.AMR, schema.MethodMagicLink)
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/server/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type MFAService interface {
+	EnrollTOTP(userID uint8) (schema.TOTPEnrollment, error)
+	ConfirmTOTP(userID uint8, code string) (recoveryCodes []string, err error)
+	DisableTOTP(userID uint8, code, recoveryCode string) error
+}
+
+type MFAHandler struct {
+	logger  *zap.Logger
+	service MFAService
+}
+
+func NewMFAHandler(service MFAService) *MFAHandler {
+	return &MFAHandler{
+		logger:  zap.L(),
+		service: service,
+	}
+}
+
+// EnrollTOTP godoc
+//
+//	@Summary		Enroll an authenticator app
+//	@Description	Generates a TOTP secret for the caller and returns it with an otpauth:// provisioning URI to show as a QR code. The app is not required at login until /api/v1/auth/mfa/totp/confirm succeeds; enrolling again before that replaces the secret.
+//	@Tags			MFA
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	schema.TOTPEnrollment
+//	@Failure		401	{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		409	{object}	common.ErrorResponse	"An authenticator app is already enrolled"
+//	@Failure		503	{object}	common.ErrorResponse	"Two-factor authentication is not configured"
+//	@Router			/api/v1/auth/mfa/totp [post]
+func (h *MFAHandler) EnrollTOTP(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	enrollment, err := h.service.EnrollTOTP(principal.UserID)
+	if err != nil {
+		return h.mfaError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[schema.TOTPEnrollment]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Status:     "Ok",
+			Message:    "Scan the provisioning URI and confirm with a code",
+		},
+		Data: enrollment,
+	})
+}
+
+// ConfirmTOTP godoc
+//
+//	@Summary		Confirm an authenticator app
+//	@Description	Checks a code from the app being enrolled and turns on the second factor. From then on, logins of the account need a code from the app. Returns ten one-time recovery codes; they are shown only this once.
+//	@Tags			MFA
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			TOTPCodeRequest	body		schema.TOTPCodeRequest	true	"Code from the authenticator app"
+//	@Success		200				{object}	schema.RecoveryCodes
+//	@Failure		400				{object}	common.ErrorResponse	"Invalid request body"
+//	@Failure		401				{object}	common.ErrorResponse	"Incorrect code or missing access token"
+//	@Failure		404				{object}	common.ErrorResponse	"No enrollment in progress"
+//	@Failure		409				{object}	common.ErrorResponse	"Already confirmed"
+//	@Failure		429				{object}	common.ErrorResponse	"Too many incorrect codes"
+//	@Router			/api/v1/auth/mfa/totp/confirm [post]
+func (h *MFAHandler) ConfirmTOTP(c *fiber.Ctx) error {
+	req := new(schema.TOTPCodeRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil || req.Code == "" {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	codes, err := h.service.ConfirmTOTP(principal.UserID, req.Code)
+	if err != nil {
+		return h.mfaError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[schema.RecoveryCodes]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Status:     "Ok",
+			Message:    "Authenticator app enabled. Store the recovery codes somewhere safe",
+		},
+		Data: schema.RecoveryCodes{RecoveryCodes: codes},
+	})
+}
+
+// DisableTOTP godoc
+//
+//	@Summary		Remove the authenticator app
+//	@Description	Turns off the second factor and deletes the recovery codes. Requires a current code from the app or an unused recovery code.
+//	@Tags			MFA
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			TOTPCodeRequest	body		schema.TOTPCodeRequest	true	"Code from the authenticator app, or a recovery code"
+//	@Success		200				{object}	common.BasicResponse	"Authenticator app removed"
+//	@Failure		400				{object}	common.ErrorResponse	"Invalid request body"
+//	@Failure		401				{object}	common.ErrorResponse	"Incorrect code or missing access token"
+//	@Failure		404				{object}	common.ErrorResponse	"No authenticator app enrolled"
+//	@Failure		429				{object}	common.ErrorResponse	"Too many incorrect codes"
+//	@Router			/api/v1/auth/mfa/totp/disable [post]
+func (h *MFAHandler) DisableTOTP(c *fiber.Ctx) error {
+	req := new(schema.TOTPCodeRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	if err := h.service.DisableTOTP(principal.UserID, req.Code, req.RecoveryCode); err != nil {
+		return h.mfaError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponse{
+		StatusCode: http.StatusOK,
+		Status:     "Ok",
+		Message:    "Authenticator app removed",
+	})
+}
+
+func (h *MFAHandler) mfaError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, common.ErrInvalidMFACode):
+		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: http.StatusUnauthorized,
+			Status:     "error",
+			Message:    "Incorrect code",
+		})
+	case errors.Is(err, common.ErrMFAAttemptsExceeded):
+		return c.Status(http.StatusTooManyRequests).JSON(common.ErrorResponse{
+			StatusCode: http.StatusTooManyRequests,
+			Status:     "error",
+			Message:    "Too many incorrect codes, try again later",
+		})
+	case errors.Is(err, common.ErrMFANotEnrolled):
+		return c.Status(http.StatusNotFound).JSON(common.ErrorResponse{
+			StatusCode: http.StatusNotFound,
+			Status:     "error",
+			Message:    "No authenticator app enrolled",
+		})
+	case errors.Is(err, common.ErrMFAAlreadyEnrolled):
+		return c.Status(http.StatusConflict).JSON(common.ErrorResponse{
+			StatusCode: http.StatusConflict,
+			Status:     "error",
+			Message:    "An authenticator app is already enrolled",
+		})
+	case errors.Is(err, common.ErrMFAUnavailable):
+		return c.Status(http.StatusServiceUnavailable).JSON(common.ErrorResponse{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "error",
+			Message:    "Two-factor authentication is not configured",
+		})
+	default:
+		h.logger.Error("mfa request failed", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type IntrospectionService interface {
+	Introspect(token, tokenTypeHint string) (schema.IntrospectionResponse, error)
+}
+
+type OAuthHandler struct {
+	logger  *zap.Logger
+	service IntrospectionService
+}
+
+func NewOAuthHandler(service IntrospectionService) *OAuthHandler {
+	return &OAuthHandler{
+		logger:  zap.L(),
+		service: service,
+	}
+}
+
+// Introspect godoc
+//
+//	@Summary		Token introspection
+//	@Description	Reports whether an access or refresh token is active (RFC 7662). Callers authenticate with client credentials using HTTP Basic or client_id/client_secret form fields.
+//	@Tags			OAuth
+//	@Accept			x-www-form-urlencoded
+//	@Produce		json
+//	@Security		ClientBasicAuth
+//	@Param			token			formData	string							true	"Token to introspect"
+//	@Param			token_type_hint	formData	string							false	"access_token or refresh_token"
+//	@Success		200				{object}	schema.IntrospectionResponse	"Token status"
+//	@Failure		400				{object}	common.ErrorResponse			"Invalid request body"
+//	@Failure		401				{object}	common.ErrorResponse			"Invalid client credentials"
+//	@Failure		500				{object}	common.ErrorResponse			"Internal server error"
+//	@Router			/api/v1/oauth/introspect [post]
+func (h *OAuthHandler) Introspect(c *fiber.Ctx) error {
+	req := new(schema.IntrospectionRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+
+	resp, err := h.service.Introspect(req.Token, req.TokenTypeHint)
+	if err != nil {
+		h.logger.Error("token introspection failed", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(http.StatusOK).JSON(resp)
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/server/middleware"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type PasskeyService interface {
+	BeginPasskeyRegistration(userID uint8) (*protocol.CredentialCreation, error)
+	FinishPasskeyRegistration(userID uint8, name string, response []byte) (schema.Passkey, error)
+	BeginPasskeyLogin() (*protocol.CredentialAssertion, error)
+	FinishPasskeyLogin(response []byte, client schema.SessionClient) (accessToken, refreshToken string, err error)
+	Passkeys(userID uint8) ([]schema.Passkey, error)
+	DeletePasskey(userID uint8, id uint) error
+}
+
+type PasskeyHandler struct {
+	logger  *zap.Logger
+	service PasskeyService
+}
+
+func NewPasskeyHandler(service PasskeyService) *PasskeyHandler {
+	return &PasskeyHandler{
+		logger:  zap.L(),
+		service: service,
+	}
+}
+
+// BeginRegistration godoc
+//
+//	@Summary		Start registering a passkey
+//	@Description	Returns the options to pass to navigator.credentials.create() in data. The options are valid for 5 minutes and answer to /api/v1/auth/passkeys/register/finish once.
+//	@Tags			Passkeys
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	common.BasicResponse	"Credential creation options in data"
+//	@Failure		401	{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		503	{object}	common.ErrorResponse	"Passkeys are not configured"
+//	@Router			/api/v1/auth/passkeys/register/begin [post]
+func (h *PasskeyHandler) BeginRegistration(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	options, err := h.service.BeginPasskeyRegistration(principal.UserID)
+	if err != nil {
+		return h.passkeyError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[*protocol.CredentialCreation]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Status:     "Ok",
+			Message:    "Create the passkey with these options",
+		},
+		Data: options,
+	})
+}
+
+// FinishRegistration godoc
+//
+//	@Summary		Finish registering a passkey
+//	@Description	Takes the PublicKeyCredential returned by navigator.credentials.create(), serialized to JSON, and stores the passkey under the optional name.
+//	@Tags			Passkeys
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			name	query		string					false	"Name to show in the passkey list"
+//	@Param			body	body		object					true	"PublicKeyCredential from navigator.credentials.create()"
+//	@Success		200		{object}	schema.Passkey
+//	@Failure		400		{object}	common.ErrorResponse	"Invalid or expired registration response"
+//	@Failure		401		{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		503		{object}	common.ErrorResponse	"Passkeys are not configured"
+//	@Router			/api/v1/auth/passkeys/register/finish [post]
+func (h *PasskeyHandler) FinishRegistration(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	passkey, err := h.service.FinishPasskeyRegistration(principal.UserID, c.Query("name"), c.Body())
+	if errors.Is(err, common.ErrInvalidPasskey) {
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "Invalid or expired registration response",
+		})
+	}
+	if err != nil {
+		return h.passkeyError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[schema.Passkey]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Status:     "Ok",
+			Message:    "Passkey registered",
+		},
+		Data: passkey,
+	})
+}
+
+// BeginLogin godoc
+//
+//	@Summary		Start a passkey login
+//	@Description	Returns the options to pass to navigator.credentials.get() in data. No identifier is needed: the user picks one of the passkeys stored for this site. The options are valid for 5 minutes and answer to /api/v1/auth/passkeys/login/finish once.
+//	@Tags			Passkeys
+//	@Produce		json
+//	@Success		200	{object}	common.BasicResponse	"Credential request options in data"
+//	@Failure		503	{object}	common.ErrorResponse	"Passkeys are not configured"
+//	@Router			/api/v1/auth/passkeys/login/begin [post]
+func (h *PasskeyHandler) BeginLogin(c *fiber.Ctx) error {
+	options, err := h.service.BeginPasskeyLogin()
+	if err != nil {
+		return h.passkeyError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[*protocol.CredentialAssertion]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Status:     "Ok",
+			Message:    "Sign the challenge with a passkey",
+		},
+		Data: options,
+	})
+}
+
+// FinishLogin godoc
+//
+//	@Summary		Finish a passkey login
+//	@Description	Takes the PublicKeyCredential returned by navigator.credentials.get(), serialized to JSON, and returns the access and refresh tokens of the account owning the passkey. Passkeys verify the user themselves, so no second factor is asked for. A passkey whose signature counter did not increase may have been cloned and is refused.
+//	@Tags			Passkeys
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		object					true	"PublicKeyCredential from navigator.credentials.get()"
+//	@Success		200		{object}	common.BasicResponse	"Signed in"
+//	@Failure		401		{object}	common.ErrorResponse	"Passkey verification failed"
+//	@Failure		503		{object}	common.ErrorResponse	"Passkeys are not configured"
+//	@Router			/api/v1/auth/passkeys/login/finish [post]
+func (h *PasskeyHandler) FinishLogin(c *fiber.Ctx) error {
+	accessToken, refreshToken, err := h.service.FinishPasskeyLogin(c.Body(), sessionClient(c))
+	if errors.Is(err, common.ErrInvalidPasskey) || errors.Is(err, common.ErrPasskeyCounterReused) {
+		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: http.StatusUnauthorized,
+			Status:     "error",
+			Message:    "Passkey verification failed",
+		})
+	}
+	if err != nil {
+		return h.passkeyError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Message:    "Signed in",
+			Status:     "Ok",
+		},
+		Data: map[string]string{"access_token": accessToken, "refresh_token": refreshToken},
+	})
+}
+
+// ListPasskeys godoc
+//
+//	@Summary		List passkeys
+//	@Description	Lists the passkeys registered for the caller's account.
+//	@Tags			Passkeys
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{array}		schema.Passkey
+//	@Failure		401	{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Router			/api/v1/auth/passkeys [get]
+func (h *PasskeyHandler) ListPasskeys(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	passkeys, err := h.service.Passkeys(principal.UserID)
+	if err != nil {
+		return h.passkeyError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[[]schema.Passkey]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Status:     "Ok",
+		},
+		Data: passkeys,
+	})
+}
+
+// DeletePasskey godoc
+//
+//	@Summary		Delete a passkey
+//	@Description	Removes one of the caller's passkeys. Copies of it on the user's devices no longer sign in.
+//	@Tags			Passkeys
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		int						true	"Passkey ID"
+//	@Success		200	{object}	common.BasicResponse	"Passkey deleted"
+//	@Failure		400	{object}	common.ErrorResponse	"Invalid passkey id"
+//	@Failure		401	{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		404	{object}	common.ErrorResponse	"Passkey not found"
+//	@Router			/api/v1/auth/passkeys/{id} [delete]
+func (h *PasskeyHandler) DeletePasskey(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 0)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	if err := h.service.DeletePasskey(principal.UserID, uint(id)); err != nil {
+		return h.passkeyError(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponse{
+		StatusCode: http.StatusOK,
+		Status:     "Ok",
+		Message:    "Passkey deleted",
+	})
+}
+
+func (h *PasskeyHandler) passkeyError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, common.ErrPasskeyNotFound):
+		return c.Status(http.StatusNotFound).JSON(common.ErrorResponse{
+			StatusCode: http.StatusNotFound,
+			Status:     "error",
+			Message:    "Passkey not found",
+		})
+	case errors.Is(err, common.ErrPasskeyUnavailable):
+		return c.Status(http.StatusServiceUnavailable).JSON(common.ErrorResponse{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "error",
+			Message:    "Passkeys are not configured",
+		})
+	default:
+		h.logger.Error("passkey request failed", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+}
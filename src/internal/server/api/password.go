@@ -0,0 +1,225 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/server/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// PasswordLogin godoc
+//
+//	@Summary		Log in with a password
+//	@Description	Signs in with a phone number or email and the account's password, for accounts that set one. Returns the access and refresh tokens, or an mfa_token for /api/v1/auth/mfa/verify when the account has an authenticator app. After 5 incorrect passwords the identifier is locked for 15 minutes.
+//	@Tags			Password
+//	@Accept			json
+//	@Produce		json
+//	@Param			PasswordLoginRequest	body		schema.PasswordLoginRequest	true	"Identifier and password"
+//	@Success		200						{object}	common.BasicResponse		"Signed in"
+//	@Failure		400						{object}	common.ErrorResponse		"Invalid request body"
+//	@Failure		401						{object}	common.ErrorResponse		"Incorrect identifier or password"
+//	@Failure		429						{object}	common.ErrorResponse		"Too many incorrect passwords"
+//	@Failure		503						{object}	common.ErrorResponse		"Too many password checks in progress, retry later"
+//	@Router			/api/v1/auth/password/login [post]
+func (h *LoginHandler) PasswordLogin(c *fiber.Ctx) error {
+	req := new(schema.PasswordLoginRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	id, ok := req.Identifier()
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+
+	if err := h.service.PasswordLogin(id, req.Password); err != nil {
+		return passwordFailed(c, h.logger, err)
+	}
+	tokens, failure := h.issueTokens(c, id, schema.MethodPassword)
+	if failure != nil {
+		return c.Status(failure.StatusCode).JSON(failure)
+	}
+	message := "Signed in"
+	if _, ok := tokens["mfa_token"]; ok {
+		message = "Second factor required"
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[map[string]string]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Message:    message,
+			Status:     "Ok",
+		},
+		Data: tokens,
+	})
+}
+
+// SetPassword godoc
+//
+//	@Summary		Set a password
+//	@Description	Gives the caller's account its first password. Request an OTP for one of the account's verified identifiers with /api/v1/auth/request first and send it along. The password must meet the password policy.
+//	@Tags			Password
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			PasswordOTPRequest	body		schema.PasswordOTPRequest	true	"Identifier, OTP and new password"
+//	@Success		200					{object}	common.BasicResponse		"Password set"
+//	@Failure		400					{object}	common.ErrorResponse		"Invalid request body, password not accepted, or identifier not on the account"
+//	@Failure		401					{object}	common.ErrorResponse		"Incorrect OTP code or missing access token"
+//	@Failure		404					{object}	common.ErrorResponse		"OTP not found or expired"
+//	@Failure		409					{object}	common.ErrorResponse		"The account already has a password"
+//	@Failure		503					{object}	common.ErrorResponse		"Too many password checks in progress, retry later"
+//	@Router			/api/v1/auth/password [post]
+func (h *LoginHandler) SetPassword(c *fiber.Ctx) error {
+	req := new(schema.PasswordOTPRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	if err := h.service.SetPassword(principal.UserID, *req); err != nil {
+		return passwordFailed(c, h.logger, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponse{
+		StatusCode: http.StatusOK,
+		Status:     "Ok",
+		Message:    "Password set",
+	})
+}
+
+// ChangePassword godoc
+//
+//	@Summary		Change the password
+//	@Description	Replaces the caller's password. Needs the current password and an OTP for one of the account's verified identifiers, requested with /api/v1/auth/request. Every session of the account is signed out.
+//	@Tags			Password
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			ChangePasswordRequest	body		schema.ChangePasswordRequest	true	"Identifier, OTP, current and new password"
+//	@Success		200						{object}	common.BasicResponse			"Password changed"
+//	@Failure		400						{object}	common.ErrorResponse			"Invalid request body, password not accepted, no password set, or identifier not on the account"
+//	@Failure		401						{object}	common.ErrorResponse			"Incorrect current password or OTP code, or missing access token"
+//	@Failure		404						{object}	common.ErrorResponse			"OTP not found or expired"
+//	@Failure		429						{object}	common.ErrorResponse			"Too many incorrect passwords"
+//	@Failure		503						{object}	common.ErrorResponse			"Too many password checks in progress, retry later"
+//	@Router			/api/v1/auth/password/change [post]
+func (h *LoginHandler) ChangePassword(c *fiber.Ctx) error {
+	req := new(schema.ChangePasswordRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	if err := h.service.ChangePassword(principal.UserID, *req); err != nil {
+		return passwordFailed(c, h.logger, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponse{
+		StatusCode: http.StatusOK,
+		Status:     "Ok",
+		Message:    "Password changed, log in again",
+	})
+}
+
+// ResetPassword godoc
+//
+//	@Summary		Reset a forgotten password
+//	@Description	Sets a new password for the account of the given phone number or email, proven with an OTP requested with /api/v1/auth/request. Every session of the account is signed out.
+//	@Tags			Password
+//	@Accept			json
+//	@Produce		json
+//	@Param			PasswordOTPRequest	body		schema.PasswordOTPRequest	true	"Identifier, OTP and new password"
+//	@Success		200					{object}	common.BasicResponse		"Password reset"
+//	@Failure		400					{object}	common.ErrorResponse		"Invalid request body or password not accepted"
+//	@Failure		401					{object}	common.ErrorResponse		"Incorrect OTP code or unknown account"
+//	@Failure		404					{object}	common.ErrorResponse		"OTP not found or expired"
+//	@Failure		503					{object}	common.ErrorResponse		"Too many password checks in progress, retry later"
+//	@Router			/api/v1/auth/password/reset [post]
+func (h *LoginHandler) ResetPassword(c *fiber.Ctx) error {
+	req := new(schema.PasswordOTPRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+
+	if err := h.service.ResetPassword(*req); err != nil {
+		return passwordFailed(c, h.logger, err)
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponse{
+		StatusCode: http.StatusOK,
+		Status:     "Ok",
+		Message:    "Password reset, log in with the new password",
+	})
+}
+
+// passwordFailed answers a password request that failed with err.
+func passwordFailed(c *fiber.Ctx, logger *zap.Logger, err error) error {
+	var retry *common.RetryAfterError
+	switch {
+	case errors.As(err, &retry):
+		seconds := int64((retry.RetryAfter + time.Second - 1) / time.Second)
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(seconds, 10))
+		return c.Status(http.StatusTooManyRequests).JSON(common.ErrorResponse{
+			StatusCode: http.StatusTooManyRequests,
+			Status:     "error",
+			Message:    fmt.Sprintf("Too many incorrect passwords. Please try again after %d minutes.", (seconds+59)/60),
+		})
+	case errors.Is(err, common.ErrPasswordBusy):
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return c.Status(http.StatusServiceUnavailable).JSON(common.ErrorResponse{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "error",
+			Message:    "Too many password checks in progress. Please try again shortly.",
+		})
+	case errors.Is(err, common.ErrInvalidCredentials):
+		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: http.StatusUnauthorized,
+			Status:     "error",
+			Message:    "Incorrect identifier or password",
+		})
+	case errors.Is(err, common.ErrWeakPassword):
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    err.Error(),
+		})
+	case errors.Is(err, common.ErrPasswordAlreadySet):
+		return c.Status(http.StatusConflict).JSON(common.ErrorResponse{
+			StatusCode: http.StatusConflict,
+			Status:     "error",
+			Message:    "The account already has a password, change it instead",
+		})
+	case errors.Is(err, common.ErrPasswordNotSet):
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "The account has no password, set one instead",
+		})
+	case errors.Is(err, common.ErrIdentifierNotOwned), errors.Is(err, common.ErrInvalidIdentifier):
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "The OTP must be sent to a verified phone number or email of the account",
+		})
+	case errors.Is(err, common.ErrGetOTP), errors.Is(err, common.ErrCompareOTP),
+		errors.Is(err, common.ErrOTPAttemptsExceeded), errors.Is(err, common.ErrInvalidOTP):
+		return otpVerifyFailed(c, err)
+	default:
+		logger.Error("password request failed", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+}
@@ -0,0 +1,40 @@
+package schema
+
+import "time"
+
+// ProviderStats reports how an OTP provider has been performing.
+type ProviderStats struct {
+	Name          string     `json:"name"`
+	Sent          uint64     `json:"sent"`
+	Failed        uint64     `json:"failed"`
+	SuccessRate   float64    `json:"success_rate"`
+	LatencyMS     float64    `json:"latency_ms"`
+	Degraded      bool       `json:"degraded"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+}
+
+// DeliveryReceipt is the body SMS providers POST to the receipts webhook.
+type DeliveryReceipt struct {
+	// Reference is the request_id goAuth sent the message with.
+	Reference string `json:"reference"`
+	MessageID string `json:"message_id,omitempty"`
+	// Status is "sent", "delivered" or "failed".
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DeliveryMessage is the delivery history of one OTP request.
+type DeliveryMessage struct {
+	RequestID         string     `json:"request_id"`
+	Recipient         string     `json:"recipient"`
+	Channel           string     `json:"channel,omitempty"`
+	Status            string     `json:"status"`
+	Provider          string     `json:"provider,omitempty"`
+	ProviderMessageID string     `json:"provider_message_id,omitempty"`
+	Error             string     `json:"error,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	SentAt            *time.Time `json:"sent_at,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
+	FailedAt          *time.Time `json:"failed_at,omitempty"`
+}
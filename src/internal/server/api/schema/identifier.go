@@ -0,0 +1,52 @@
+package schema
+
+import (
+	"strings"
+
+	"goAuth/internal/utils/phonenumber"
+)
+
+// Identifier types a user can sign in with.
+const (
+	IdentifierPhone = "phone"
+	IdentifierEmail = "email"
+)
+
+// Identifier is a phone number or an email address naming an account.
+type Identifier struct {
+	Type  string
+	Value string
+}
+
+// PhoneIdentifier returns the identifier of phoneNumber in E.164 form,
+// reading national numbers in the default region. A number that does not
+// parse is kept as given and names no account.
+func PhoneIdentifier(phoneNumber string) Identifier {
+	if normalized, err := phonenumber.Normalize(phoneNumber); err == nil {
+		phoneNumber = normalized
+	}
+	return Identifier{Type: IdentifierPhone, Value: phoneNumber}
+}
+
+// EmailIdentifier returns the identifier of email, lower-cased so addresses
+// differing only in case name the same account.
+func EmailIdentifier(email string) Identifier {
+	return Identifier{Type: IdentifierEmail, Value: strings.ToLower(strings.TrimSpace(email))}
+}
+
+// identifierFields picks the identifier of a request carrying an optional
+// identifier_type, a phone number and an email address. Without a type, the
+// field that is set decides. ok is false when the chosen field is empty or
+// not a phone number.
+func identifierFields(identifierType, phoneNumber, email string) (id Identifier, ok bool) {
+	switch {
+	case identifierType == IdentifierEmail, identifierType == "" && phoneNumber == "":
+		id = EmailIdentifier(email)
+	default:
+		if _, err := phonenumber.Normalize(phoneNumber); err != nil {
+			return Identifier{Type: IdentifierPhone}, false
+		}
+		id = PhoneIdentifier(phoneNumber)
+	}
+	return id, id.Value != ""
+}
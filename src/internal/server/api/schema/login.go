@@ -1,16 +1,91 @@
 package schema
 
-import "github.com/go-playground/validator/v10"
+import (
+	"goAuth/internal/common"
+	"goAuth/internal/utils/phonenumber"
+
+	"github.com/go-playground/validator/v10"
+)
 
 type OTPRequest struct {
-	PhoneNumber string `json:"phone_number" validate:"required,regex=^09[0-9]{9}$"`
+	// IdentifierType is "phone" or "email". Empty picks whichever of
+	// phone_number and email is set.
+	IdentifierType string `json:"identifier_type,omitempty" validate:"omitempty,oneof=phone email"`
+	// PhoneNumber is an international number, or a national number of
+	// PHONE_DEFAULT_REGION.
+	PhoneNumber string `json:"phone_number,omitempty" validate:"omitempty,max=32,phone"`
+	Email       string `json:"email,omitempty" validate:"omitempty,email,max=254"`
+	// Locale selects the message language, e.g. "fa". Defaults to the
+	// Accept-Language header.
+	Locale string `json:"locale,omitempty" validate:"omitempty,max=35"`
+	// Channel is how the code is delivered. Empty picks SMS, falling back to
+	// the next channel when the previous code did not arrive.
+	Channel string `json:"channel,omitempty" validate:"omitempty,oneof=sms voice messaging-app email"`
+	// ClientID is the authenticated client whose OTP policy applies; empty
+	// uses the server's policy. Handlers set it from the client's
+	// credentials, never from the body.
+	ClientID string `json:"-"`
+}
+
+// Identifier returns the identifier the OTP is requested for.
+func (r OTPRequest) Identifier() (Identifier, bool) {
+	return identifierFields(r.IdentifierType, r.PhoneNumber, r.Email)
 }
 
 type LoginRequest struct {
-	PhoneNumber string `json:"phone_number" validate:"required,regex=^09[0-9]{9}$"`
-	OTPCode     string `json:"otp" validate:"required,numeric"`
+	IdentifierType string `json:"identifier_type,omitempty" validate:"omitempty,oneof=phone email"`
+	PhoneNumber    string `json:"phone_number,omitempty" validate:"omitempty,max=32,phone"`
+	Email          string `json:"email,omitempty" validate:"omitempty,email,max=254"`
+	OTPCode        string `json:"otp" validate:"required,alphanum,max=12"`
+}
+
+// Identifier returns the identifier the OTP was requested for.
+func (r LoginRequest) Identifier() (Identifier, bool) {
+	return identifierFields(r.IdentifierType, r.PhoneNumber, r.Email)
+}
+
+// EmailLinkRequest asks for a code proving ownership of Email before it is
+// added to the caller's account.
+type EmailLinkRequest struct {
+	Email  string `json:"email" validate:"required,email,max=254"`
+	Locale string `json:"locale,omitempty" validate:"omitempty,max=35"`
+}
+
+// EmailVerifyRequest links Email to the caller's account with the code sent
+// to it.
+type EmailVerifyRequest struct {
+	Email   string `json:"email" validate:"required,email,max=254"`
+	OTPCode string `json:"otp" validate:"required,alphanum,max=12"`
 }
 
+// MagicLinkRequest asks for a sign-in link to be emailed to Email. With a
+// RedirectURI registered for ClientID, following the link redirects there
+// with the tokens instead of answering with them.
+type MagicLinkRequest struct {
+	Email       string `json:"email" validate:"required,email,max=254"`
+	Locale      string `json:"locale,omitempty" validate:"omitempty,max=35"`
+	ClientID    string `json:"client_id,omitempty" validate:"omitempty,max=64"`
+	RedirectURI string `json:"redirect_uri,omitempty" validate:"omitempty,url,max=2048"`
+	// ClientAuthenticated is set by handlers when the request carried
+	// ClientID's credentials. Only then does the client's OTP policy apply.
+	ClientAuthenticated bool `json:"-"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// PhoneNumberValidator accepts international numbers and national numbers
+// of the default region.
 func PhoneNumberValidator(fl validator.FieldLevel) bool {
-	return fl.Field().String() != "invalid"
+	_, err := phonenumber.Normalize(fl.Field().String())
+	return err == nil
+}
+
+func init() {
+	common.Validate.RegisterValidation("phone", PhoneNumberValidator)
 }
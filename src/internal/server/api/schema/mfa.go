@@ -0,0 +1,29 @@
+package schema
+
+// TOTPEnrollment is what an authenticator app needs to start producing
+// codes. ProvisioningURI is usually shown as a QR code; Secret is for typing
+// in by hand.
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TOTPCodeRequest carries a code from the authenticator app, or for
+// disabling the factor, a recovery code.
+type TOTPCodeRequest struct {
+	Code         string `json:"code,omitempty" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"omitempty,max=32"`
+}
+
+// RecoveryCodes are shown once, when the authenticator app is confirmed.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAVerifyRequest completes a login that returned an mfa_token, with either
+// a code from the authenticator app or a recovery code.
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required,max=64"`
+	Code         string `json:"code,omitempty" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"omitempty,max=32"`
+}
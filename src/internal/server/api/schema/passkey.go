@@ -0,0 +1,13 @@
+package schema
+
+import "time"
+
+// Passkey describes a registered passkey, without its key material.
+// Synced passkeys are backed up by the platform, e.g. to a cloud keychain.
+type Passkey struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Synced     bool       `json:"synced"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
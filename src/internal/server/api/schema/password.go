@@ -0,0 +1,37 @@
+package schema
+
+// PasswordLoginRequest signs in with a phone number or email and the
+// account's password.
+type PasswordLoginRequest struct {
+	IdentifierType string `json:"identifier_type,omitempty" validate:"omitempty,oneof=phone email"`
+	PhoneNumber    string `json:"phone_number,omitempty" validate:"omitempty,max=32,phone"`
+	Email          string `json:"email,omitempty" validate:"omitempty,email,max=254"`
+	Password       string `json:"password" validate:"required,max=1024"`
+}
+
+// Identifier returns the identifier of the account signing in.
+func (r PasswordLoginRequest) Identifier() (Identifier, bool) {
+	return identifierFields(r.IdentifierType, r.PhoneNumber, r.Email)
+}
+
+// PasswordOTPRequest sets a new password after proving ownership of the
+// phone number or email with an OTP sent by /api/v1/auth/request.
+type PasswordOTPRequest struct {
+	IdentifierType string `json:"identifier_type,omitempty" validate:"omitempty,oneof=phone email"`
+	PhoneNumber    string `json:"phone_number,omitempty" validate:"omitempty,max=32,phone"`
+	Email          string `json:"email,omitempty" validate:"omitempty,email,max=254"`
+	OTPCode        string `json:"otp" validate:"required,alphanum,max=12"`
+	Password       string `json:"password" validate:"required,max=1024"`
+}
+
+// Identifier returns the identifier the OTP was requested for.
+func (r PasswordOTPRequest) Identifier() (Identifier, bool) {
+	return identifierFields(r.IdentifierType, r.PhoneNumber, r.Email)
+}
+
+// ChangePasswordRequest replaces the current password, which must be given
+// along with an OTP.
+type ChangePasswordRequest struct {
+	PasswordOTPRequest
+	CurrentPassword string `json:"current_password" validate:"required,max=1024"`
+}
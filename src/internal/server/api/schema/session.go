@@ -0,0 +1,23 @@
+package schema
+
+import "time"
+
+// Session describes an active login of a user. Current marks the session
+// of the access token the request was made with.
+type Session struct {
+	ID         uint      `json:"id"`
+	DeviceName string    `json:"device_name,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// SessionClient describes the device a login or refresh comes from.
+// DeviceName is chosen by the client app, e.g. "Sara's iPhone".
+type SessionClient struct {
+	DeviceName string
+	UserAgent  string
+	IP         string
+}
@@ -0,0 +1,43 @@
+package schema
+
+// Authentication methods recorded in the amr claim of access tokens, as
+// named by RFC 8176.
+const (
+	// MethodOTP is a one-time code: an OTP or an authenticator app code.
+	MethodOTP = "otp"
+	// MethodMagicLink is a magic link sent by email. RFC 8176 has no value
+	// for it.
+	MethodMagicLink = "link"
+	// MethodPassword is the account's password.
+	MethodPassword = "pwd"
+	// MethodHardwareKey is a passkey bound to its device.
+	MethodHardwareKey = "hwk"
+	// MethodSoftwareKey is a passkey synced between devices.
+	MethodSoftwareKey = "swk"
+	// MethodMFA marks a login that used more than one factor.
+	MethodMFA = "mfa"
+)
+
+// StepUpRequest re-authenticates the caller with either a code from the
+// authenticator app, or an OTP sent by /api/v1/auth/request to one of the
+// account's verified phone numbers or emails.
+type StepUpRequest struct {
+	Code           string `json:"code,omitempty" validate:"required_without=OTPCode,omitempty,numeric,len=6"`
+	IdentifierType string `json:"identifier_type,omitempty" validate:"omitempty,oneof=phone email"`
+	PhoneNumber    string `json:"phone_number,omitempty" validate:"omitempty,max=32,phone"`
+	Email          string `json:"email,omitempty" validate:"omitempty,email,max=254"`
+	OTPCode        string `json:"otp,omitempty" validate:"omitempty,alphanum,max=12"`
+}
+
+// Identifier returns the identifier the OTP was requested for.
+func (r StepUpRequest) Identifier() (Identifier, bool) {
+	return identifierFields(r.IdentifierType, r.PhoneNumber, r.Email)
+}
+
+// StepUpToken is a short-lived access token for operations that need a
+// recent authentication. It comes without a refresh token.
+type StepUpToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
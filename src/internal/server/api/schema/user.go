@@ -5,8 +5,12 @@ import (
 )
 
 type User struct {
-	ID          uint8  `json:"id"`
-	PhoneNumber string `json:"phone_number"`
+	ID            uint8  `json:"id"`
+	PhoneNumber   string `json:"phone_number,omitempty"`
+	PhoneVerified bool   `json:"phone_verified"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+	HasPassword   bool   `json:"has_password"`
 }
 
 // UserList uses the new generic pagination
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/server/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// HeaderDeviceName names the device a login comes from, as chosen by the
+// client app. It is shown in the session list.
+const HeaderDeviceName = "X-Device-Name"
+
+type SessionService interface {
+	Sessions(userID uint8) ([]schema.Session, error)
+	RevokeSession(userID uint8, sessionID uint) error
+}
+
+type SessionHandler struct {
+	logger  *zap.Logger
+	service SessionService
+}
+
+func NewSessionHandler(service SessionService) *SessionHandler {
+	return &SessionHandler{
+		logger:  zap.L(),
+		service: service,
+	}
+}
+
+// ListSessions godoc
+//
+//	@Summary		List my sessions
+//	@Description	Lists the caller's active logins, most recently used first, with the device name sent in the X-Device-Name header at login, the user agent and the IP address last seen. The session of the access token used has current set.
+//	@Tags			Sessions
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{array}		schema.Session
+//	@Failure		401	{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Router			/api/v1/me/sessions [get]
+func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+	return h.listSessions(c, principal.UserID, principal.Claims.SessionID)
+}
+
+// RevokeSession godoc
+//
+//	@Summary		Sign out a session
+//	@Description	Ends one of the caller's sessions, e.g. on a lost device. Its refresh token stops working and its access tokens are revoked.
+//	@Tags			Sessions
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		int						true	"Session ID"
+//	@Success		200	{object}	common.BasicResponse	"Session signed out"
+//	@Failure		400	{object}	common.ErrorResponse	"Invalid session id"
+//	@Failure		401	{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		404	{object}	common.ErrorResponse	"Session not found"
+//	@Router			/api/v1/me/sessions/{id} [delete]
+func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
+	sessionID, err := strconv.ParseUint(c.Params("id"), 10, 0)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+	return h.revokeSession(c, principal.UserID, uint(sessionID))
+}
+
+// ListUserSessions godoc
+//
+//	@Summary		List a user's sessions (admin only)
+//	@Description	Lists the active logins of the user with the given id. Requires the admin role.
+//	@Tags			Sessions
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		int						true	"User ID"
+//	@Success		200	{array}		schema.Session
+//	@Failure		400	{object}	common.ErrorResponse	"Invalid user id"
+//	@Failure		401	{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		403	{object}	common.ErrorResponse	"Caller is not an admin"
+//	@Router			/api/v1/users/{id}/sessions [get]
+func (h *SessionHandler) ListUserSessions(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 8)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+	return h.listSessions(c, uint8(userID), principal.Claims.SessionID)
+}
+
+// RevokeUserSession godoc
+//
+//	@Summary		Sign out a user's session (admin only)
+//	@Description	Ends a session of the user with the given id. Requires the admin role.
+//	@Tags			Sessions
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id			path		int						true	"User ID"
+//	@Param			sessionID	path		int						true	"Session ID"
+//	@Success		200			{object}	common.BasicResponse	"Session signed out"
+//	@Failure		400			{object}	common.ErrorResponse	"Invalid user or session id"
+//	@Failure		401			{object}	common.ErrorResponse	"Missing, invalid or revoked access token"
+//	@Failure		403			{object}	common.ErrorResponse	"Caller is not an admin"
+//	@Failure		404			{object}	common.ErrorResponse	"Session not found"
+//	@Router			/api/v1/users/{id}/sessions/{sessionID} [delete]
+func (h *SessionHandler) RevokeUserSession(c *fiber.Ctx) error {
+	userID, errUser := strconv.ParseUint(c.Params("id"), 10, 8)
+	sessionID, errSession := strconv.ParseUint(c.Params("sessionID"), 10, 0)
+	if errUser != nil || errSession != nil {
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	return h.revokeSession(c, uint8(userID), uint(sessionID))
+}
+
+func (h *SessionHandler) listSessions(c *fiber.Ctx, userID uint8, currentSessionID string) error {
+	sessions, err := h.service.Sessions(userID)
+	if err != nil {
+		h.logger.Error("failed to list sessions", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+	for i := range sessions {
+		sessions[i].Current = strconv.FormatUint(uint64(sessions[i].ID), 10) == currentSessionID
+	}
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[[]schema.Session]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Status:     "Ok",
+		},
+		Data: sessions,
+	})
+}
+
+func (h *SessionHandler) revokeSession(c *fiber.Ctx, userID uint8, sessionID uint) error {
+	err := h.service.RevokeSession(userID, sessionID)
+	switch {
+	case err == nil:
+		return c.Status(http.StatusOK).JSON(common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Status:     "Ok",
+			Message:    "Session signed out",
+		})
+	case errors.Is(err, common.ErrSessionNotFound):
+		return c.Status(http.StatusNotFound).JSON(common.ErrorResponse{
+			StatusCode: http.StatusNotFound,
+			Status:     "error",
+			Message:    "Session not found",
+		})
+	default:
+		h.logger.Error("failed to revoke session", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+}
+
+// sessionClient describes the device making request c.
+func sessionClient(c *fiber.Ctx) schema.SessionClient {
+	return schema.SessionClient{
+		DeviceName: c.Get(HeaderDeviceName),
+		UserAgent:  c.Get(fiber.HeaderUserAgent),
+		IP:         c.IP(),
+	}
+}
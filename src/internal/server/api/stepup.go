@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/server/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// StepUp godoc
+//
+//	@Summary		Re-authenticate for a sensitive operation
+//	@Description	Proves the caller's identity again and returns a short-lived access token, without a refresh token, whose auth_time is now. Operations that need a recent authentication answer 401 with error="insufficient_user_authentication" in WWW-Authenticate until called with such a token. Accounts with an authenticator app send its code; others send an OTP requested with /api/v1/auth/request for one of the account's verified phone numbers or emails.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			StepUpRequest	body		schema.StepUpRequest	true	"Authenticator code, or identifier and OTP"
+//	@Success		200				{object}	common.BasicResponse	"Step-up access token"
+//	@Failure		400				{object}	common.ErrorResponse	"Invalid request body, wrong kind of code, or identifier not on the account"
+//	@Failure		401				{object}	common.ErrorResponse	"Missing or invalid access token, or incorrect code"
+//	@Failure		404				{object}	common.ErrorResponse	"OTP not found or expired"
+//	@Failure		429				{object}	common.ErrorResponse	"Too many incorrect codes"
+//	@Router			/api/v1/auth/step-up [post]
+func (h *LoginHandler) StepUp(c *fiber.Ctx) error {
+	req := new(schema.StepUpRequest)
+	if errParse, errValidate := c.BodyParser(req), common.Validate.Struct(req); errParse != nil || errValidate != nil {
+		h.logger.Debug("req body is not valid", zap.Error(errors.Join(errParse, errValidate)))
+		return c.Status(http.StatusBadRequest).JSON(common.BadParamsErrorResponse)
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	}
+
+	token, err := h.service.StepUp(principal.Token, *req)
+	switch {
+	case err == nil:
+	case errors.Is(err, common.ErrInvalidToken), errors.Is(err, common.ErrTokenRevoked):
+		return c.Status(http.StatusUnauthorized).JSON(common.UnauthorizedErrorResponse)
+	case errors.Is(err, common.ErrMFARequired):
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "The account has an authenticator app, send its code",
+		})
+	case errors.Is(err, common.ErrMFANotEnrolled):
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "The account has no authenticator app, send an OTP instead",
+		})
+	case errors.Is(err, common.ErrInvalidMFACode):
+		return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+			StatusCode: http.StatusUnauthorized,
+			Status:     "error",
+			Message:    "Incorrect authenticator code",
+		})
+	case errors.Is(err, common.ErrMFAAttemptsExceeded):
+		return c.Status(http.StatusTooManyRequests).JSON(common.ErrorResponse{
+			StatusCode: http.StatusTooManyRequests,
+			Status:     "error",
+			Message:    "Too many incorrect codes, try again later",
+		})
+	case errors.Is(err, common.ErrIdentifierNotOwned), errors.Is(err, common.ErrInvalidIdentifier):
+		return c.Status(http.StatusBadRequest).JSON(common.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     "error",
+			Message:    "The OTP must be sent to a verified phone number or email of the account",
+		})
+	case errors.Is(err, common.ErrGetOTP), errors.Is(err, common.ErrCompareOTP),
+		errors.Is(err, common.ErrOTPAttemptsExceeded), errors.Is(err, common.ErrInvalidOTP):
+		return otpVerifyFailed(c, err)
+	default:
+		h.logger.Error("step-up failed", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(http.StatusOK).JSON(common.BasicResponseData[schema.StepUpToken]{
+		BasicResponse: common.BasicResponse{
+			StatusCode: http.StatusOK,
+			Status:     "Ok",
+			Message:    "Authenticated again",
+		},
+		Data: token,
+	})
+}
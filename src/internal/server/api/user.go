@@ -1,8 +1,11 @@
 package api
 
 import (
+	"goAuth/internal/database/model"
 	"goAuth/internal/server/api/schema"
+	"goAuth/internal/server/middleware"
 	"goAuth/internal/utils/pagination"
+	"goAuth/internal/utils/phonenumber"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,7 +14,7 @@ import (
 
 type UserService interface {
 	GetUser(id uint8) *schema.User
-	GetUsers(page, pageSize int, baseURL string, phoneNumber *string) *schema.UserList
+	GetUsers(page, pageSize int, baseURL string, phoneNumber, email *string) *schema.UserList
 }
 
 type UserHandler struct {
@@ -29,13 +32,16 @@ func NewUserHandler(service UserService) *UserHandler {
 // GetUser godoc
 //
 //	@Summary		Get user by ID
-//	@Description	Retrieves a user by their unique ID.
+//	@Description	Retrieves a user by their unique ID. Users may only read themselves unless they hold the admin role.
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
+//	@Security		BearerAuth
 //	@Param			id	path		int			true	"User ID"
 //	@Success		200	{object}	schema.User	"returns the user details including the id and phone number"
 //	@Failure		400	{object}	common.ErrorResponse
+//	@Failure		401	{object}	common.ErrorResponse
+//	@Failure		403	{object}	common.ErrorResponse
 //	@Failure		404	{object}	common.ErrorResponse
 //	@Router			/api/v1/users/{id} [get]
 func (h *UserHandler) GetUser(c *fiber.Ctx) error {
@@ -53,6 +59,11 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 			"message": "invalid user id",
 		})
 	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok || (principal.UserID != uint8(idUint) && !principal.HasRole(model.RoleAdmin)) {
+		return middleware.Forbidden(c, "not allowed to read this user")
+	}
+
 	user := h.service.GetUser(uint8(idUint))
 	if user == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -67,28 +78,39 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 // GetUsers godoc
 //
 //	@Summary		List users
-//	@Description	Retrieves a paginated list of users, with optional phone number search.
+//	@Description	Retrieves a paginated list of users, with optional phone number and email search. Requires the admin role.
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
-//	@Param			page			query	int		false	"Page number"				default(1)
-//	@Param			page_size		query	int		false	"Number of users per page"	default(10)
-//	@Param			phone_number	query	string	false	"Filter by phone number"
-//	@Success		200				{array}	schema.User
+//	@Security		BearerAuth
+//	@Param			page			query		int		false	"Page number"				default(1)
+//	@Param			page_size		query		int		false	"Number of users per page"	default(10)
+//	@Param			phone_number	query		string	false	"Filter by phone number; full numbers may be in any format"
+//	@Param			email			query		string	false	"Filter by email address"
+//	@Success		200				{array}		schema.User
+//	@Failure		401				{object}	common.ErrorResponse
+//	@Failure		403				{object}	common.ErrorResponse
 //	@Router			/api/v1/users [get]
 func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
-	var phoneNumber *string
+	var phoneNumber, email *string
 	// Parse pagination parameters from query
 	params := pagination.ParsePaginationFromQuery(c)
 	phoneNumberQuery := c.Query("phone_number")
 	if phoneNumberQuery != "" {
+		// Full numbers are searched in their stored E.164 form.
+		if normalized, err := phonenumber.Normalize(phoneNumberQuery); err == nil {
+			phoneNumberQuery = normalized
+		}
 		phoneNumber = &phoneNumberQuery
 	}
+	if emailQuery := c.Query("email"); emailQuery != "" {
+		email = &emailQuery
+	}
 
 	baseURL := pagination.GetBaseURL(c)
 
 	// Get paginated users
-	users := h.service.GetUsers(params.Page, params.PageSize, baseURL, phoneNumber)
+	users := h.service.GetUsers(params.Page, params.PageSize, baseURL, phoneNumber, email)
 	if users == nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/service/auth"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PrincipalKey is the fiber.Ctx.Locals key holding the authenticated *Principal.
+const PrincipalKey = "principal"
+
+// TokenValidator validates access tokens, including their revocation status.
+type TokenValidator interface {
+	ValidateToken(accessToken string) (*auth.Claims, error)
+}
+
+// RoleStore looks up the roles a user holds now.
+type RoleStore interface {
+	Roles(userID uint8) ([]string, error)
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID  uint8
+	Roles   []string
+	Tenant  string
+	TokenID string
+	Token   string
+	Claims  *auth.Claims
+}
+
+// HasRole reports whether the principal holds role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// Config configures the authentication middleware.
+type Config struct {
+	Validator TokenValidator
+
+	// RoleStore, when set, supplies the principal's roles, so role checks
+	// neither depend on JWT_CUSTOM_CLAIMS nor trust roles revoked since the
+	// token was issued. Without it the roles claim is used.
+	RoleStore RoleStore
+
+	// Roles, when set, requires the principal to hold at least one of them.
+	Roles []string
+
+	// MaxAuthAge, when set, requires the user to have authenticated no longer
+	// ago, per the auth_time claim.
+	MaxAuthAge time.Duration
+	// AuthMethods, when set, requires the amr claim to hold at least one of
+	// them.
+	AuthMethods []string
+}
+
+// New returns a middleware that requires a valid bearer access token and
+// stores the caller's Principal in the request locals. Missing or invalid
+// tokens get a 401, tokens lacking the configured roles a 403. Tokens from an
+// authentication too old or of the wrong methods get a 401 asking for a
+// step-up.
+func New(config Config) fiber.Handler {
+	if config.Validator == nil {
+		panic("middleware: Config.Validator is required")
+	}
+
+	return func(c *fiber.Ctx) error {
+		token, ok := BearerToken(c)
+		if !ok {
+			return unauthorized(c, "missing bearer access token")
+		}
+
+		claims, err := config.Validator.ValidateToken(token)
+		switch {
+		case errors.Is(err, common.ErrTokenRevoked):
+			return unauthorized(c, "access token revoked")
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return unauthorized(c, "access token expired")
+		case err != nil:
+			return unauthorized(c, "invalid access token")
+		}
+
+		userID, err := claims.UserID()
+		if err != nil {
+			return unauthorized(c, "invalid access token subject")
+		}
+
+		roles := claims.Roles
+		if config.RoleStore != nil {
+			if roles, err = config.RoleStore.Roles(userID); err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(common.InternalServerErrorResponse)
+			}
+		}
+
+		principal := &Principal{
+			UserID:  userID,
+			Roles:   roles,
+			Tenant:  claims.Tenant,
+			TokenID: claims.ID,
+			Token:   token,
+			Claims:  claims,
+		}
+		c.Locals(PrincipalKey, principal)
+
+		if len(config.Roles) > 0 && !slices.ContainsFunc(config.Roles, principal.HasRole) {
+			return Forbidden(c, "insufficient role")
+		}
+		if !authenticatedEnough(claims, config.MaxAuthAge, config.AuthMethods) {
+			return insufficientAuthentication(c, config.MaxAuthAge)
+		}
+		return c.Next()
+	}
+}
+
+// RequireFreshAuth returns a middleware, mounted after New, that answers 401
+// with error="insufficient_user_authentication" (RFC 9470) unless the user
+// authenticated within maxAge and, when methods are given, with at least one
+// of them. A zero maxAge checks the methods only. Clients re-authenticate
+// with /api/v1/auth/step-up and retry.
+func RequireFreshAuth(maxAge time.Duration, methods ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := PrincipalFrom(c)
+		if !ok {
+			return unauthorized(c, "missing bearer access token")
+		}
+		if !authenticatedEnough(principal.Claims, maxAge, methods) {
+			return insufficientAuthentication(c, maxAge)
+		}
+		return c.Next()
+	}
+}
+
+// RequireRoles returns a middleware, mounted after New, that answers 403
+// unless the principal holds at least one of roles.
+func RequireRoles(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := PrincipalFrom(c)
+		if !ok {
+			return unauthorized(c, "missing bearer access token")
+		}
+		if !slices.ContainsFunc(roles, principal.HasRole) {
+			return Forbidden(c, "insufficient role")
+		}
+		return c.Next()
+	}
+}
+
+// PrincipalFrom returns the principal stored by New.
+func PrincipalFrom(c *fiber.Ctx) (*Principal, bool) {
+	principal, ok := c.Locals(PrincipalKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func BearerToken(c *fiber.Ctx) (string, bool) {
+	scheme, token, found := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// Forbidden answers 403 with the common error envelope.
+func Forbidden(c *fiber.Ctx, message string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="insufficient_scope", error_description=%q`, message))
+	return c.Status(http.StatusForbidden).JSON(common.ErrorResponse{
+		StatusCode: http.StatusForbidden,
+		Status:     "error",
+		Message:    message,
+	})
+}
+
+func authenticatedEnough(claims *auth.Claims, maxAge time.Duration, methods []string) bool {
+	if maxAge > 0 && !claims.AuthenticatedWithin(maxAge) {
+		return false
+	}
+	return len(methods) == 0 || slices.ContainsFunc(methods, claims.HasMethod)
+}
+
+func insufficientAuthentication(c *fiber.Ctx, maxAge time.Duration) error {
+	const message = "a more recent or stronger authentication is required"
+	challenge := fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description=%q`, message)
+	if maxAge > 0 {
+		challenge += fmt.Sprintf(", max_age=%d", int64(maxAge/time.Second))
+	}
+	c.Set(fiber.HeaderWWWAuthenticate, challenge)
+	return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+		StatusCode:  http.StatusUnauthorized,
+		Status:      "error",
+		Message:     message,
+		NeedRetry:   true,
+		RetryReason: "step_up_required",
+	})
+}
+
+func unauthorized(c *fiber.Ctx, message string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, message))
+	return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+		StatusCode: http.StatusUnauthorized,
+		Status:     "error",
+		Message:    message,
+	})
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientKey is the fiber.Ctx.Locals key holding the authenticated *model.Client.
+const ClientKey = "client"
+
+// ClientAuthenticator checks client credentials.
+type ClientAuthenticator interface {
+	Authenticate(clientID, secret string) (*model.Client, error)
+}
+
+// ClientAuth returns a middleware that requires client credentials, either as
+// HTTP Basic (client_secret_basic) or as client_id and client_secret form
+// fields (client_secret_post), and stores the client in the request locals.
+func ClientAuth(authenticator ClientAuthenticator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		clientID, secret, ok := clientCredentials(c)
+		if !ok {
+			return invalidClient(c)
+		}
+		client, err := authenticator.Authenticate(clientID, secret)
+		if err != nil {
+			return invalidClient(c)
+		}
+		c.Locals(ClientKey, client)
+		return c.Next()
+	}
+}
+
+// OptionalClientAuth is ClientAuth for routes that callers may use without
+// being a client: requests without credentials pass through with no client,
+// and requests with wrong credentials are rejected.
+func OptionalClientAuth(authenticator ClientAuthenticator) fiber.Handler {
+	required := ClientAuth(authenticator)
+	return func(c *fiber.Ctx) error {
+		if _, _, ok := clientCredentials(c); !ok && c.Get(fiber.HeaderAuthorization) == "" {
+			return c.Next()
+		}
+		return required(c)
+	}
+}
+
+// ClientFrom returns the client stored by ClientAuth or OptionalClientAuth.
+func ClientFrom(c *fiber.Ctx) (*model.Client, bool) {
+	client, ok := c.Locals(ClientKey).(*model.Client)
+	return client, ok && client != nil
+}
+
+func clientCredentials(c *fiber.Ctx) (clientID, secret string, ok bool) {
+	scheme, encoded, found := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if found && strings.EqualFold(scheme, "Basic") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return "", "", false
+		}
+		id, pass, found := strings.Cut(string(decoded), ":")
+		if !found {
+			return "", "", false
+		}
+		// RFC 6749 section 2.3.1 form-encodes both values before joining them.
+		if clientID, err = url.QueryUnescape(id); err != nil {
+			return "", "", false
+		}
+		if secret, err = url.QueryUnescape(pass); err != nil {
+			return "", "", false
+		}
+		return clientID, secret, clientID != "" && secret != ""
+	}
+
+	clientID, secret = c.FormValue("client_id"), c.FormValue("client_secret")
+	return clientID, secret, clientID != "" && secret != ""
+}
+
+func invalidClient(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="goAuth"`)
+	return c.Status(http.StatusUnauthorized).JSON(common.ErrorResponse{
+		StatusCode: http.StatusUnauthorized,
+		Status:     "error",
+		Message:    common.ErrInvalidClient.Error(),
+	})
+}
@@ -1,7 +1,11 @@
 package server
 
 import (
+	"time"
+
+	"goAuth/internal/database/model"
 	"goAuth/internal/server/api"
+	"goAuth/internal/server/middleware"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/swagger"
@@ -11,12 +15,41 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/cors"
 )
 
-func (s *FiberServer) SetupRoutes(authService api.LoginService, userService api.UserService) {
+// Services holds the services the API routes are served by.
+type Services struct {
+	Auth          api.LoginService
+	MFA           api.MFAService
+	Passkeys      api.PasskeyService
+	Sessions      api.SessionService
+	User          api.UserService
+	Keys          api.KeyService
+	Tokens        middleware.TokenValidator
+	Roles         middleware.RoleStore
+	Introspection api.IntrospectionService
+	Clients       middleware.ClientAuthenticator
+	Delivery      api.DeliveryService
+	Tracking      api.TrackingService
+
+	// StepUpMaxAge is how recent the authentication behind an access token
+	// must be for sensitive operations.
+	StepUpMaxAge time.Duration
+}
+
+// SetupRoutes registers the middleware and every API route on the server.
+//
+//	@securityDefinitions.apikey	BearerAuth
+//	@in							header
+//	@name						Authorization
+//	@description				Type "Bearer" followed by a space and the access token.
+//
+//	@securityDefinitions.basic	ClientBasicAuth
+//	@description				OAuth client credentials (client_id and client_secret).
+func (s *FiberServer) SetupRoutes(services Services) {
 	// Apply CORS middleware
 	s.App.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS,PATCH",
-		AllowHeaders:     "Accept,Authorization,Content-Type",
+		AllowHeaders:     "Accept,Authorization,Content-Type," + api.HeaderDeviceName,
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
@@ -27,34 +60,191 @@ func (s *FiberServer) SetupRoutes(authService api.LoginService, userService api.
 	// Swagger docs route
 	s.App.Get("/swagger/*", swagger.HandlerDefault)
 
-	// Auth routes: /api/v1/auth/request, /api/v1/auth/verify
+	// Well-known routes: /.well-known/jwks.json
+	setupWellKnownRoutes(s.App, services.Keys)
+
+	// Protects routes with a bearer access token
+	requireAuth := middleware.New(middleware.Config{Validator: services.Tokens, RoleStore: services.Roles})
+	// Sensitive operations also need a recent authentication, see /api/v1/auth/step-up
+	requireFresh := middleware.RequireFreshAuth(services.StepUpMaxAge)
+	// Identifies the calling client when it sends its credentials
+	optionalClient := middleware.OptionalClientAuth(services.Clients)
+
+	// Auth routes: /api/v1/auth/request, /api/v1/auth/verify, /api/v1/auth/refresh,
+	// /api/v1/auth/logout, /api/v1/auth/logout-all, /api/v1/auth/email,
+	// /api/v1/auth/email/verify, /api/v1/auth/magic-link,
+	// /api/v1/auth/magic-link/callback, /api/v1/auth/mfa/verify,
+	// /api/v1/auth/password, /api/v1/auth/password/login,
+	// /api/v1/auth/password/change, /api/v1/auth/password/reset,
+	// /api/v1/auth/step-up
 	authGroup := apiV1.Group("/auth")
-	setupAuthRoutes(authGroup, authService)
+	setupAuthRoutes(authGroup, services.Auth, requireAuth, requireFresh, optionalClient)
+
+	// MFA routes: /api/v1/auth/mfa/totp, /api/v1/auth/mfa/totp/confirm,
+	// /api/v1/auth/mfa/totp/disable
+	setupMFARoutes(authGroup.Group("/mfa"), services.MFA, requireAuth, requireFresh)
+
+	// Passkey routes: /api/v1/auth/passkeys, /api/v1/auth/passkeys/:id,
+	// /api/v1/auth/passkeys/register/begin, /api/v1/auth/passkeys/register/finish,
+	// /api/v1/auth/passkeys/login/begin, /api/v1/auth/passkeys/login/finish
+	setupPasskeyRoutes(authGroup.Group("/passkeys"), services.Passkeys, requireAuth, requireFresh)
+
+	// Session routes: /api/v1/me/sessions, /api/v1/me/sessions/:id,
+	// /api/v1/users/:id/sessions, /api/v1/users/:id/sessions/:sessionID
+	setupSessionRoutes(apiV1, services.Sessions, requireAuth, requireFresh)
+
+	// OAuth routes: /api/v1/oauth/introspect
+	oauthGroup := apiV1.Group("/oauth")
+	setupOAuthRoutes(oauthGroup, services.Introspection, middleware.ClientAuth(services.Clients))
 
 	// User routes: /api/v1/users/:id, /api/v1/users
-	setupUserRoutes(apiV1, userService)
+	setupUserRoutes(apiV1, services.User, requireAuth)
+
+	// Delivery routes: /api/v1/delivery/providers, /api/v1/delivery/messages,
+	// /api/v1/delivery/receipts/:provider
+	deliveryGroup := apiV1.Group("/delivery")
+	setupDeliveryRoutes(deliveryGroup, services.Delivery, services.Tracking, requireAuth)
 }
 
 func (s *FiberServer) healthRoutes(c *fiber.Ctx) error {
 	return c.JSON(s.DB.Health())
 }
 
-func setupAuthRoutes(app fiber.Router, service api.LoginService) {
+func setupAuthRoutes(app fiber.Router, service api.LoginService, requireAuth, requireFresh, optionalClient fiber.Handler) {
 	handler := api.NewLoginHandler(service)
 
 	// POST /api/v1/auth/request
-	app.Post("/request", handler.RequestOTP)
+	app.Post("/request", optionalClient, handler.RequestOTP)
 
 	// POST /api/v1/auth/verify
 	app.Post("/verify", handler.VerifyOTP)
+
+	// POST /api/v1/auth/refresh
+	app.Post("/refresh", handler.RefreshToken)
+
+	// POST /api/v1/auth/logout
+	app.Post("/logout", handler.Logout)
+
+	// POST /api/v1/auth/logout-all
+	app.Post("/logout-all", handler.LogoutAll)
+
+	// POST /api/v1/auth/email
+	app.Post("/email", requireAuth, requireFresh, handler.LinkEmail)
+
+	// POST /api/v1/auth/email/verify
+	app.Post("/email/verify", requireAuth, handler.VerifyEmail)
+
+	// POST /api/v1/auth/magic-link
+	app.Post("/magic-link", optionalClient, handler.RequestMagicLink)
+
+	// GET /api/v1/auth/magic-link/callback
+	app.Get("/magic-link/callback", handler.MagicLinkCallback)
+
+	// POST /api/v1/auth/mfa/verify
+	app.Post("/mfa/verify", handler.VerifyMFA)
+
+	// POST /api/v1/auth/password
+	app.Post("/password", requireAuth, requireFresh, handler.SetPassword)
+
+	// POST /api/v1/auth/password/login
+	app.Post("/password/login", handler.PasswordLogin)
+
+	// POST /api/v1/auth/password/change
+	app.Post("/password/change", requireAuth, handler.ChangePassword)
+
+	// POST /api/v1/auth/password/reset
+	app.Post("/password/reset", handler.ResetPassword)
+
+	// POST /api/v1/auth/step-up
+	app.Post("/step-up", requireAuth, handler.StepUp)
+}
+
+func setupMFARoutes(app fiber.Router, service api.MFAService, requireAuth, requireFresh fiber.Handler) {
+	handler := api.NewMFAHandler(service)
+
+	// POST /api/v1/auth/mfa/totp
+	app.Post("/totp", requireAuth, requireFresh, handler.EnrollTOTP)
+
+	// POST /api/v1/auth/mfa/totp/confirm
+	app.Post("/totp/confirm", requireAuth, requireFresh, handler.ConfirmTOTP)
+
+	// POST /api/v1/auth/mfa/totp/disable
+	app.Post("/totp/disable", requireAuth, requireFresh, handler.DisableTOTP)
 }
 
-func setupUserRoutes(app fiber.Router, service api.UserService) {
+func setupPasskeyRoutes(app fiber.Router, service api.PasskeyService, requireAuth, requireFresh fiber.Handler) {
+	handler := api.NewPasskeyHandler(service)
+
+	// GET /api/v1/auth/passkeys
+	app.Get("/", requireAuth, handler.ListPasskeys)
+
+	// DELETE /api/v1/auth/passkeys/:id
+	app.Delete("/:id", requireAuth, requireFresh, handler.DeletePasskey)
+
+	// POST /api/v1/auth/passkeys/register/begin
+	app.Post("/register/begin", requireAuth, requireFresh, handler.BeginRegistration)
+
+	// POST /api/v1/auth/passkeys/register/finish
+	app.Post("/register/finish", requireAuth, handler.FinishRegistration)
+
+	// POST /api/v1/auth/passkeys/login/begin
+	app.Post("/login/begin", handler.BeginLogin)
+
+	// POST /api/v1/auth/passkeys/login/finish
+	app.Post("/login/finish", handler.FinishLogin)
+}
+
+func setupSessionRoutes(app fiber.Router, service api.SessionService, requireAuth, requireFresh fiber.Handler) {
+	handler := api.NewSessionHandler(service)
+	requireAdmin := middleware.RequireRoles(model.RoleAdmin)
+
+	// GET /api/v1/me/sessions
+	app.Get("/me/sessions", requireAuth, handler.ListSessions)
+
+	// DELETE /api/v1/me/sessions/:id
+	app.Delete("/me/sessions/:id", requireAuth, requireFresh, handler.RevokeSession)
+
+	// GET /api/v1/users/:id/sessions
+	app.Get("/users/:id/sessions", requireAuth, requireAdmin, handler.ListUserSessions)
+
+	// DELETE /api/v1/users/:id/sessions/:sessionID
+	app.Delete("/users/:id/sessions/:sessionID", requireAuth, requireAdmin, handler.RevokeUserSession)
+}
+
+func setupOAuthRoutes(app fiber.Router, service api.IntrospectionService, requireClient fiber.Handler) {
+	handler := api.NewOAuthHandler(service)
+
+	// POST /api/v1/oauth/introspect
+	app.Post("/introspect", requireClient, handler.Introspect)
+}
+
+func setupWellKnownRoutes(app fiber.Router, service api.KeyService) {
+	handler := api.NewKeyHandler(service)
+
+	// GET /.well-known/jwks.json
+	app.Get("/.well-known/jwks.json", handler.JWKS)
+}
+
+func setupUserRoutes(app fiber.Router, service api.UserService, requireAuth fiber.Handler) {
 	handler := api.NewUserHandler(service)
 
 	// GET /api/v1/users/:id
-	app.Get("/users/:id", handler.GetUser)
+	app.Get("/users/:id", requireAuth, handler.GetUser)
 
 	// GET /api/v1/users
-	app.Get("/users", handler.GetUsers)
+	app.Get("/users", requireAuth, middleware.RequireRoles(model.RoleAdmin), handler.GetUsers)
+}
+
+func setupDeliveryRoutes(app fiber.Router, service api.DeliveryService, tracking api.TrackingService, requireAuth fiber.Handler) {
+	handler := api.NewDeliveryHandler(service, tracking)
+	requireAdmin := middleware.RequireRoles(model.RoleAdmin)
+
+	// GET /api/v1/delivery/providers
+	app.Get("/providers", requireAuth, requireAdmin, handler.ProviderStats)
+
+	// GET /api/v1/delivery/messages
+	app.Get("/messages", requireAuth, requireAdmin, handler.History)
+
+	// POST /api/v1/delivery/receipts/:provider
+	app.Post("/receipts/:provider", handler.Receipt)
 }
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// takeAttempt counts an attempt against counter before the guess it guards
+// is checked, so parallel guesses cannot all pass the limit: each takes its
+// own number and only the first limit are checked. It returns the attempt's
+// number and whether it is within limit.
+func takeAttempt(counter *atomic.Int32, limit int32) (attempt int32, ok bool) {
+	attempt = counter.Add(1)
+	return attempt, attempt <= limit
+}
+
+// storedAttempts returns the attempt counter kept under key, starting one
+// that lasts ttl when there is none.
+func (s *service) storedAttempts(key string, ttl time.Duration) *atomic.Int32 {
+	stored, _ := s.inMemo.GetOrSet(key, new(atomic.Int32), ttl)
+	if counter, ok := stored.(*atomic.Int32); ok {
+		return counter
+	}
+	return new(atomic.Int32)
+}
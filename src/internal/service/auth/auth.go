@@ -1,18 +1,21 @@
 package auth
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
+	"context"
 	"errors"
 	"fmt"
-	"math/big"
 	"os"
 	"time"
 
 	"goAuth/internal/common"
 	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/delivery"
 	inmemory "goAuth/internal/service/in-memory"
+	"goAuth/internal/service/signing"
+	"goAuth/internal/utils/password"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -22,98 +25,255 @@ type service struct {
 	db     *gorm.DB
 	logger *zap.Logger
 	inMemo *inmemory.InMemoryStore
+	keys   *signing.KeyRing
+	sender delivery.OTPSender
+	// sendTimeout bounds how long a request waits for sender.
+	sendTimeout time.Duration
+	// channels tells which delivery channels reach a recipient; nil means all.
+	channels ChannelRouter
+
+	// policy is the server's OTP policy, which clients may override.
+	policy model.OTPPolicy
+	// otpKey keys the HMAC under which OTP codes are stored.
+	otpKey []byte
+	// mfaKey encrypts TOTP secrets; nil disables TOTP enrollment.
+	mfaKey []byte
+	// passwordParams are the Argon2id parameters new password hashes use.
+	passwordParams password.Params
+	// passwordSlots bounds the Argon2id hashes running at once, each of
+	// which holds passwordParams.Memory.
+	passwordSlots chan struct{}
+	// passwordPolicy decides which new passwords are accepted.
+	passwordPolicy *password.Policy
+	// webAuthn is the passkey relying party; nil disables passkeys.
+	webAuthn *webauthn.WebAuthn
+	// magicLinkCallback is the URL magic links point at; empty disables
+	// magic links.
+	magicLinkCallback string
+	// generateOTP returns a new plaintext OTP code; replaced in tests.
+	generateOTP func(length int, alphabet string) (string, error)
 }
 
-func NewAuthenticationService(db *gorm.DB, inMemo *inmemory.InMemoryStore) *service {
+func NewAuthenticationService(db *gorm.DB, inMemo *inmemory.InMemoryStore, keys *signing.KeyRing, sender delivery.OTPSender, channels ChannelRouter) *service {
 	return &service{
-		db:     db,
-		logger: zap.L(),
-		inMemo: inMemo,
+		db:             db,
+		logger:         zap.L(),
+		inMemo:         inMemo,
+		keys:           keys,
+		sender:         sender,
+		sendTimeout:    otpSendTimeout,
+		channels:       channels,
+		policy:         otpPolicyFromEnv(),
+		otpKey:         otpKeyFromEnv(),
+		mfaKey:         mfaKeyFromEnv(),
+		webAuthn:       webAuthnFromEnv(),
+		passwordParams: password.ParamsFromEnv(),
+		passwordSlots:  make(chan struct{}, passwordHashSlots()),
+		passwordPolicy: password.DefaultPolicy(),
+		generateOTP:    randomOTP,
+	}
+}
+
+// OTPRequest issues an OTP for the identifier of req under the policy of
+// req.ClientID and hands it to the sender, which renders it in the language
+// best matching req.Locale. The code goes out over req.Channel, or when it is
+// empty over the channel picked by pickChannel. The returned request ID
+// identifies the message in delivery tracking.
+func (s *service) OTPRequest(req schema.OTPRequest) (requestID, usedChannel string, err error) {
+	id, ok := req.Identifier()
+	if !ok {
+		return "", "", common.ErrInvalidIdentifier
+	}
+	policy, err := s.otpPolicy(req.ClientID)
+	if err != nil {
+		return "", "", err
 	}
+	return s.issueOTP(otpPrefix, id, policy, req.Channel, req.Locale)
 }
 
-func (s *service) OTPRequest(phoneNumber string) error {
-	max := big.NewInt(1000000) // 0 to 999999
-	n, err := rand.Int(rand.Reader, max)
+// issueOTP generates, stores under prefix and sends an OTP for id. The prefix
+// keeps codes issued for different purposes apart.
+func (s *service) issueOTP(prefix string, id schema.Identifier, policy model.OTPPolicy, channel, locale string) (requestID, usedChannel string, err error) {
+	recipient := id.Value
+	if id.Type == schema.IdentifierPhone {
+		if err := checkPhoneAllowed(recipient); err != nil {
+			return "", "", err
+		}
+	}
+	usedChannel, err = s.pickChannel(id, channel)
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkOTPSendLimits(recipient, policy); err != nil {
+		return "", "", err
+	}
+
+	otpCode, err := s.generateOTP(policy.Length, policy.Alphabet)
 	if err != nil {
 		s.logger.Error("failed to generate OTP", zap.Error(err))
-		return fmt.Errorf("failed to generate OTP: %w", err)
+		return "", "", fmt.Errorf("failed to generate OTP: %w", err)
+	}
+	requestID, err = randomToken(16)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate OTP request id: %w", err)
 	}
-	otpCode := fmt.Sprintf("%06s", n.String())
 
-	s.inMemo.Set(phoneNumber, otpCode, time.Minute*2) // 2 minutes
+	key := prefix + recipient
+	s.inMemo.Set(key, &otpEntry{hash: s.hashOTP(recipient, otpCode), maxAttempts: int32(policy.MaxVerifyAttempts)}, policy.TTL)
+
+	if common.LogOTPCodes() {
+		s.logger.Info("OTP generated (OTP_LOG_CODES)", zap.String("recipient", recipient), zap.String("otp", otpCode))
+	} else {
+		s.logger.Debug("OTP generated", zap.String("recipient", recipient))
+	}
+
+	err = s.send(delivery.Message{
+		RequestID: requestID,
+		Recipient: recipient,
+		Code:      otpCode,
+		ExpiresIn: policy.TTL,
+		Channel:   usedChannel,
+		Locale:    locale,
+	})
+	// Remember the channel even when it failed, so a retry moves on to the next.
+	s.inMemo.Set(otpChannelPrefix+recipient, usedChannel, otpChannelCooldown(policy.TTL))
+	if err != nil {
+		// The user never received this code, so do not leave it verifiable.
+		s.inMemo.Delete(key)
+		return "", "", err
+	}
+	return requestID, usedChannel, nil
+}
+
+// SetSendTimeout replaces how long a request waits for the sender, e.g. with
+// the time a delivery router needs to try every provider of a route.
+func (s *service) SetSendTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.sendTimeout = timeout
+	}
+}
+
+// send hands msg to the sender, wrapping failures in
+// common.ErrOTPDeliveryFailed or common.ErrOTPDeliveryUnavailable.
+func (s *service) send(msg delivery.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+	defer cancel()
+	err := s.sender.Send(ctx, msg)
+	if err == nil {
+		return nil
+	}
+	s.logger.Error("failed to deliver OTP", zap.String("recipient", msg.Recipient), zap.String("channel", msg.DeliveryChannel()), zap.String("request_id", msg.RequestID), zap.Error(err))
+	if errors.Is(err, delivery.ErrPermanent) {
+		return fmt.Errorf("%w: %w", common.ErrOTPDeliveryFailed, err)
+	}
+	return fmt.Errorf("%w: %w", common.ErrOTPDeliveryUnavailable, err)
+}
 
-	s.logger.Debug("OTP generated", zap.String("phoneNumber", phoneNumber), zap.String("otp", otpCode))
-	return nil
+// OTPVerify checks otpCode against the login OTP issued for id and consumes
+// it on success.
+func (s *service) OTPVerify(id schema.Identifier, otpCode string) (bool, error) {
+	return s.verifyOTP(otpPrefix, id, otpCode)
 }
 
-func (s *service) OTPVerify(phoneNumber, otpCode string) (bool, error) {
-	registeredOTP, ok := s.inMemo.Get(phoneNumber)
+// verifyOTP checks otpCode against the OTP stored under prefix for id and
+// consumes it on success.
+func (s *service) verifyOTP(prefix string, id schema.Identifier, otpCode string) (bool, error) {
+	key := prefix + id.Value
+	registeredOTP, ok := s.inMemo.Get(key)
 	if !ok {
 		return false, common.ErrGetOTP
 	}
 
-	otpStr, ok := registeredOTP.(string)
+	entry, ok := registeredOTP.(*otpEntry)
 	if !ok {
-		s.logger.Error("stored OTP is not a string", zap.Any("registeredOTP", registeredOTP))
+		s.logger.Error("stored OTP has unexpected type", zap.String("type", fmt.Sprintf("%T", registeredOTP)))
 		return false, common.ErrInvalidOTP
 	}
 
-	if otpStr != otpCode {
+	attempt, ok := takeAttempt(&entry.attempts, entry.maxAttempts)
+	if !ok {
+		s.inMemo.Delete(key)
+		return false, common.ErrOTPAttemptsExceeded
+	}
+	if !s.compareOTP(id.Value, otpCode, entry.hash) {
+		if attempt == entry.maxAttempts {
+			s.inMemo.Delete(key)
+			s.logger.Info("OTP burned after too many failed attempts", zap.String("recipient", id.Value))
+			return false, common.ErrOTPAttemptsExceeded
+		}
 		return false, common.ErrCompareOTP
 	}
+
+	// An OTP is single use: only the first successful verification wins.
+	if !entry.used.CompareAndSwap(false, true) {
+		return false, common.ErrGetOTP
+	}
+	s.inMemo.Delete(key)
+	// The code arrived, so the next login starts over on the first channel.
+	s.inMemo.Delete(otpChannelPrefix + id.Value)
 	return true, nil
 }
 
-func (s *service) RegisterUser(phoneNumber string) (created bool, err error) {
-	var user model.User
-
-	dbErr := s.db.Where("phone_number = ?", phoneNumber).First(&user).Error
-
-	if dbErr == nil {
+// RegisterUser creates the account of id after a successful OTP
+// verification, or marks the identifier of the existing account verified.
+func (s *service) RegisterUser(id schema.Identifier) (created bool, err error) {
+	user, err := s.findUser(id)
+	if err == nil {
+		if !identifierVerified(user, id) {
+			// The caller only registers users after a successful OTP verification.
+			if err := s.db.Model(user).Update(verifiedColumn(id), true).Error; err != nil {
+				s.logger.Error("failed to mark identifier verified", zap.String("type", id.Type), zap.Error(err))
+				return false, err
+			}
+		}
 		return false, nil
 	}
-
-	if !errors.Is(dbErr, gorm.ErrRecordNotFound) {
-		s.logger.Error("database error checking for user", zap.Error(dbErr))
-		return false, dbErr
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.Error("database error checking for user", zap.Error(err))
+		return false, err
 	}
 
-	newUser := &model.User{
-		PhoneNumber: phoneNumber,
+	newUser := &model.User{Roles: []string{model.RoleUser}}
+	value := id.Value
+	switch id.Type {
+	case schema.IdentifierEmail:
+		newUser.Email, newUser.EmailVerified = &value, true
+	default:
+		newUser.PhoneNumber, newUser.PhoneVerified = &value, true
 	}
 	if createErr := s.db.Create(newUser).Error; createErr != nil {
-		s.logger.Error("failed to create user", zap.Error(createErr), zap.String("phoneNumber", phoneNumber))
+		s.logger.Error("failed to create user", zap.Error(createErr), zap.String("identifier", id.Value))
 		return false, createErr
 	}
 	return true, nil
-
 }
 
-func (s *service) GenerateToken(phoneNumber string) (accessToken string, err error) {
+func (s *service) generateToken(user *model.User, authn authentication) (accessToken string, err error) {
 	expiryStr := os.Getenv("ACCESS_EXPIRY")
-	secretStr := os.Getenv("SECRET_KEY")
 	expiryDuration, err := time.ParseDuration(expiryStr)
 
 	if err != nil {
 		s.logger.Error("invalid accessExpiry duration", zap.String("accessExpiry", expiryStr), zap.Error(err))
 		return "", fmt.Errorf("invalid accessExpiry duration: %w", err)
 	}
+	return s.signToken(user, authn, expiryDuration)
+}
 
-	iat := time.Now().Unix()
-
-	hasher := sha256.New()
-	hasher.Write([]byte(phoneNumber + fmt.Sprint(iat)))
-	userHash := fmt.Sprintf("%x", hasher.Sum(nil))
-
-	claims := jwt.MapClaims{
-		"user": userHash,
-		"exp":  time.Now().Add(expiryDuration).Unix(),
-		"iat":  iat,
+// signToken issues an access token for user, authenticated as authn, that
+// expires after expiry.
+func (s *service) signToken(user *model.User, authn authentication, expiry time.Duration) (accessToken string, err error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		s.logger.Error("failed to generate token id", zap.Error(err))
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(secretStr))
+	claims := newClaims(user, authn, jti, expiry)
+
+	key := s.keys.Active()
+	token := jwt.NewWithClaims(key.SigningMethod(), claims)
+	token.Header["kid"] = key.ID
+	signedToken, err := token.SignedString(key.SigningKey())
 	if err != nil {
 		s.logger.Error("failed to sign JWT token", zap.Error(err))
 		return "", err
@@ -121,3 +281,47 @@ func (s *service) GenerateToken(phoneNumber string) (accessToken string, err err
 
 	return signedToken, nil
 }
+
+// ValidateToken verifies the signature, expiry, issuer and audience of
+// accessToken and checks it against the revocation list.
+func (s *service) ValidateToken(accessToken string) (*Claims, error) {
+	claims, err := s.parseToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if s.isRevoked(claims) {
+		return nil, common.ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// parseToken verifies accessToken without consulting the revocation list.
+func (s *service) parseToken(accessToken string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := s.keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if t.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("key %q does not sign with %s", kid, t.Method.Alg())
+		}
+		return key.VerificationKey(), nil
+	},
+		jwt.WithValidMethods(signing.Algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(issuer()),
+		jwt.WithAudience(audience()...),
+	)
+	if err != nil {
+		s.logger.Debug("access token rejected", zap.Error(err))
+		return nil, fmt.Errorf("%w: %w", common.ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys that verify tokens issued by this service.
+func (s *service) JWKS() schema.JWKS {
+	return s.keys.JWKS()
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/delivery"
+)
+
+const (
+	otpChannelPrefix = "otp:channel:"
+
+	defaultOTPChannelFallback = "sms,messaging-app,voice"
+)
+
+// ChannelRouter reports whether a delivery channel can reach a recipient.
+type ChannelRouter interface {
+	Supports(channel, recipient string) bool
+}
+
+// otpChannelFallback returns OTP_CHANNEL_FALLBACK, the comma-separated order
+// in which channels are tried when a user asks for another code.
+func otpChannelFallback() []string {
+	value := os.Getenv("OTP_CHANNEL_FALLBACK")
+	if value == "" {
+		value = defaultOTPChannelFallback
+	}
+	var channels []string
+	for _, channel := range strings.Split(value, ",") {
+		channel = strings.TrimSpace(channel)
+		if slices.Contains(delivery.Channels, channel) && !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	if len(channels) == 0 {
+		return []string{delivery.ChannelSMS}
+	}
+	return channels
+}
+
+// otpChannelCooldown returns OTP_CHANNEL_COOLDOWN, how long after a request
+// another one counts as "the code did not arrive" and falls back to the next
+// channel. It defaults to ttl, the OTP lifetime.
+func otpChannelCooldown(ttl time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("OTP_CHANNEL_COOLDOWN")); err == nil && d > 0 {
+		return d
+	}
+	return ttl
+}
+
+// pickChannel returns the channel an OTP for id goes out on. Email addresses
+// can only be sent email. For phone numbers an explicitly requested channel
+// is used as is. Otherwise the first request uses the first channel of the
+// fallback order, and a request within the cooldown of the previous one
+// moves on to the channel after the one used last, skipping channels that
+// cannot reach the number. Landlines can only be called.
+func (s *service) pickChannel(id schema.Identifier, requested string) (string, error) {
+	phoneNumber := id.Value
+	if id.Type == schema.IdentifierEmail {
+		if requested == "" {
+			requested = delivery.ChannelEmail
+		}
+		if requested != delivery.ChannelEmail || !s.supportsChannel(requested, phoneNumber) {
+			return "", fmt.Errorf("%w: %s", common.ErrChannelUnavailable, requested)
+		}
+		return requested, nil
+	}
+	landline := isFixedLine(phoneNumber)
+	reaches := func(channel string) bool {
+		if landline && channel != delivery.ChannelVoice {
+			return false
+		}
+		return s.supportsChannel(channel, phoneNumber)
+	}
+	if requested != "" {
+		if !reaches(requested) {
+			return "", fmt.Errorf("%w: %s", common.ErrChannelUnavailable, requested)
+		}
+		return requested, nil
+	}
+
+	order := otpChannelFallback()
+	start := 0
+	if last, ok := s.inMemo.Get(otpChannelPrefix + phoneNumber); ok {
+		if lastChannel, ok := last.(string); ok {
+			// A channel outside the order (e.g. an explicit "email") restarts it.
+			start = slices.Index(order, lastChannel) + 1
+		}
+	}
+	for i := range order {
+		channel := order[(start+i)%len(order)]
+		if reaches(channel) {
+			return channel, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no channel reaches %s", common.ErrChannelUnavailable, phoneNumber)
+}
+
+func (s *service) supportsChannel(channel, recipient string) bool {
+	return s.channels == nil || s.channels.Supports(channel, recipient)
+}
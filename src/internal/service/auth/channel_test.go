@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/delivery"
+)
+
+// channelSet is a ChannelRouter supporting a fixed set of channels.
+type channelSet map[string]bool
+
+func (c channelSet) Supports(channel, _ string) bool { return c[channel] }
+
+func requestChannel(t *testing.T, s *service, channel string) string {
+	t.Helper()
+	_, used, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone, Channel: channel})
+	if err != nil {
+		t.Fatalf("OTPRequest(%q) error = %v", channel, err)
+	}
+	msg, _ := s.sender.(*delivery.RecordingSender).Last()
+	if msg.Channel != used {
+		t.Fatalf("sent over %q, reported %q", msg.Channel, used)
+	}
+	return used
+}
+
+func TestOTPRequestFallsBackToNextChannel(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+
+	var got []string
+	for range 4 {
+		got = append(got, requestChannel(t, s, ""))
+	}
+	want := []string{"sms", "messaging-app", "voice", "sms"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("channels = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestOTPRequestSkipsUnsupportedChannels(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	s.channels = channelSet{"sms": true, "voice": true}
+
+	if first, second := requestChannel(t, s, ""), requestChannel(t, s, ""); first != "sms" || second != "voice" {
+		t.Fatalf("channels = %s, %s; want sms, voice", first, second)
+	}
+}
+
+func TestOTPVerifyResetsChannelFallback(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+
+	requestChannel(t, s, "")
+	if _, err := s.OTPVerify(schema.PhoneIdentifier(testPhone), testOTP); err != nil {
+		t.Fatalf("OTPVerify() error = %v", err)
+	}
+	if got := requestChannel(t, s, ""); got != "sms" {
+		t.Fatalf("channel after a successful login = %s, want sms", got)
+	}
+}
+
+func TestOTPRequestFallbackAfterCooldown(t *testing.T) {
+	t.Setenv("OTP_CHANNEL_COOLDOWN", "1ns")
+	s, _, _ := newOTPTestService(t)
+
+	requestChannel(t, s, "")
+	if got := requestChannel(t, s, ""); got != "sms" {
+		t.Fatalf("channel after the cooldown = %s, want sms", got)
+	}
+}
+
+func TestOTPRequestExplicitChannel(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	s.channels = channelSet{"sms": true, "voice": true}
+
+	requestChannel(t, s, "")
+	if got := requestChannel(t, s, "sms"); got != "sms" {
+		t.Fatalf("explicit channel = %s, want sms", got)
+	}
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone, Channel: "messaging-app"}); !errors.Is(err, common.ErrChannelUnavailable) {
+		t.Fatalf("unsupported channel error = %v, want %v", err, common.ErrChannelUnavailable)
+	}
+}
+
+func TestOTPChannelFallbackFromEnv(t *testing.T) {
+	t.Setenv("OTP_CHANNEL_FALLBACK", "voice, fax, sms, voice")
+	got := otpChannelFallback()
+	if len(got) != 2 || got[0] != "voice" || got[1] != "sms" {
+		t.Fatalf("otpChannelFallback() = %v, want [voice sms]", got)
+	}
+}
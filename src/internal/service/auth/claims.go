@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"goAuth/internal/database/model"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultIssuer       = "goAuth"
+	defaultAudience     = "goAuth"
+	defaultCustomClaims = "roles,tenant,phone_verified"
+)
+
+// Custom claim names selectable through JWT_CUSTOM_CLAIMS.
+const (
+	ClaimRoles         = "roles"
+	ClaimTenant        = "tenant"
+	ClaimPhoneVerified = "phone_verified"
+	ClaimEmailVerified = "email_verified"
+)
+
+// Claims are the claims carried by access tokens. sub is the stable user ID
+// from model.User.
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles         []string `json:"roles,omitempty"`
+	Tenant        string   `json:"tenant,omitempty"`
+	PhoneVerified *bool    `json:"phone_verified,omitempty"`
+	EmailVerified *bool    `json:"email_verified,omitempty"`
+
+	// AuthTime, AMR and ACR tell when and how the user last proved their
+	// identity. Refreshed tokens keep those of the login.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	ACR      string           `json:"acr,omitempty"`
+
+	// SessionID names the session the token belongs to, see model.Session.
+	SessionID string `json:"sid,omitempty"`
+}
+
+// UserID returns the user ID held in the sub claim.
+func (c *Claims) UserID() (uint8, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	return uint8(id), nil
+}
+
+// AuthenticatedWithin reports whether the user authenticated no longer than
+// maxAge ago. Tokens without auth_time never are.
+func (c *Claims) AuthenticatedWithin(maxAge time.Duration) bool {
+	return c.AuthTime != nil && time.Since(c.AuthTime.Time) <= maxAge
+}
+
+// HasMethod reports whether the user authenticated with method, one of the
+// schema.Method constants.
+func (c *Claims) HasMethod(method string) bool {
+	return slices.Contains(c.AMR, method)
+}
+
+// sessionID returns the session ID held in the sid claim, or zero.
+func (c *Claims) sessionID() uint {
+	id, _ := strconv.ParseUint(c.SessionID, 10, 64)
+	return uint(id)
+}
+
+func formatUserID(id uint8) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// newClaims builds the claims for user authenticated as authn. Custom claims
+// are only included when listed in JWT_CUSTOM_CLAIMS.
+func newClaims(user *model.User, authn authentication, jti string, expiry time.Duration) *Claims {
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer(),
+			Subject:   formatUserID(user.ID),
+			Audience:  audience(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+		AuthTime: jwt.NewNumericDate(authn.time),
+		AMR:      authn.methods,
+		ACR:      authn.acr(),
+	}
+	if authn.sessionID != 0 {
+		claims.SessionID = formatSessionID(authn.sessionID)
+	}
+
+	enabled := customClaims()
+	if slices.Contains(enabled, ClaimRoles) {
+		claims.Roles = user.Roles
+	}
+	if slices.Contains(enabled, ClaimTenant) {
+		claims.Tenant = user.Tenant
+	}
+	if slices.Contains(enabled, ClaimPhoneVerified) {
+		claims.PhoneVerified = &user.PhoneVerified
+	}
+	if slices.Contains(enabled, ClaimEmailVerified) {
+		claims.EmailVerified = &user.EmailVerified
+	}
+	return claims
+}
+
+// issuer returns JWT_ISSUER, the iss claim of every token.
+func issuer() string {
+	if iss := os.Getenv("JWT_ISSUER"); iss != "" {
+		return iss
+	}
+	return defaultIssuer
+}
+
+// audience returns the comma separated JWT_AUDIENCE list.
+func audience() jwt.ClaimStrings {
+	return splitList(os.Getenv("JWT_AUDIENCE"), defaultAudience)
+}
+
+// customClaims returns the comma separated JWT_CUSTOM_CLAIMS list. Set it to
+// "none" to issue tokens with registered claims only.
+func customClaims() []string {
+	return splitList(os.Getenv("JWT_CUSTOM_CLAIMS"), defaultCustomClaims)
+}
+
+func splitList(value, fallback string) []string {
+	if value == "" {
+		value = fallback
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
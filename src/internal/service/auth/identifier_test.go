@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/delivery"
+	"goAuth/internal/service/signing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "auth.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.Client{}, &model.RefreshToken{}, &model.TOTPFactor{}, &model.RecoveryCode{}, &model.WebAuthnCredential{}, &model.Session{}, &model.RevokedToken{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newUserTestService returns a service with a database, signing keys and a
+// registered testPhone, and that user.
+func newUserTestService(t *testing.T) (*service, *model.User) {
+	t.Helper()
+	s, _, _ := newOTPTestService(t)
+	s.db = newTestDB(t)
+	t.Setenv("ACCESS_EXPIRY", "1h")
+	s.keys = signing.NewStaticRing(signing.NewSecretKey([]byte("test-secret")))
+	return s, mustRegister(t, s, schema.PhoneIdentifier(testPhone))
+}
+
+// mustRegister registers id, unless it already has an account, and returns
+// its user.
+func mustRegister(t *testing.T, s *service, id schema.Identifier) *model.User {
+	t.Helper()
+	if _, err := s.RegisterUser(id); err != nil {
+		t.Fatalf("RegisterUser() error = %v", err)
+	}
+	user, err := s.findUser(id)
+	if err != nil {
+		t.Fatalf("findUser() error = %v", err)
+	}
+	return user
+}
+
+func TestEmailLogin(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	s.db = newTestDB(t)
+
+	_, channel, err := s.OTPRequest(schema.OTPRequest{Email: "Alice@Example.com"})
+	if err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+	msg, _ := s.sender.(*delivery.RecordingSender).Last()
+	if channel != delivery.ChannelEmail || msg.Recipient != "alice@example.com" {
+		t.Fatalf("sent over %s to %q, want email to alice@example.com", channel, msg.Recipient)
+	}
+	if _, _, err := s.OTPRequest(schema.OTPRequest{Email: "alice@example.com", Channel: "sms"}); !errors.Is(err, common.ErrChannelUnavailable) {
+		t.Fatalf("sms to an email error = %v, want %v", err, common.ErrChannelUnavailable)
+	}
+
+	id := schema.EmailIdentifier("alice@example.com")
+	if ok, err := s.OTPVerify(id, testOTP); !ok || err != nil {
+		t.Fatalf("OTPVerify() = %v, %v", ok, err)
+	}
+	if created, err := s.RegisterUser(id); !created || err != nil {
+		t.Fatalf("RegisterUser() = %v, %v", created, err)
+	}
+	user, err := s.findUser(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PhoneNumber != nil || !user.EmailVerified {
+		t.Fatalf("user = %+v, want a verified email-only account", user)
+	}
+}
+
+func TestEmailLink(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	s.db = newTestDB(t)
+	owner := mustRegister(t, s, schema.PhoneIdentifier(testPhone))
+	mustRegister(t, s, schema.EmailIdentifier("taken@example.com"))
+
+	if _, err := s.RequestEmailLink(owner.ID, "taken@example.com", ""); !errors.Is(err, common.ErrEmailTaken) {
+		t.Fatalf("linking a taken email error = %v, want %v", err, common.ErrEmailTaken)
+	}
+	if _, err := s.RequestEmailLink(owner.ID, "me@example.com", ""); err != nil {
+		t.Fatalf("RequestEmailLink() error = %v", err)
+	}
+	if err := s.VerifyEmailLink(owner.ID, "me@example.com", "000000"); !errors.Is(err, common.ErrCompareOTP) {
+		t.Fatalf("wrong code error = %v, want %v", err, common.ErrCompareOTP)
+	}
+	if err := s.VerifyEmailLink(owner.ID, "ME@example.com", testOTP); err != nil {
+		t.Fatalf("VerifyEmailLink() error = %v", err)
+	}
+
+	// Either identifier now finds the same account.
+	user, err := s.findUser(schema.EmailIdentifier("me@example.com"))
+	if err != nil || user.ID != owner.ID || !user.EmailVerified {
+		t.Fatalf("findUser(email) = %+v, %v; want account %d", user, err, owner.ID)
+	}
+}
+
+func TestEmailLinkAndLoginCodesAreSeparate(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	s.db = newTestDB(t)
+	owner := mustRegister(t, s, schema.PhoneIdentifier(testPhone))
+	email := schema.EmailIdentifier("shared@example.com")
+
+	if _, err := s.RequestEmailLink(owner.ID, email.Value, ""); err != nil {
+		t.Fatalf("RequestEmailLink() error = %v", err)
+	}
+	// A link code does not sign in as the address.
+	if _, err := s.OTPVerify(email, testOTP); !errors.Is(err, common.ErrGetOTP) {
+		t.Fatalf("OTPVerify() with an email link code error = %v, want %v", err, common.ErrGetOTP)
+	}
+
+	// A login code for the address neither replaces nor completes the link.
+	if _, _, err := s.OTPRequest(schema.OTPRequest{Email: email.Value}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+	if err := s.VerifyEmailLink(owner.ID, email.Value, testOTP); err != nil {
+		t.Fatalf("VerifyEmailLink() after a login code was sent error = %v", err)
+	}
+	if ok, err := s.OTPVerify(email, testOTP); !ok || err != nil {
+		t.Fatalf("OTPVerify() of the login code = %v, %v", ok, err)
+	}
+	if err := s.VerifyEmailLink(owner.ID, email.Value, testOTP); !errors.Is(err, common.ErrGetOTP) {
+		t.Fatalf("VerifyEmailLink() with a used code error = %v, want %v", err, common.ErrGetOTP)
+	}
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Token type hints defined by RFC 7009 and used by RFC 7662.
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// Introspect reports whether token, an access or refresh token issued by this
+// service, is currently active. tokenTypeHint only decides which kind is
+// looked up first.
+func (s *service) Introspect(token, tokenTypeHint string) (schema.IntrospectionResponse, error) {
+	lookups := []func(string) (schema.IntrospectionResponse, bool, error){s.introspectAccessToken, s.introspectRefreshToken}
+	if tokenTypeHint == TokenTypeRefresh {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		resp, found, err := lookup(token)
+		if err != nil {
+			return schema.IntrospectionResponse{}, err
+		}
+		if found {
+			return resp, nil
+		}
+	}
+	return schema.IntrospectionResponse{Active: false}, nil
+}
+
+func (s *service) introspectAccessToken(token string) (schema.IntrospectionResponse, bool, error) {
+	// Refresh tokens are opaque; only JWTs have three segments.
+	if strings.Count(token, ".") != 2 {
+		return schema.IntrospectionResponse{}, false, nil
+	}
+	claims, err := s.parseToken(token)
+	if err != nil {
+		return schema.IntrospectionResponse{}, false, nil
+	}
+	if s.isRevoked(claims) {
+		return schema.IntrospectionResponse{Active: false, Revoked: true}, true, nil
+	}
+	// Report the roles the user holds now, like the refresh branch, rather
+	// than those in the token, which may be stale or left out entirely.
+	roles, found, err := s.userRoles(claims)
+	if err != nil {
+		return schema.IntrospectionResponse{}, false, err
+	}
+	if !found {
+		return schema.IntrospectionResponse{Active: false}, true, nil
+	}
+
+	resp := schema.IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(roles, " "),
+		TokenType: TokenTypeAccess,
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		Exp:       claims.ExpiresAt.Unix(),
+		ACR:       claims.ACR,
+		AMR:       claims.AMR,
+	}
+	if claims.AuthTime != nil {
+		resp.AuthTime = claims.AuthTime.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		resp.Nbf = claims.NotBefore.Unix()
+	}
+	return resp, true, nil
+}
+
+// userRoles loads the roles of the user claims were issued to. found is false
+// when the account no longer exists.
+func (s *service) userRoles(claims *Claims) (roles []string, found bool, err error) {
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, false, nil
+	}
+	var users []model.User
+	if err := s.db.Select("roles").Where("id = ?", userID).Limit(1).Find(&users).Error; err != nil {
+		s.logger.Error("failed to load user roles for introspection", zap.Error(err))
+		return nil, false, err
+	}
+	if len(users) == 0 {
+		return nil, false, nil
+	}
+	return users[0].Roles, true, nil
+}
+
+func (s *service) introspectRefreshToken(token string) (schema.IntrospectionResponse, bool, error) {
+	var stored model.RefreshToken
+	err := s.db.Preload("User").Where("token_hash = ?", hashRefreshToken(token)).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return schema.IntrospectionResponse{}, false, nil
+	}
+	if err != nil {
+		s.logger.Error("failed to load refresh token for introspection", zap.Error(err))
+		return schema.IntrospectionResponse{}, false, err
+	}
+
+	if stored.RevokedAt != nil {
+		return schema.IntrospectionResponse{Active: false, Revoked: true}, true, nil
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return schema.IntrospectionResponse{Active: false}, true, nil
+	}
+
+	return schema.IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(stored.User.Roles, " "),
+		TokenType: TokenTypeRefresh,
+		Sub:       formatUserID(stored.UserID),
+		Iss:       issuer(),
+		Exp:       stored.ExpiresAt.Unix(),
+		Iat:       stored.CreatedAt.Unix(),
+	}, true, nil
+}
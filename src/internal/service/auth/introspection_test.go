@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"testing"
+
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+)
+
+func TestIntrospectActiveTokens(t *testing.T) {
+	s, user := newUserTestService(t)
+	access, refresh, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := mustValidate(t, s, access)
+
+	for _, hint := range []string{"", TokenTypeAccess, TokenTypeRefresh} {
+		resp, err := s.Introspect(access, hint)
+		if err != nil {
+			t.Fatalf("Introspect() of an access token error = %v", err)
+		}
+		if !resp.Active || resp.TokenType != TokenTypeAccess || resp.Jti != claims.ID || resp.Sub != formatUserID(user.ID) {
+			t.Fatalf("Introspect() of an access token with hint %q = %+v", hint, resp)
+		}
+		if resp.Exp != claims.ExpiresAt.Unix() || resp.AuthTime == 0 || len(resp.AMR) == 0 {
+			t.Fatalf("Introspect() of an access token dropped claims: %+v", resp)
+		}
+
+		resp, err = s.Introspect(refresh, hint)
+		if err != nil {
+			t.Fatalf("Introspect() of a refresh token error = %v", err)
+		}
+		if !resp.Active || resp.TokenType != TokenTypeRefresh || resp.Sub != formatUserID(user.ID) || resp.Iss != issuer() {
+			t.Fatalf("Introspect() of a refresh token with hint %q = %+v", hint, resp)
+		}
+	}
+
+	resp, err := s.Introspect("not-a-token", "")
+	if err != nil || resp.Active || resp.Revoked {
+		t.Fatalf("Introspect() of an unknown token = %+v, %v, want inactive", resp, err)
+	}
+}
+
+func TestIntrospectRevokedTokens(t *testing.T) {
+	s, _ := newUserTestService(t)
+	access, refresh, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	_, rotated, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if _, _, err := s.RefreshToken(rotated, schema.SessionClient{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Logout(access, refresh); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		wantRevoked bool
+	}{
+		{"logged out access token", access, true},
+		{"logged out refresh token", refresh, true},
+		{"rotated refresh token", rotated, false},
+	}
+	for _, tt := range tests {
+		resp, err := s.Introspect(tt.token, "")
+		if err != nil {
+			t.Fatalf("Introspect() of a %s error = %v", tt.name, err)
+		}
+		if resp.Active || resp.Revoked != tt.wantRevoked || resp.Sub != "" {
+			t.Errorf("Introspect() of a %s = %+v, want inactive with revoked %v", tt.name, resp, tt.wantRevoked)
+		}
+	}
+}
+
+func TestIntrospectAccessTokenScopeIsCurrentRoles(t *testing.T) {
+	s, user := newUserTestService(t)
+	access, _, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Granted after the token was issued, and not in it without
+	// JWT_CUSTOM_CLAIMS.
+	user.Roles = []string{model.RoleUser, model.RoleAdmin}
+	if err := s.db.Model(user).Select("roles").Updates(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Introspect(access, TokenTypeAccess)
+	if err != nil || !resp.Active || resp.Scope != "user admin" {
+		t.Fatalf("Introspect() = %+v, %v; want scope %q", resp, err, "user admin")
+	}
+
+	if err := s.db.Delete(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := s.Introspect(access, TokenTypeAccess); err != nil || resp.Active {
+		t.Fatalf("Introspect() of a deleted user's token = %+v, %v, want inactive", resp, err)
+	}
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/delivery"
+
+	"go.uber.org/zap"
+)
+
+const (
+	magicLinkPrefix = "magic-link:"
+
+	defaultMagicLinkTTL = 15 * time.Minute
+)
+
+// magicLinkEntry is what the in-memory store holds for an issued magic link.
+type magicLinkEntry struct {
+	email       string
+	redirectURI string
+	used        atomic.Bool
+}
+
+// magicLinkTTL returns how long a magic link works: MAGIC_LINK_TTL, or 15
+// minutes.
+func magicLinkTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("MAGIC_LINK_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultMagicLinkTTL
+}
+
+// MagicLinkCallbackFromEnv returns MAGIC_LINK_CALLBACK_URL, the public URL of
+// the magic link callback that emailed links point at. Links are never built
+// from the request, whose Host header the caller controls. In development
+// mode it defaults to the callback on localhost:PORT; elsewhere it must be
+// set.
+func MagicLinkCallbackFromEnv() (string, error) {
+	callback := os.Getenv("MAGIC_LINK_CALLBACK_URL")
+	if callback == "" {
+		if !common.DevMode() {
+			return "", errors.New("MAGIC_LINK_CALLBACK_URL is not set")
+		}
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		return "http://localhost:" + port + "/api/v1/auth/magic-link/callback", nil
+	}
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("MAGIC_LINK_CALLBACK_URL %q is not an absolute http(s) URL without query", callback)
+	}
+	return callback, nil
+}
+
+// SetMagicLinkCallback sets the URL emailed magic links point at.
+func (s *service) SetMagicLinkCallback(callbackURL string) {
+	s.magicLinkCallback = callbackURL
+}
+
+// RequestMagicLink emails a single-use sign-in link for req.Email. The link
+// points at the configured callback and carries a signed token that
+// ConsumeMagicLink accepts once before it expires. Sending counts against
+// the same limits as OTPs for the address.
+func (s *service) RequestMagicLink(req schema.MagicLinkRequest) (requestID string, err error) {
+	if s.magicLinkCallback == "" {
+		return "", common.ErrMagicLinkUnavailable
+	}
+	id := schema.EmailIdentifier(req.Email)
+	policy := s.policy
+	switch {
+	case req.ClientID != "":
+		client, err := s.client(req.ClientID)
+		if err != nil {
+			return "", err
+		}
+		if req.RedirectURI != "" && !client.AllowsRedirect(req.RedirectURI) {
+			return "", common.ErrInvalidRedirectURI
+		}
+		// Anyone can name a client; only the client itself gets its policy.
+		if req.ClientAuthenticated {
+			policy = s.policy.Merge(client.OTPPolicy)
+		}
+	case req.RedirectURI != "":
+		// Only registered clients may be redirected to.
+		return "", common.ErrInvalidRedirectURI
+	}
+	if _, err := s.pickChannel(id, delivery.ChannelEmail); err != nil {
+		return "", err
+	}
+	if err := checkOTPSendLimits(id.Value, policy); err != nil {
+		return "", err
+	}
+
+	nonce, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+	requestID, err = randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	ttl := magicLinkTTL()
+	token := s.signMagicLink(nonce, time.Now().Add(ttl))
+	link := s.magicLinkCallback + "?" + url.Values{"token": {token}}.Encode()
+
+	key := magicLinkPrefix + nonce
+	s.inMemo.Set(key, &magicLinkEntry{email: id.Value, redirectURI: req.RedirectURI}, ttl)
+	err = s.send(delivery.Message{
+		RequestID: requestID,
+		Recipient: id.Value,
+		ExpiresIn: ttl,
+		Channel:   delivery.ChannelEmail,
+		Locale:    req.Locale,
+		Link:      link,
+	})
+	if err != nil {
+		s.inMemo.Delete(key)
+		return "", err
+	}
+	s.logger.Debug("magic link sent", zap.String("recipient", id.Value), zap.String("request_id", requestID))
+	return requestID, nil
+}
+
+// ConsumeMagicLink checks token and invalidates it, returning the email
+// identifier it was issued for and the redirect URI requested with it.
+func (s *service) ConsumeMagicLink(token string) (id schema.Identifier, redirectURI string, err error) {
+	nonce, ok := s.verifyMagicLink(token, time.Now())
+	if !ok {
+		return schema.Identifier{}, "", common.ErrInvalidMagicLink
+	}
+	key := magicLinkPrefix + nonce
+	stored, ok := s.inMemo.Get(key)
+	if !ok {
+		return schema.Identifier{}, "", common.ErrInvalidMagicLink
+	}
+	entry, ok := stored.(*magicLinkEntry)
+	// A link is single use: only the first click wins.
+	if !ok || !entry.used.CompareAndSwap(false, true) {
+		return schema.Identifier{}, "", common.ErrInvalidMagicLink
+	}
+	s.inMemo.Delete(key)
+	return schema.EmailIdentifier(entry.email), entry.redirectURI, nil
+}
+
+// signMagicLink returns the token of a link: nonce, expiry and an HMAC of
+// both under the OTP key, so tampered or forged links are rejected before the
+// store is consulted.
+func (s *service) signMagicLink(nonce string, expires time.Time) string {
+	payload := nonce + "." + strconv.FormatInt(expires.Unix(), 36)
+	return payload + "." + s.magicLinkMAC(payload)
+}
+
+// verifyMagicLink returns the nonce of token if its signature is valid and it
+// has not expired at now.
+func (s *service) verifyMagicLink(token string, now time.Time) (nonce string, ok bool) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, mac := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(s.magicLinkMAC(payload))) {
+		return "", false
+	}
+	nonce, expiry, _ := strings.Cut(payload, ".")
+	expires, err := strconv.ParseInt(expiry, 36, 64)
+	if err != nil || now.Unix() >= expires {
+		return "", false
+	}
+	return nonce, true
+}
+
+func (s *service) magicLinkMAC(payload string) string {
+	mac := hmac.New(sha256.New, s.otpKey)
+	mac.Write([]byte("magic-link\x00"))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/delivery"
+)
+
+const testCallbackURL = "https://auth.example.com/api/v1/auth/magic-link/callback"
+
+// sentMagicLinkToken returns the token of the last link s sent.
+func sentMagicLinkToken(t *testing.T, s *service) string {
+	t.Helper()
+	msg, ok := s.sender.(*delivery.RecordingSender).Last()
+	if !ok {
+		t.Fatal("no magic link was sent")
+	}
+	link, err := url.Parse(msg.Link)
+	if err != nil || !strings.HasPrefix(msg.Link, testCallbackURL+"?") {
+		t.Fatalf("sent link %q, want one to %s", msg.Link, testCallbackURL)
+	}
+	return link.Query().Get("token")
+}
+
+func TestMagicLink(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+
+	if _, err := s.RequestMagicLink(schema.MagicLinkRequest{Email: "Bob@Example.com"}); err != nil {
+		t.Fatalf("RequestMagicLink() error = %v", err)
+	}
+	msg, _ := s.sender.(*delivery.RecordingSender).Last()
+	if msg.Recipient != "bob@example.com" || msg.DeliveryChannel() != delivery.ChannelEmail || msg.Code != "" {
+		t.Fatalf("sent %+v, want a link by email to bob@example.com", msg)
+	}
+	token := sentMagicLinkToken(t, s)
+
+	if _, _, err := s.ConsumeMagicLink(token[:len(token)-2] + "xx"); !errors.Is(err, common.ErrInvalidMagicLink) {
+		t.Fatalf("tampered link error = %v, want %v", err, common.ErrInvalidMagicLink)
+	}
+	id, redirectURI, err := s.ConsumeMagicLink(token)
+	if err != nil {
+		t.Fatalf("ConsumeMagicLink() error = %v", err)
+	}
+	if id != schema.EmailIdentifier("bob@example.com") || redirectURI != "" {
+		t.Fatalf("ConsumeMagicLink() = %+v, %q", id, redirectURI)
+	}
+	if _, _, err := s.ConsumeMagicLink(token); !errors.Is(err, common.ErrInvalidMagicLink) {
+		t.Fatalf("reused link error = %v, want %v", err, common.ErrInvalidMagicLink)
+	}
+}
+
+func TestMagicLinkExpiry(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	token := s.signMagicLink("nonce", time.Now().Add(time.Minute))
+
+	if nonce, ok := s.verifyMagicLink(token, time.Now()); !ok || nonce != "nonce" {
+		t.Fatalf("verifyMagicLink() = %q, %v; want nonce, true", nonce, ok)
+	}
+	if _, ok := s.verifyMagicLink(token, time.Now().Add(2*time.Minute)); ok {
+		t.Fatal("expired link accepted")
+	}
+	other := &service{otpKey: []byte("other-key")}
+	if _, ok := other.verifyMagicLink(token, time.Now()); ok {
+		t.Fatal("link signed under another key accepted")
+	}
+}
+
+func TestMagicLinkRedirectURI(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	s.db = newTestDB(t)
+	client := model.Client{ClientID: "web", SecretHash: "x", RedirectURIs: []string{"https://app.example.com/signed-in"}}
+	if err := s.db.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  schema.MagicLinkRequest
+		want error
+	}{
+		{"without client", schema.MagicLinkRequest{RedirectURI: "https://app.example.com/signed-in"}, common.ErrInvalidRedirectURI},
+		{"unregistered", schema.MagicLinkRequest{ClientID: "web", RedirectURI: "https://evil.example.com/"}, common.ErrInvalidRedirectURI},
+		{"unknown client", schema.MagicLinkRequest{ClientID: "nope", RedirectURI: "https://app.example.com/signed-in"}, common.ErrInvalidClient},
+		{"registered", schema.MagicLinkRequest{ClientID: "web", RedirectURI: "https://app.example.com/signed-in"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Email = "bob@example.com"
+			if _, err := s.RequestMagicLink(tt.req); !errors.Is(err, tt.want) {
+				t.Fatalf("RequestMagicLink() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	_, redirectURI, err := s.ConsumeMagicLink(sentMagicLinkToken(t, s))
+	if err != nil || redirectURI != "https://app.example.com/signed-in" {
+		t.Fatalf("ConsumeMagicLink() = %q, %v", redirectURI, err)
+	}
+}
+
+func TestMagicLinkClientPolicyNeedsAuthentication(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	s.db = newTestDB(t)
+	client := model.Client{ClientID: "web", SecretHash: "x", OTPPolicy: model.OTPPolicy{MaxSends: 1, SendWindow: time.Minute}}
+	if err := s.db.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		email         string
+		authenticated bool
+		wantLimited   bool
+	}{
+		{"named@example.com", false, false},
+		{"authenticated@example.com", true, true},
+	}
+	for _, tt := range tests {
+		req := schema.MagicLinkRequest{Email: tt.email, ClientID: "web", ClientAuthenticated: tt.authenticated}
+		if _, err := s.RequestMagicLink(req); err != nil {
+			t.Fatalf("RequestMagicLink() authenticated=%v error = %v", tt.authenticated, err)
+		}
+		_, err := s.RequestMagicLink(req)
+		if limited := errors.Is(err, common.ErrOTPRateLimited); limited != tt.wantLimited {
+			t.Fatalf("second RequestMagicLink() authenticated=%v error = %v, want the client's send limit only when authenticated", tt.authenticated, err)
+		}
+	}
+}
+
+func TestMagicLinkCallbackFromEnv(t *testing.T) {
+	tests := []struct {
+		env, callback, port string
+		want                string
+		wantErr             bool
+	}{
+		{"production", "", "", "", true},
+		{"production", testCallbackURL, "", testCallbackURL, false},
+		{"production", "/api/v1/auth/magic-link/callback", "", "", true},
+		{"production", "javascript:alert(1)", "", "", true},
+		{"development", "", "9000", "http://localhost:9000/api/v1/auth/magic-link/callback", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("APP_ENV", tt.env)
+		t.Setenv("MAGIC_LINK_CALLBACK_URL", tt.callback)
+		t.Setenv("PORT", tt.port)
+		got, err := MagicLinkCallbackFromEnv()
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("MagicLinkCallbackFromEnv() with APP_ENV=%s MAGIC_LINK_CALLBACK_URL=%q = %q, %v", tt.env, tt.callback, got, err)
+		}
+	}
+}
+
+func TestMagicLinkUnconfigured(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	s.SetMagicLinkCallback("")
+	if _, err := s.RequestMagicLink(schema.MagicLinkRequest{Email: "bob@example.com"}); !errors.Is(err, common.ErrMagicLinkUnavailable) {
+		t.Fatalf("RequestMagicLink() without a callback error = %v, want %v", err, common.ErrMagicLinkUnavailable)
+	}
+}
@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaChallengePrefix = "mfa:"
+	totpFailuresPrefix = "totp-failures:"
+	// mfaChallengeTTL is how long a login waits for its second factor.
+	mfaChallengeTTL = 5 * time.Minute
+	mfaMaxAttempts  = 5
+
+	recoveryCodeCount = 10
+	// Recovery codes are two groups of five characters: 50 random bits.
+	recoveryCodeGroup    = 5
+	recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+)
+
+// mfaChallenge is what the in-memory store holds for a login waiting for its
+// second factor.
+type mfaChallenge struct {
+	userID   uint8
+	method   string       // how the first factor was proven
+	attempts atomic.Int32 // second factors checked so far
+	used     atomic.Bool
+}
+
+// EnrollTOTP starts enrolling an authenticator app for the user with userID,
+// replacing an unconfirmed enrollment. The factor is not asked for at login
+// until ConfirmTOTP succeeds.
+func (s *service) EnrollTOTP(userID uint8) (schema.TOTPEnrollment, error) {
+	if s.mfaKey == nil {
+		return schema.TOTPEnrollment{}, common.ErrMFAUnavailable
+	}
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return schema.TOTPEnrollment{}, err
+	}
+	factor, err := s.totpFactor(userID)
+	if err == nil && factor.ConfirmedAt != nil {
+		return schema.TOTPEnrollment{}, common.ErrMFAAlreadyEnrolled
+	}
+	if err != nil && !errors.Is(err, common.ErrMFANotEnrolled) {
+		return schema.TOTPEnrollment{}, err
+	}
+
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return schema.TOTPEnrollment{}, err
+	}
+	sealed, err := s.sealTOTPSecret(secret)
+	if err != nil {
+		return schema.TOTPEnrollment{}, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.TOTPFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.TOTPFactor{UserID: userID, Secret: sealed}).Error
+	})
+	if err != nil {
+		s.logger.Error("failed to store totp factor", zap.Error(err))
+		return schema.TOTPEnrollment{}, err
+	}
+
+	account := ""
+	if user.Email != nil {
+		account = *user.Email
+	}
+	if user.PhoneNumber != nil {
+		account = *user.PhoneNumber
+	}
+	return schema.TOTPEnrollment{
+		Secret:          totpEncoding.EncodeToString(secret),
+		ProvisioningURI: totpProvisioningURI(appName(), account, secret),
+	}, nil
+}
+
+// ConfirmTOTP checks a first code from the authenticator app being enrolled
+// and turns the factor on. It returns the user's recovery codes, which are
+// only stored hashed and cannot be shown again.
+func (s *service) ConfirmTOTP(userID uint8, code string) (recoveryCodes []string, err error) {
+	factor, err := s.totpFactor(userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor.ConfirmedAt != nil {
+		return nil, common.ErrMFAAlreadyEnrolled
+	}
+	if err := s.guessSecondFactor(factor, code, ""); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes = make([]string, recoveryCodeCount)
+	records := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range recoveryCodes {
+		if recoveryCodes[i], err = randomRecoveryCode(); err != nil {
+			return nil, err
+		}
+		records[i] = model.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(recoveryCodes[i])}
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(factor).Update("confirmed_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		s.logger.Error("failed to confirm totp factor", zap.Error(err))
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// DisableTOTP removes the authenticator app and recovery codes of the user
+// with userID after checking a current code or a recovery code.
+func (s *service) DisableTOTP(userID uint8, code, recoveryCode string) error {
+	factor, err := s.totpFactor(userID)
+	if err != nil {
+		return err
+	}
+	if factor.ConfirmedAt != nil {
+		if err := s.guessSecondFactor(factor, code, recoveryCode); err != nil {
+			return err
+		}
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(factor).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+// MFAChallenge returns a short-lived token for completing the login of id,
+// which proved its first factor with method, with CompleteMFA when the
+// account has a confirmed authenticator app, and an empty string when it
+// does not.
+func (s *service) MFAChallenge(id schema.Identifier, method string) (mfaToken string, err error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return "", err
+	}
+	factor, err := s.totpFactor(user.ID)
+	if errors.Is(err, common.ErrMFANotEnrolled) || (err == nil && factor.ConfirmedAt == nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if mfaToken, err = randomToken(32); err != nil {
+		return "", err
+	}
+	s.inMemo.Set(mfaChallengePrefix+mfaToken, &mfaChallenge{userID: user.ID, method: method}, mfaChallengeTTL)
+	return mfaToken, nil
+}
+
+// CompleteMFA checks the second factor of the login waiting under
+// req.MFAToken and starts a session on client. After mfaMaxAttempts wrong
+// codes the login has to start over.
+func (s *service) CompleteMFA(req schema.MFAVerifyRequest, client schema.SessionClient) (accessToken, refreshToken string, err error) {
+	key := mfaChallengePrefix + req.MFAToken
+	stored, ok := s.inMemo.Get(key)
+	if !ok {
+		return "", "", common.ErrInvalidMFAToken
+	}
+	challenge, ok := stored.(*mfaChallenge)
+	if !ok {
+		return "", "", common.ErrInvalidMFAToken
+	}
+
+	factor, err := s.totpFactor(challenge.userID)
+	if err != nil {
+		return "", "", err
+	}
+	attempt, ok := takeAttempt(&challenge.attempts, mfaMaxAttempts)
+	if !ok {
+		s.inMemo.Delete(key)
+		return "", "", common.ErrMFAAttemptsExceeded
+	}
+	ok, err = s.checkSecondFactor(factor, req.Code, req.RecoveryCode)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		if attempt == mfaMaxAttempts {
+			s.inMemo.Delete(key)
+			return "", "", common.ErrMFAAttemptsExceeded
+		}
+		return "", "", common.ErrInvalidMFACode
+	}
+	if !challenge.used.CompareAndSwap(false, true) {
+		return "", "", common.ErrInvalidMFAToken
+	}
+	s.inMemo.Delete(key)
+
+	var user model.User
+	if err := s.db.First(&user, challenge.userID).Error; err != nil {
+		return "", "", err
+	}
+	return s.issueSession(&user, newAuthentication(challenge.method, schema.MethodOTP, schema.MethodMFA), client)
+}
+
+func (s *service) totpFactor(userID uint8) (*model.TOTPFactor, error) {
+	var factors []model.TOTPFactor
+	if err := s.db.Where("user_id = ?", userID).Limit(1).Find(&factors).Error; err != nil {
+		s.logger.Error("failed to load totp factor", zap.Error(err))
+		return nil, err
+	}
+	if len(factors) == 0 {
+		return nil, common.ErrMFANotEnrolled
+	}
+	return &factors[0], nil
+}
+
+// checkSecondFactor checks code against the authenticator app, or when code
+// is empty, recoveryCode against the unused recovery codes.
+func (s *service) checkSecondFactor(factor *model.TOTPFactor, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		return s.checkTOTP(factor, code)
+	}
+	return s.useRecoveryCode(factor.UserID, recoveryCode)
+}
+
+// guessSecondFactor checks a code or recovery code against factor outside a
+// login: to step up, or to confirm or remove the factor. After
+// mfaMaxAttempts wrong guesses, across all of these, guesses are refused for
+// mfaChallengeTTL, so a stolen access token cannot be used to guess codes. A
+// right guess clears the count.
+func (s *service) guessSecondFactor(factor *model.TOTPFactor, code, recoveryCode string) error {
+	key := totpFailuresPrefix + formatUserID(factor.UserID)
+	if _, ok := takeAttempt(s.storedAttempts(key, mfaChallengeTTL), mfaMaxAttempts); !ok {
+		return common.ErrMFAAttemptsExceeded
+	}
+	ok, err := s.checkSecondFactor(factor, code, recoveryCode)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return common.ErrInvalidMFACode
+	}
+	s.inMemo.Delete(key)
+	return nil
+}
+
+// checkTOTP checks code against factor and records its step, so the same
+// code cannot be used twice.
+func (s *service) checkTOTP(factor *model.TOTPFactor, code string) (bool, error) {
+	secret, err := s.openTOTPSecret(factor.Secret)
+	if err != nil {
+		s.logger.Error("failed to decrypt totp secret", zap.Uint8("user_id", factor.UserID), zap.Error(err))
+		return false, err
+	}
+	step, ok := totpMatch(secret, code, time.Now())
+	if !ok || step <= factor.LastStep {
+		return false, nil
+	}
+	// Of two logins racing with the same code, only one moves last_step.
+	res := s.db.Model(&model.TOTPFactor{}).
+		Where("id = ? AND last_step < ?", factor.ID, step).
+		Update("last_step", step)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	factor.LastStep = step
+	return res.RowsAffected == 1, nil
+}
+
+// useRecoveryCode marks code used if it is one of userID's unused recovery
+// codes.
+func (s *service) useRecoveryCode(userID uint8, code string) (bool, error) {
+	if code == "" {
+		return false, nil
+	}
+	res := s.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		s.logger.Info("recovery code used", zap.Uint8("user_id", userID))
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func randomRecoveryCode() (string, error) {
+	var b strings.Builder
+	size := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := range 2 * recoveryCodeGroup {
+		if i == recoveryCodeGroup {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// hashRecoveryCode hashes code ignoring case, spaces and dashes. Codes carry
+// 50 random bits, so a plain SHA-256 is enough.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte("recovery-code\x00" + code))
+	return hex.EncodeToString(sum[:])
+}
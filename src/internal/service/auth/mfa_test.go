@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+)
+
+// enrollTOTP gives user a confirmed authenticator app and returns its secret
+// and recovery codes.
+func enrollTOTP(t *testing.T, s *service, user *model.User) (secret []byte, recoveryCodes []string) {
+	t.Helper()
+	enrollment, err := s.EnrollTOTP(user.ID)
+	if err != nil {
+		t.Fatalf("EnrollTOTP() error = %v", err)
+	}
+	if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/") {
+		t.Fatalf("ProvisioningURI = %q", enrollment.ProvisioningURI)
+	}
+	secret, _ = totpEncoding.DecodeString(enrollment.Secret)
+
+	// An unconfirmed factor is not asked for at login.
+	if token, err := s.MFAChallenge(schema.PhoneIdentifier(testPhone), schema.MethodOTP); token != "" || err != nil {
+		t.Fatalf("MFAChallenge() before confirming = %q, %v", token, err)
+	}
+	if _, err := s.ConfirmTOTP(user.ID, "000000"); !errors.Is(err, common.ErrInvalidMFACode) {
+		t.Fatalf("ConfirmTOTP() with a wrong code error = %v, want %v", err, common.ErrInvalidMFACode)
+	}
+	// Confirm with the previous step's code so tests can use the current one.
+	recoveryCodes, err = s.ConfirmTOTP(user.ID, totpCode(secret, totpStep(time.Now())-1))
+	if err != nil {
+		t.Fatalf("ConfirmTOTP() error = %v", err)
+	}
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(recoveryCodes), recoveryCodeCount)
+	}
+	return secret, recoveryCodes
+}
+
+func TestMFALogin(t *testing.T) {
+	s, user := newUserTestService(t)
+	secret, recoveryCodes := enrollTOTP(t, s, user)
+
+	token, err := s.MFAChallenge(schema.PhoneIdentifier(testPhone), schema.MethodOTP)
+	if err != nil || token == "" {
+		t.Fatalf("MFAChallenge() = %q, %v; want a token", token, err)
+	}
+	if _, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, Code: "000000"}, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidMFACode) {
+		t.Fatalf("CompleteMFA() with a wrong code error = %v, want %v", err, common.ErrInvalidMFACode)
+	}
+	code := totpCode(secret, totpStep(time.Now()))
+	access, refresh, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, Code: code}, schema.SessionClient{})
+	if err != nil || access == "" || refresh == "" {
+		t.Fatalf("CompleteMFA() = %q, %q, %v", access, refresh, err)
+	}
+	if _, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, Code: code}, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidMFAToken) {
+		t.Fatalf("reused mfa token error = %v, want %v", err, common.ErrInvalidMFAToken)
+	}
+
+	// A TOTP code works once, a recovery code too.
+	token, _ = s.MFAChallenge(schema.PhoneIdentifier(testPhone), schema.MethodOTP)
+	if _, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, Code: code}, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidMFACode) {
+		t.Fatalf("replayed totp code error = %v, want %v", err, common.ErrInvalidMFACode)
+	}
+	recovery := strings.ToUpper(recoveryCodes[0])
+	if _, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, RecoveryCode: recovery}, schema.SessionClient{}); err != nil {
+		t.Fatalf("CompleteMFA() with a recovery code error = %v", err)
+	}
+	token, _ = s.MFAChallenge(schema.PhoneIdentifier(testPhone), schema.MethodOTP)
+	if _, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, RecoveryCode: recovery}, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidMFACode) {
+		t.Fatalf("reused recovery code error = %v, want %v", err, common.ErrInvalidMFACode)
+	}
+
+	var stored []model.RecoveryCode
+	s.db.Find(&stored)
+	for _, code := range stored {
+		if code.CodeHash == recoveryCodes[0] || code.CodeHash == recovery {
+			t.Fatal("recovery code stored in plaintext")
+		}
+	}
+}
+
+func TestMFAChallengeBurnsAfterMaxAttempts(t *testing.T) {
+	s, user := newUserTestService(t)
+	enrollTOTP(t, s, user)
+
+	token, _ := s.MFAChallenge(schema.PhoneIdentifier(testPhone), schema.MethodOTP)
+	for attempt := 1; attempt < mfaMaxAttempts; attempt++ {
+		if _, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, RecoveryCode: "wrong"}, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidMFACode) {
+			t.Fatalf("attempt %d error = %v", attempt, err)
+		}
+	}
+	if _, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, RecoveryCode: "wrong"}, schema.SessionClient{}); !errors.Is(err, common.ErrMFAAttemptsExceeded) {
+		t.Fatalf("last attempt error = %v, want %v", err, common.ErrMFAAttemptsExceeded)
+	}
+	if _, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, RecoveryCode: "wrong"}, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidMFAToken) {
+		t.Fatalf("burned token error = %v, want %v", err, common.ErrInvalidMFAToken)
+	}
+}
+
+// runParallel calls f n times at once and returns the errors.
+func runParallel(n int, f func(i int) error) []error {
+	start := make(chan struct{})
+	results := make(chan error, n)
+	for i := range n {
+		go func() {
+			<-start
+			results <- f(i)
+		}()
+	}
+	close(start)
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = <-results
+	}
+	return errs
+}
+
+func TestCompleteMFAParallelGuesses(t *testing.T) {
+	s, user := newUserTestService(t)
+	enrollTOTP(t, s, user)
+	token, _ := s.MFAChallenge(schema.PhoneIdentifier(testPhone), schema.MethodOTP)
+
+	compared := 0
+	for _, err := range runParallel(32, func(int) error {
+		_, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, RecoveryCode: "wrong"}, schema.SessionClient{})
+		return err
+	}) {
+		switch {
+		case errors.Is(err, common.ErrInvalidMFACode):
+			compared++
+		case errors.Is(err, common.ErrMFAAttemptsExceeded), errors.Is(err, common.ErrInvalidMFAToken):
+		default:
+			t.Fatalf("CompleteMFA() error = %v", err)
+		}
+	}
+	if compared != mfaMaxAttempts-1 {
+		t.Fatalf("%d parallel guesses were rejected as wrong before burning, want %d", compared, mfaMaxAttempts-1)
+	}
+}
+
+func TestCompleteMFAChecksAttemptsBeforeComparing(t *testing.T) {
+	s, user := newUserTestService(t)
+	_, recoveryCodes := enrollTOTP(t, s, user)
+	token, _ := s.MFAChallenge(schema.PhoneIdentifier(testPhone), schema.MethodOTP)
+
+	// A guess that loaded the challenge before another burned it still
+	// finds it.
+	stored, _ := s.inMemo.Get(mfaChallengePrefix + token)
+	stored.(*mfaChallenge).attempts.Store(mfaMaxAttempts)
+	_, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: token, RecoveryCode: recoveryCodes[0]}, schema.SessionClient{})
+	if !errors.Is(err, common.ErrMFAAttemptsExceeded) {
+		t.Fatalf("CompleteMFA() with the right code after the last attempt error = %v, want %v", err, common.ErrMFAAttemptsExceeded)
+	}
+	if ok, err := s.useRecoveryCode(user.ID, recoveryCodes[0]); !ok || err != nil {
+		t.Fatalf("recovery code spent by a refused attempt: %v, %v", ok, err)
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	s, user := newUserTestService(t)
+	_, recoveryCodes := enrollTOTP(t, s, user)
+
+	if err := s.DisableTOTP(user.ID, "", "wrong"); !errors.Is(err, common.ErrInvalidMFACode) {
+		t.Fatalf("DisableTOTP() with a wrong code error = %v, want %v", err, common.ErrInvalidMFACode)
+	}
+	if err := s.DisableTOTP(user.ID, "", recoveryCodes[3]); err != nil {
+		t.Fatalf("DisableTOTP() error = %v", err)
+	}
+	if token, err := s.MFAChallenge(schema.PhoneIdentifier(testPhone), schema.MethodOTP); token != "" || err != nil {
+		t.Fatalf("MFAChallenge() after disabling = %q, %v", token, err)
+	}
+	var left int64
+	s.db.Model(&model.RecoveryCode{}).Count(&left)
+	if left != 0 {
+		t.Fatalf("%d recovery codes left after disabling", left)
+	}
+}
+
+func TestConfirmTOTPLimitsGuesses(t *testing.T) {
+	s, user := newUserTestService(t)
+	enrollment, err := s.EnrollTOTP(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := totpEncoding.DecodeString(enrollment.Secret)
+
+	for i := 0; i < mfaMaxAttempts; i++ {
+		if _, err := s.ConfirmTOTP(user.ID, "000000"); !errors.Is(err, common.ErrInvalidMFACode) {
+			t.Fatalf("attempt %d error = %v, want %v", i+1, err, common.ErrInvalidMFACode)
+		}
+	}
+	if _, err := s.ConfirmTOTP(user.ID, totpCode(secret, totpStep(time.Now()))); !errors.Is(err, common.ErrMFAAttemptsExceeded) {
+		t.Fatalf("ConfirmTOTP() after too many wrong codes error = %v, want %v", err, common.ErrMFAAttemptsExceeded)
+	}
+}
+
+func TestDisableTOTPSharesGuessesWithStepUp(t *testing.T) {
+	s, user := newUserTestService(t)
+	_, recoveryCodes := enrollTOTP(t, s, user)
+	access, _, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < mfaMaxAttempts-1; i++ {
+		if err := s.DisableTOTP(user.ID, "", "wrong"); !errors.Is(err, common.ErrInvalidMFACode) {
+			t.Fatalf("attempt %d error = %v, want %v", i+1, err, common.ErrInvalidMFACode)
+		}
+	}
+	if _, err := s.StepUp(access, schema.StepUpRequest{Code: "000000"}); !errors.Is(err, common.ErrInvalidMFACode) {
+		t.Fatalf("StepUp() with a wrong code error = %v, want %v", err, common.ErrInvalidMFACode)
+	}
+	if err := s.DisableTOTP(user.ID, "", recoveryCodes[0]); !errors.Is(err, common.ErrMFAAttemptsExceeded) {
+		t.Fatalf("DisableTOTP() after too many wrong codes error = %v, want %v", err, common.ErrMFAAttemptsExceeded)
+	}
+	// The refused guess did not use up the recovery code.
+	if ok, err := s.useRecoveryCode(user.ID, recoveryCodes[0]); !ok || err != nil {
+		t.Fatalf("useRecoveryCode() after a refused guess = %v, %v", ok, err)
+	}
+}
+
+func TestDisableTOTPParallelGuesses(t *testing.T) {
+	s, user := newUserTestService(t)
+	enrollTOTP(t, s, user)
+
+	compared := 0
+	for _, err := range runParallel(32, func(int) error {
+		return s.DisableTOTP(user.ID, "000000", "")
+	}) {
+		switch {
+		case errors.Is(err, common.ErrInvalidMFACode):
+			compared++
+		case errors.Is(err, common.ErrMFAAttemptsExceeded):
+		default:
+			t.Fatalf("DisableTOTP() error = %v", err)
+		}
+	}
+	if compared != mfaMaxAttempts {
+		t.Fatalf("%d parallel guesses were checked, want %d", compared, mfaMaxAttempts)
+	}
+}
+
+func TestEnrollTOTPWithoutKey(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	s.db = newTestDB(t)
+	s.mfaKey = nil
+	if _, err := s.EnrollTOTP(1); !errors.Is(err, common.ErrMFAUnavailable) {
+		t.Fatalf("EnrollTOTP() error = %v, want %v", err, common.ErrMFAUnavailable)
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/utils/ratelimit"
+
+	"go.uber.org/zap"
+)
+
+const (
+	otpPrefix       = "otp:"
+	otpResendPrefix = "otp:resend:"
+	otpSendsPrefix  = "otp:sends:"
+	// emailLinkOTPPrefix holds the codes proving ownership of an email
+	// address being linked, which must not sign anyone in.
+	emailLinkOTPPrefix = "email-link:"
+
+	// otpSendTimeout bounds how long a request waits for the OTP sender
+	// unless SetSendTimeout gives another budget.
+	otpSendTimeout = 15 * time.Second
+
+	numericAlphabet = "0123456789"
+	// alphanumericAlphabet leaves out characters that are easily confused:
+	// 0/O and 1/I.
+	alphanumericAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+// defaultOTPPolicy is used for whatever the environment leaves unset.
+var defaultOTPPolicy = model.OTPPolicy{
+	Length:            6,
+	Alphabet:          model.AlphabetNumeric,
+	TTL:               2 * time.Minute,
+	MaxSends:          3,
+	SendWindow:        10 * time.Minute,
+	MaxVerifyAttempts: 5,
+}
+
+// otpEntry is what the in-memory store holds for an issued OTP. attempts
+// counts every verification, successful or not.
+type otpEntry struct {
+	hash        string
+	maxAttempts int32
+	attempts    atomic.Int32
+	used        atomic.Bool
+}
+
+// otpPolicyFromEnv returns the server's OTP policy: OTP_LENGTH,
+// OTP_ALPHABET, OTP_TTL, OTP_RESEND_INTERVAL, OTP_MAX_SENDS per
+// OTP_SEND_WINDOW and OTP_MAX_ATTEMPTS over defaultOTPPolicy. Invalid values
+// are ignored. OTP_RESEND_INTERVAL and OTP_MAX_SENDS are disabled by 0.
+func otpPolicyFromEnv() model.OTPPolicy {
+	policy := defaultOTPPolicy
+	if n, err := strconv.Atoi(os.Getenv("OTP_LENGTH")); err == nil && n >= model.MinOTPLength && n <= model.MaxOTPLength {
+		policy.Length = n
+	}
+	if alphabet := os.Getenv("OTP_ALPHABET"); alphabet == model.AlphabetNumeric || alphabet == model.AlphabetAlphanumeric {
+		policy.Alphabet = alphabet
+	}
+	if d, err := time.ParseDuration(os.Getenv("OTP_TTL")); err == nil && d > 0 {
+		policy.TTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("OTP_RESEND_INTERVAL")); err == nil && d >= 0 {
+		policy.ResendInterval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("OTP_MAX_SENDS")); err == nil && n >= 0 {
+		policy.MaxSends = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("OTP_SEND_WINDOW")); err == nil && d > 0 {
+		policy.SendWindow = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("OTP_MAX_ATTEMPTS")); err == nil && n > 0 {
+		policy.MaxVerifyAttempts = n
+	}
+	return policy
+}
+
+// otpPolicy returns the policy for OTPs requested by clientID: the server's,
+// overridden by the client's when clientID is set. clientID must have been
+// authenticated.
+func (s *service) otpPolicy(clientID string) (model.OTPPolicy, error) {
+	if clientID == "" {
+		return s.policy, nil
+	}
+	client, err := s.client(clientID)
+	if err != nil {
+		return model.OTPPolicy{}, err
+	}
+	return s.policy.Merge(client.OTPPolicy), nil
+}
+
+// client returns the registered client with clientID, or
+// common.ErrInvalidClient.
+func (s *service) client(clientID string) (*model.Client, error) {
+	var clients []model.Client
+	if err := s.db.Where("client_id = ?", clientID).Limit(1).Find(&clients).Error; err != nil {
+		s.logger.Error("failed to load client", zap.Error(err))
+		return nil, err
+	}
+	if len(clients) == 0 {
+		return nil, common.ErrInvalidClient
+	}
+	return &clients[0], nil
+}
+
+// checkOTPSendLimits enforces the resend interval and the sends per window
+// of policy for phoneNumber.
+func checkOTPSendLimits(phoneNumber string, policy model.OTPPolicy) error {
+	if seconds := int64(policy.ResendInterval / time.Second); seconds > 0 {
+		if limited, retryAfter := ratelimit.RateLimit(otpResendPrefix+phoneNumber, 1, seconds); limited {
+			return &common.RetryAfterError{Err: common.ErrOTPResendTooSoon, RetryAfter: time.Duration(retryAfter) * time.Second}
+		}
+	}
+	if seconds := int64(policy.SendWindow / time.Second); policy.MaxSends > 0 && seconds > 0 {
+		if limited, retryAfter := ratelimit.RateLimit(otpSendsPrefix+phoneNumber, policy.MaxSends, seconds); limited {
+			return &common.RetryAfterError{Err: common.ErrOTPRateLimited, RetryAfter: time.Duration(retryAfter) * time.Second}
+		}
+	}
+	return nil
+}
+
+// otpKeyFromEnv returns OTP_HMAC_KEY. Without it a random key is generated;
+// that is enough for a single instance because OTPs only live in memory.
+func otpKeyFromEnv() []byte {
+	if key := os.Getenv("OTP_HMAC_KEY"); key != "" {
+		return []byte(key)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate OTP key: %v", err))
+	}
+	return key
+}
+
+// hashOTP returns the keyed HMAC of otpCode bound to phoneNumber, which is
+// what gets stored instead of the code. Codes are case-insensitive.
+func (s *service) hashOTP(phoneNumber, otpCode string) string {
+	mac := hmac.New(sha256.New, s.otpKey)
+	mac.Write([]byte(phoneNumber))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToUpper(otpCode)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// compareOTP checks otpCode against the stored hash in constant time.
+func (s *service) compareOTP(phoneNumber, otpCode, otpHash string) bool {
+	return hmac.Equal([]byte(s.hashOTP(phoneNumber, otpCode)), []byte(otpHash))
+}
+
+// randomOTP returns a uniformly random code of length characters from
+// alphabet, a model.Alphabet* name.
+func randomOTP(length int, alphabet string) (string, error) {
+	chars := numericAlphabet
+	if alphabet == model.AlphabetAlphanumeric {
+		chars = alphanumericAlphabet
+	}
+	max := big.NewInt(int64(len(chars)))
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = chars[n.Int64()]
+	}
+	return string(code), nil
+}
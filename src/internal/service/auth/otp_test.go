@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/delivery"
+	inmemory "goAuth/internal/service/in-memory"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const (
+	testPhone = "+989123456789"
+	testOTP   = "482913"
+)
+
+func newOTPTestService(t *testing.T) (*service, *inmemory.InMemoryStore, *observer.ObservedLogs) {
+	t.Helper()
+	t.Setenv("OTP_HMAC_KEY", "test-key")
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	store := inmemory.NewInMemoryStore()
+	s := NewAuthenticationService(nil, store, nil, &delivery.RecordingSender{}, nil)
+	s.logger = zap.New(core)
+	s.generateOTP = func(int, string) (string, error) { return testOTP, nil }
+	s.SetMagicLinkCallback(testCallbackURL)
+	// Send limits are global per number; tests covering them use their own.
+	s.policy.MaxSends = 0
+	return s, store, logs
+}
+
+// logsContain reports whether needle appears in any logged message or field.
+func logsContain(logs *observer.ObservedLogs, needle string) bool {
+	for _, entry := range logs.All() {
+		if strings.Contains(entry.Message, needle) {
+			return true
+		}
+		for _, value := range entry.ContextMap() {
+			if strings.Contains(fmt.Sprint(value), needle) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestOTPRequestStoresHashOnly(t *testing.T) {
+	s, store, _ := newOTPTestService(t)
+
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+
+	if _, ok := store.Get(testPhone); ok {
+		t.Fatal("OTP stored under the bare phone number")
+	}
+	stored, ok := store.Get(otpPrefix + testPhone)
+	if !ok {
+		t.Fatal("no OTP stored")
+	}
+	entry, ok := stored.(*otpEntry)
+	if !ok {
+		t.Fatalf("stored value has type %T, want *otpEntry", stored)
+	}
+	if entry.hash == testOTP {
+		t.Fatal("plaintext OTP reached the store")
+	}
+	if entry.hash != s.hashOTP(testPhone, testOTP) {
+		t.Fatalf("stored hash = %q, want the OTP HMAC", entry.hash)
+	}
+}
+
+func TestOTPRequestSendsCode(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+
+	requestID, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone})
+	if err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+
+	msg, ok := s.sender.(*delivery.RecordingSender).Last()
+	if !ok {
+		t.Fatal("no OTP was sent")
+	}
+	if msg.Recipient != testPhone || msg.Code != testOTP || msg.RequestID != requestID || requestID == "" {
+		t.Fatalf("sent %+v, want code %s to %s with request id %q", msg, testOTP, testPhone, requestID)
+	}
+}
+
+func TestOTPRequestDeliveryFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		sendErr error
+		want    error
+	}{
+		{"temporary", fmt.Errorf("%w: timeout", delivery.ErrTemporary), common.ErrOTPDeliveryUnavailable},
+		{"permanent", fmt.Errorf("%w: invalid number", delivery.ErrPermanent), common.ErrOTPDeliveryFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store, _ := newOTPTestService(t)
+			s.sender.(*delivery.RecordingSender).Err = tt.sendErr
+
+			if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); !errors.Is(err, tt.want) {
+				t.Fatalf("OTPRequest() error = %v, want %v", err, tt.want)
+			}
+			if _, ok := store.Get(otpPrefix + testPhone); ok {
+				t.Fatal("undelivered OTP left in the store")
+			}
+		})
+	}
+}
+
+func TestOTPRequestDoesNotLogCode(t *testing.T) {
+	tests := []struct {
+		name, env, logCodes string
+	}{
+		{"in production", "production", "true"},
+		{"in development without OTP_LOG_CODES", "development", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", tt.env)
+			t.Setenv("OTP_LOG_CODES", tt.logCodes)
+			s, _, logs := newOTPTestService(t)
+
+			if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); err != nil {
+				t.Fatalf("OTPRequest() error = %v", err)
+			}
+			if _, err := s.OTPVerify(schema.PhoneIdentifier(testPhone), "000000"); !errors.Is(err, common.ErrCompareOTP) {
+				t.Fatalf("OTPVerify() error = %v, want %v", err, common.ErrCompareOTP)
+			}
+
+			if logsContain(logs, testOTP) {
+				t.Fatal("plaintext OTP was logged without the opt-in")
+			}
+		})
+	}
+}
+
+func TestOTPRequestLogsCodeWhenOptedIn(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("OTP_LOG_CODES", "true")
+	s, _, logs := newOTPTestService(t)
+
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+	if !logsContain(logs, testOTP) {
+		t.Fatal("OTP not logged with OTP_LOG_CODES in development mode")
+	}
+}
+
+// deadlineSender records the deadline each message was sent under.
+type deadlineSender struct{ deadline time.Time }
+
+func (d *deadlineSender) Send(ctx context.Context, _ delivery.Message) error {
+	d.deadline, _ = ctx.Deadline()
+	return nil
+}
+
+func TestOTPRequestSendTimeout(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	sender := &deadlineSender{}
+	s.sender = sender
+	// e.g. the budget of a route whose three providers time out after 10s.
+	s.SetSendTimeout(30 * time.Second)
+
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+	if left := time.Until(sender.deadline); left < 29*time.Second || left > 30*time.Second {
+		t.Fatalf("sender had %s to deliver, want the 30s budget", left)
+	}
+}
+
+func TestOTPVerify(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		phone   string
+		code    string
+		want    bool
+		wantErr error
+	}{
+		{name: "wrong code", phone: testPhone, code: "000000", wantErr: common.ErrCompareOTP},
+		{name: "code of another phone", phone: "09120000000", code: testOTP, wantErr: common.ErrGetOTP},
+		{name: "correct code", phone: testPhone, code: testOTP, want: true},
+		{name: "reused code", phone: testPhone, code: testOTP, wantErr: common.ErrGetOTP},
+	}
+	// Cases run in order: the successful verification consumes the OTP.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.OTPVerify(schema.PhoneIdentifier(tt.phone), tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("OTPVerify() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("OTPVerify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOTPVerifyBurnsAfterMaxAttempts(t *testing.T) {
+	t.Setenv("OTP_MAX_ATTEMPTS", "3")
+	s, store, _ := newOTPTestService(t)
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+
+	for attempt := 1; attempt < 3; attempt++ {
+		if _, err := s.OTPVerify(schema.PhoneIdentifier(testPhone), "000000"); !errors.Is(err, common.ErrCompareOTP) {
+			t.Fatalf("attempt %d: OTPVerify() error = %v, want %v", attempt, err, common.ErrCompareOTP)
+		}
+	}
+	if _, err := s.OTPVerify(schema.PhoneIdentifier(testPhone), "000000"); !errors.Is(err, common.ErrOTPAttemptsExceeded) {
+		t.Fatalf("last attempt: OTPVerify() error = %v, want %v", err, common.ErrOTPAttemptsExceeded)
+	}
+
+	if _, ok := store.Get(otpPrefix + testPhone); ok {
+		t.Fatal("burned OTP is still stored")
+	}
+	if _, err := s.OTPVerify(schema.PhoneIdentifier(testPhone), testOTP); !errors.Is(err, common.ErrGetOTP) {
+		t.Fatalf("OTPVerify() with the right code after burning: error = %v, want %v", err, common.ErrGetOTP)
+	}
+}
+
+func TestOTPVerifyParallelGuesses(t *testing.T) {
+	t.Setenv("OTP_MAX_ATTEMPTS", "3")
+	s, _, _ := newOTPTestService(t)
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+
+	const guesses = 32
+	start := make(chan struct{})
+	results := make(chan error, guesses)
+	for i := range guesses {
+		go func() {
+			<-start
+			_, err := s.OTPVerify(schema.PhoneIdentifier(testPhone), fmt.Sprintf("%06d", i))
+			results <- err
+		}()
+	}
+	close(start)
+
+	compared := 0
+	for range guesses {
+		switch err := <-results; {
+		case errors.Is(err, common.ErrCompareOTP):
+			compared++
+		case errors.Is(err, common.ErrOTPAttemptsExceeded), errors.Is(err, common.ErrGetOTP):
+		default:
+			t.Fatalf("OTPVerify() error = %v", err)
+		}
+	}
+	if compared != 2 {
+		t.Fatalf("%d parallel guesses were rejected as wrong before burning, want 2", compared)
+	}
+	if _, err := s.OTPVerify(schema.PhoneIdentifier(testPhone), testOTP); !errors.Is(err, common.ErrGetOTP) {
+		t.Fatalf("OTPVerify() with the right code after parallel guesses error = %v, want %v", err, common.ErrGetOTP)
+	}
+}
+
+func TestOTPVerifyChecksAttemptsBeforeComparing(t *testing.T) {
+	t.Setenv("OTP_MAX_ATTEMPTS", "3")
+	s, store, _ := newOTPTestService(t)
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+	// A guess that loaded the entry before another burned it still finds it.
+	stored, _ := store.Get(otpPrefix + testPhone)
+	stored.(*otpEntry).attempts.Store(3)
+
+	if _, err := s.OTPVerify(schema.PhoneIdentifier(testPhone), testOTP); !errors.Is(err, common.ErrOTPAttemptsExceeded) {
+		t.Fatalf("OTPVerify() with the right code on a spent entry error = %v, want %v", err, common.ErrOTPAttemptsExceeded)
+	}
+}
+
+func TestHashOTPIsKeyedAndBoundToPhone(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	other := &service{otpKey: []byte("other-key")}
+
+	hash := s.hashOTP(testPhone, testOTP)
+	if hash == other.hashOTP(testPhone, testOTP) {
+		t.Fatal("hash does not depend on the key")
+	}
+	if hash == s.hashOTP("09120000000", testOTP) {
+		t.Fatal("hash does not depend on the phone number")
+	}
+}
+
+func TestRandomOTP(t *testing.T) {
+	tests := []struct {
+		length   int
+		alphabet string
+		chars    string
+	}{
+		{6, "numeric", numericAlphabet},
+		{8, "alphanumeric", alphanumericAlphabet},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			code, err := randomOTP(tt.length, tt.alphabet)
+			if err != nil {
+				t.Fatalf("randomOTP() error = %v", err)
+			}
+			if len(code) != tt.length || strings.Trim(code, tt.chars) != "" {
+				t.Fatalf("randomOTP(%d, %s) = %q", tt.length, tt.alphabet, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/utils/password"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	passwordFailuresPrefix = "password-failures:"
+	// passwordMaxFailures wrong passwords lock password login for an
+	// identifier for passwordLockout.
+	passwordMaxFailures = 5
+	passwordLockout     = 15 * time.Minute
+	// passwordHashWait is how long a password check waits for a free hash
+	// slot before failing with common.ErrPasswordBusy.
+	passwordHashWait = time.Second
+)
+
+// passwordFailures counts the passwords checked for an identifier since the
+// first of them. A right password deletes the count.
+type passwordFailures struct {
+	count atomic.Int32
+	since time.Time
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// SetPasswordPolicy replaces the policy new passwords are checked against.
+func (s *service) SetPasswordPolicy(policy *password.Policy) {
+	s.passwordPolicy = policy
+}
+
+// PasswordLogin checks plaintext against the password of the account of id.
+// Unknown accounts and accounts without a password fail like a wrong
+// password. After passwordMaxFailures wrong passwords the identifier is
+// locked for passwordLockout.
+func (s *service) PasswordLogin(id schema.Identifier, plaintext string) error {
+	key := passwordFailuresPrefix + id.Value
+	if err := s.passwordAttempt(key); err != nil {
+		return err
+	}
+
+	user, err := s.findUser(id)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.Error("database error checking for user", zap.Error(err))
+		return err
+	}
+	if user == nil || user.PasswordHash == nil {
+		// Spend the time of a real check, so timing does not tell which
+		// accounts exist or have a password.
+		if _, _, err := s.verifyPassword(plaintext, s.dummyPasswordHash()); errors.Is(err, common.ErrPasswordBusy) {
+			return err
+		}
+		return common.ErrInvalidCredentials
+	}
+
+	ok, rehash, err := s.verifyPassword(plaintext, *user.PasswordHash)
+	if errors.Is(err, common.ErrPasswordBusy) {
+		return err
+	}
+	if err != nil {
+		s.logger.Error("stored password hash unreadable", zap.Uint8("user_id", user.ID), zap.Error(err))
+		return err
+	}
+	if !ok {
+		return common.ErrInvalidCredentials
+	}
+	s.inMemo.Delete(key)
+	if rehash {
+		s.rehashPassword(user, plaintext)
+	}
+	return nil
+}
+
+// SetPassword gives the account of userID its first password. req carries
+// an OTP sent to one of the account's verified identifiers.
+func (s *service) SetPassword(userID uint8, req schema.PasswordOTPRequest) error {
+	user, err := s.passwordUser(userID, req)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash != nil {
+		return common.ErrPasswordAlreadySet
+	}
+	if err := s.verifyOwnership(user, req); err != nil {
+		return err
+	}
+	return s.storePassword(user, req.Password)
+}
+
+// ChangePassword replaces the password of userID after checking the current
+// one and an OTP, and signs the account out everywhere. Wrong current
+// passwords count towards a lockout like wrong passwords at login, so a
+// stolen access token cannot be used to guess the password.
+func (s *service) ChangePassword(userID uint8, req schema.ChangePasswordRequest) error {
+	user, err := s.passwordUser(userID, req.PasswordOTPRequest)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash == nil {
+		return common.ErrPasswordNotSet
+	}
+	key := passwordFailuresPrefix + formatUserID(user.ID)
+	if err := s.passwordAttempt(key); err != nil {
+		return err
+	}
+	ok, _, err := s.verifyPassword(req.CurrentPassword, *user.PasswordHash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return common.ErrInvalidCredentials
+	}
+	s.inMemo.Delete(key)
+	if err := s.verifyOwnership(user, req.PasswordOTPRequest); err != nil {
+		return err
+	}
+	if err := s.storePassword(user, req.Password); err != nil {
+		return err
+	}
+	return s.revokeUser(user.ID)
+}
+
+// ResetPassword sets a new password for a user who forgot theirs, proven by
+// an OTP sent to the identifier of req, and signs the account out
+// everywhere.
+func (s *service) ResetPassword(req schema.PasswordOTPRequest) error {
+	id, ok := req.Identifier()
+	if !ok {
+		return common.ErrInvalidIdentifier
+	}
+	user, err := s.findUser(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Only the holder of a valid OTP learns that no account exists.
+		if _, err := s.OTPVerify(id, req.OTPCode); err != nil {
+			return err
+		}
+		return common.ErrInvalidCredentials
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.checkPasswordPolicy(user, req.Password); err != nil {
+		return err
+	}
+	if err := s.verifyOwnership(user, req); err != nil {
+		return err
+	}
+	if err := s.storePassword(user, req.Password); err != nil {
+		return err
+	}
+	s.inMemo.Delete(passwordFailuresPrefix + id.Value)
+	s.inMemo.Delete(passwordFailuresPrefix + formatUserID(user.ID))
+	// Whoever knew the old password is signed out too.
+	return s.revokeUser(user.ID)
+}
+
+// passwordUser loads the user with userID and checks the new password of req
+// against the policy, before the OTP is spent.
+func (s *service) passwordUser(userID uint8, req schema.PasswordOTPRequest) (*model.User, error) {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.checkPasswordPolicy(&user, req.Password); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *service) checkPasswordPolicy(user *model.User, plaintext string) error {
+	var identifiers []string
+	if user.PhoneNumber != nil {
+		identifiers = append(identifiers, *user.PhoneNumber)
+	}
+	if user.Email != nil {
+		identifiers = append(identifiers, *user.Email)
+	}
+	err := s.passwordPolicy.Check(plaintext, identifiers...)
+	if errors.Is(err, password.ErrBreachedUnreadable) {
+		s.logger.Error("failed to check breached passwords", zap.Error(err))
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", common.ErrWeakPassword, err)
+	}
+	return nil
+}
+
+// verifyOwnership checks that the identifier of req is a verified
+// identifier of user and consumes the OTP sent to it.
+func (s *service) verifyOwnership(user *model.User, req schema.PasswordOTPRequest) error {
+	id, ok := req.Identifier()
+	if !ok {
+		return common.ErrInvalidIdentifier
+	}
+	return s.verifyIdentifierOTP(user, id, req.OTPCode)
+}
+
+// verifyIdentifierOTP checks that id is a verified identifier of user and
+// consumes the OTP sent to it.
+func (s *service) verifyIdentifierOTP(user *model.User, id schema.Identifier, otpCode string) error {
+	owned := false
+	switch id.Type {
+	case schema.IdentifierEmail:
+		owned = user.Email != nil && *user.Email == id.Value && user.EmailVerified
+	default:
+		owned = user.PhoneNumber != nil && *user.PhoneNumber == id.Value && user.PhoneVerified
+	}
+	if !owned {
+		return common.ErrIdentifierNotOwned
+	}
+	if _, err := s.OTPVerify(id, otpCode); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *service) storePassword(user *model.User, plaintext string) error {
+	hash, err := s.hashPassword(plaintext)
+	if err != nil {
+		return err
+	}
+	err = s.db.Model(user).Updates(map[string]any{"password_hash": hash, "password_changed_at": time.Now()}).Error
+	if err != nil {
+		s.logger.Error("failed to store password", zap.Uint8("user_id", user.ID), zap.Error(err))
+		return err
+	}
+	s.logger.Info("password set", zap.Uint8("user_id", user.ID))
+	return nil
+}
+
+// rehashPassword stores plaintext hashed under the current parameters,
+// unless the password changed since user was loaded.
+func (s *service) rehashPassword(user *model.User, plaintext string) {
+	hash, err := s.hashPassword(plaintext)
+	if err != nil {
+		s.logger.Error("failed to rehash password", zap.Error(err))
+		return
+	}
+	err = s.db.Model(&model.User{}).
+		Where("id = ? AND password_hash = ?", user.ID, *user.PasswordHash).
+		Update("password_hash", hash).Error
+	if err != nil {
+		s.logger.Error("failed to store rehashed password", zap.Uint8("user_id", user.ID), zap.Error(err))
+		return
+	}
+	s.logger.Debug("password rehashed under new parameters", zap.Uint8("user_id", user.ID))
+}
+
+// hashPassword hashes plaintext under passwordParams in a hash slot.
+func (s *service) hashPassword(plaintext string) (string, error) {
+	release, err := s.acquirePasswordSlot()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return password.Hash(plaintext, s.passwordParams)
+}
+
+// verifyPassword checks plaintext against encoded in a hash slot.
+func (s *service) verifyPassword(plaintext, encoded string) (ok, rehash bool, err error) {
+	release, err := s.acquirePasswordSlot()
+	if err != nil {
+		return false, false, err
+	}
+	defer release()
+	return password.Verify(plaintext, encoded, s.passwordParams)
+}
+
+// acquirePasswordSlot waits up to passwordHashWait for a free hash slot, so
+// a flood of password requests queues instead of running out of memory.
+func (s *service) acquirePasswordSlot() (release func(), err error) {
+	timer := time.NewTimer(passwordHashWait)
+	defer timer.Stop()
+	select {
+	case s.passwordSlots <- struct{}{}:
+		return func() { <-s.passwordSlots }, nil
+	case <-timer.C:
+		return nil, common.ErrPasswordBusy
+	}
+}
+
+// passwordHashSlots returns PASSWORD_MAX_CONCURRENT_HASHES, how many
+// password hashes may run at once. Defaults to the number of CPUs; invalid
+// values are ignored.
+func passwordHashSlots() int {
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_CONCURRENT_HASHES")); err == nil && n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// passwordAttempt counts a password check against key and fails once
+// passwordMaxFailures checks were made since the first of them.
+func (s *service) passwordAttempt(key string) error {
+	stored, _ := s.inMemo.GetOrSet(key, &passwordFailures{since: time.Now()}, passwordLockout)
+	failures, _ := stored.(*passwordFailures)
+	if failures == nil {
+		return nil
+	}
+	if _, ok := takeAttempt(&failures.count, passwordMaxFailures); !ok {
+		return &common.RetryAfterError{Err: common.ErrPasswordAttemptsExceeded, RetryAfter: time.Until(failures.since.Add(passwordLockout))}
+	}
+	return nil
+}
+
+func (s *service) dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = password.Hash("", s.passwordParams)
+	})
+	return dummyHash
+}
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/utils/password"
+)
+
+const testPassword = "plum-kettle-orbit"
+
+// newPasswordTestService returns a service with a registered testPhone and
+// cheap hashing parameters.
+func newPasswordTestService(t *testing.T) (*service, *model.User) {
+	t.Helper()
+	s, user := newUserTestService(t)
+	s.passwordParams = password.Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	return s, user
+}
+
+// passwordOTP requests an OTP for phone and returns a request carrying it.
+func passwordOTP(t *testing.T, s *service, phone, plaintext string) schema.PasswordOTPRequest {
+	t.Helper()
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: phone}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+	return schema.PasswordOTPRequest{PhoneNumber: phone, OTPCode: testOTP, Password: plaintext}
+}
+
+// storedHash returns the password hash of user as stored.
+func storedHash(t *testing.T, s *service, user *model.User) string {
+	t.Helper()
+	var stored model.User
+	if err := s.db.First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.PasswordHash == nil {
+		t.Fatal("no password stored")
+	}
+	return *stored.PasswordHash
+}
+
+func TestSetPasswordAndLogin(t *testing.T) {
+	s, user := newPasswordTestService(t)
+	id := schema.PhoneIdentifier(testPhone)
+
+	if err := s.PasswordLogin(id, testPassword); !errors.Is(err, common.ErrInvalidCredentials) {
+		t.Fatalf("PasswordLogin() without a password error = %v, want %v", err, common.ErrInvalidCredentials)
+	}
+
+	// A rejected password leaves the OTP for the next attempt.
+	req := passwordOTP(t, s, testPhone, "short")
+	if err := s.SetPassword(user.ID, req); !errors.Is(err, common.ErrWeakPassword) || !errors.Is(err, password.ErrTooShort) {
+		t.Fatalf("SetPassword() with a short password error = %v", err)
+	}
+	req.Password = testPhone
+	if err := s.SetPassword(user.ID, req); !errors.Is(err, password.ErrIsIdentifier) {
+		t.Fatalf("SetPassword() with the phone number error = %v, want %v", err, password.ErrIsIdentifier)
+	}
+	req.Password = testPassword
+	if err := s.SetPassword(user.ID, req); err != nil {
+		t.Fatalf("SetPassword() error = %v", err)
+	}
+	if hash := storedHash(t, s, user); strings.Contains(hash, testPassword) || !strings.HasPrefix(hash, "$argon2id$") {
+		t.Fatalf("stored hash = %q", hash)
+	}
+
+	if err := s.PasswordLogin(id, testPassword); err != nil {
+		t.Fatalf("PasswordLogin() error = %v", err)
+	}
+	if err := s.PasswordLogin(id, testPassword+"!"); !errors.Is(err, common.ErrInvalidCredentials) {
+		t.Fatalf("PasswordLogin() with a wrong password error = %v, want %v", err, common.ErrInvalidCredentials)
+	}
+	if err := s.PasswordLogin(schema.PhoneIdentifier("+989123456780"), testPassword); !errors.Is(err, common.ErrInvalidCredentials) {
+		t.Fatalf("PasswordLogin() for an unknown account error = %v, want %v", err, common.ErrInvalidCredentials)
+	}
+
+	if err := s.SetPassword(user.ID, passwordOTP(t, s, testPhone, "another-good-one")); !errors.Is(err, common.ErrPasswordAlreadySet) {
+		t.Fatalf("second SetPassword() error = %v, want %v", err, common.ErrPasswordAlreadySet)
+	}
+}
+
+func TestSetPasswordIdentifierNotOwned(t *testing.T) {
+	s, user := newPasswordTestService(t)
+
+	err := s.SetPassword(user.ID, passwordOTP(t, s, "+989123456780", testPassword))
+	if !errors.Is(err, common.ErrIdentifierNotOwned) {
+		t.Fatalf("SetPassword() with another number error = %v, want %v", err, common.ErrIdentifierNotOwned)
+	}
+	req := passwordOTP(t, s, testPhone, testPassword)
+	req.OTPCode = "000000"
+	if err := s.SetPassword(user.ID, req); !errors.Is(err, common.ErrCompareOTP) {
+		t.Fatalf("SetPassword() with a wrong OTP error = %v, want %v", err, common.ErrCompareOTP)
+	}
+}
+
+func TestPasswordLoginLockout(t *testing.T) {
+	s, user := newPasswordTestService(t)
+	id := schema.PhoneIdentifier(testPhone)
+	if err := s.SetPassword(user.ID, passwordOTP(t, s, testPhone, testPassword)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < passwordMaxFailures; i++ {
+		if err := s.PasswordLogin(id, "wrong-password"); !errors.Is(err, common.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d error = %v, want %v", i+1, err, common.ErrInvalidCredentials)
+		}
+	}
+	var retry *common.RetryAfterError
+	err := s.PasswordLogin(id, testPassword)
+	if !errors.As(err, &retry) || !errors.Is(err, common.ErrPasswordAttemptsExceeded) {
+		t.Fatalf("PasswordLogin() when locked error = %v, want %v", err, common.ErrPasswordAttemptsExceeded)
+	}
+	if retry.RetryAfter <= 0 || retry.RetryAfter > passwordLockout {
+		t.Fatalf("RetryAfter = %v", retry.RetryAfter)
+	}
+
+	// A reset proves the owner and lifts the lock.
+	if err := s.ResetPassword(passwordOTP(t, s, testPhone, "new-plum-kettle")); err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+	if err := s.PasswordLogin(id, "new-plum-kettle"); err != nil {
+		t.Fatalf("PasswordLogin() after reset error = %v", err)
+	}
+}
+
+func TestPasswordLoginParallelGuesses(t *testing.T) {
+	s, user := newPasswordTestService(t)
+	id := schema.PhoneIdentifier(testPhone)
+	if err := s.SetPassword(user.ID, passwordOTP(t, s, testPhone, testPassword)); err != nil {
+		t.Fatal(err)
+	}
+
+	compared := 0
+	for _, err := range runParallel(32, func(int) error {
+		return s.PasswordLogin(id, "wrong-password")
+	}) {
+		switch {
+		case errors.Is(err, common.ErrInvalidCredentials):
+			compared++
+		case errors.Is(err, common.ErrPasswordAttemptsExceeded):
+		default:
+			t.Fatalf("PasswordLogin() error = %v", err)
+		}
+	}
+	if compared != passwordMaxFailures {
+		t.Fatalf("%d parallel guesses were checked, want %d", compared, passwordMaxFailures)
+	}
+	if err := s.PasswordLogin(id, testPassword); !errors.Is(err, common.ErrPasswordAttemptsExceeded) {
+		t.Fatalf("PasswordLogin() with the right password after parallel guesses error = %v, want %v", err, common.ErrPasswordAttemptsExceeded)
+	}
+}
+
+func TestPasswordRehash(t *testing.T) {
+	s, user := newPasswordTestService(t)
+	if err := s.SetPassword(user.ID, passwordOTP(t, s, testPhone, testPassword)); err != nil {
+		t.Fatal(err)
+	}
+	old := storedHash(t, s, user)
+
+	s.passwordParams.Iterations = 2
+	if err := s.PasswordLogin(schema.PhoneIdentifier(testPhone), testPassword); err != nil {
+		t.Fatalf("PasswordLogin() error = %v", err)
+	}
+	rehashed := storedHash(t, s, user)
+	if rehashed == old || !strings.Contains(rehashed, ",t=2,") {
+		t.Fatalf("hash after login = %q, want one with the new parameters", rehashed)
+	}
+	if err := s.PasswordLogin(schema.PhoneIdentifier(testPhone), testPassword); err != nil {
+		t.Fatalf("PasswordLogin() with the rehashed password error = %v", err)
+	}
+}
+
+func TestChangePasswordRevokesTokens(t *testing.T) {
+	s, user := newPasswordTestService(t)
+	id := schema.PhoneIdentifier(testPhone)
+	if err := s.ChangePassword(user.ID, schema.ChangePasswordRequest{
+		PasswordOTPRequest: passwordOTP(t, s, testPhone, testPassword),
+		CurrentPassword:    "anything-at-all",
+	}); !errors.Is(err, common.ErrPasswordNotSet) {
+		t.Fatalf("ChangePassword() without a password error = %v, want %v", err, common.ErrPasswordNotSet)
+	}
+	if err := s.SetPassword(user.ID, passwordOTP(t, s, testPhone, testPassword)); err != nil {
+		t.Fatal(err)
+	}
+	_, refresh, err := s.IssueTokens(id, schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := schema.ChangePasswordRequest{
+		PasswordOTPRequest: passwordOTP(t, s, testPhone, "new-plum-kettle"),
+		CurrentPassword:    "wrong-password",
+	}
+	if err := s.ChangePassword(user.ID, req); !errors.Is(err, common.ErrInvalidCredentials) {
+		t.Fatalf("ChangePassword() with a wrong current password error = %v, want %v", err, common.ErrInvalidCredentials)
+	}
+	req.CurrentPassword = testPassword
+	if err := s.ChangePassword(user.ID, req); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+
+	if _, _, err := s.RefreshToken(refresh, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshToken() after a password change error = %v, want %v", err, common.ErrInvalidRefreshToken)
+	}
+	if err := s.PasswordLogin(id, testPassword); !errors.Is(err, common.ErrInvalidCredentials) {
+		t.Fatalf("PasswordLogin() with the old password error = %v", err)
+	}
+	if err := s.PasswordLogin(id, "new-plum-kettle"); err != nil {
+		t.Fatalf("PasswordLogin() with the new password error = %v", err)
+	}
+}
+
+func TestChangePasswordLockout(t *testing.T) {
+	s, user := newPasswordTestService(t)
+	if err := s.SetPassword(user.ID, passwordOTP(t, s, testPhone, testPassword)); err != nil {
+		t.Fatal(err)
+	}
+
+	req := schema.ChangePasswordRequest{
+		PasswordOTPRequest: passwordOTP(t, s, testPhone, "new-plum-kettle"),
+		CurrentPassword:    "wrong-password",
+	}
+	for i := 0; i < passwordMaxFailures; i++ {
+		if err := s.ChangePassword(user.ID, req); !errors.Is(err, common.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d error = %v, want %v", i+1, err, common.ErrInvalidCredentials)
+		}
+	}
+	req.CurrentPassword = testPassword
+	if err := s.ChangePassword(user.ID, req); !errors.Is(err, common.ErrPasswordAttemptsExceeded) {
+		t.Fatalf("ChangePassword() when locked error = %v, want %v", err, common.ErrPasswordAttemptsExceeded)
+	}
+
+	// A reset proves the owner and lifts the lock.
+	if err := s.ResetPassword(passwordOTP(t, s, testPhone, "reset-plum-kettle")); err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+	req = schema.ChangePasswordRequest{
+		PasswordOTPRequest: passwordOTP(t, s, testPhone, "new-plum-kettle"),
+		CurrentPassword:    "reset-plum-kettle",
+	}
+	if err := s.ChangePassword(user.ID, req); err != nil {
+		t.Fatalf("ChangePassword() after reset error = %v", err)
+	}
+}
+
+func TestPasswordChecksWaitForHashSlot(t *testing.T) {
+	s, user := newPasswordTestService(t)
+	id := schema.PhoneIdentifier(testPhone)
+	if err := s.SetPassword(user.ID, passwordOTP(t, s, testPhone, testPassword)); err != nil {
+		t.Fatal(err)
+	}
+
+	s.passwordSlots = make(chan struct{}, 1)
+	s.passwordSlots <- struct{}{}
+	if err := s.PasswordLogin(id, testPassword); !errors.Is(err, common.ErrPasswordBusy) {
+		t.Fatalf("PasswordLogin() with every hash slot taken error = %v, want %v", err, common.ErrPasswordBusy)
+	}
+	<-s.passwordSlots
+	if err := s.PasswordLogin(id, testPassword); err != nil {
+		t.Fatalf("PasswordLogin() with a free hash slot error = %v", err)
+	}
+}
+
+func TestResetPasswordUnknownAccount(t *testing.T) {
+	s, _ := newPasswordTestService(t)
+
+	req := passwordOTP(t, s, "+989123456780", testPassword)
+	req.OTPCode = "000000"
+	if err := s.ResetPassword(req); !errors.Is(err, common.ErrCompareOTP) {
+		t.Fatalf("ResetPassword() for an unknown account with a wrong OTP error = %v, want %v", err, common.ErrCompareOTP)
+	}
+	req.OTPCode = testOTP
+	if err := s.ResetPassword(req); !errors.Is(err, common.ErrInvalidCredentials) {
+		t.Fatalf("ResetPassword() for an unknown account error = %v, want %v", err, common.ErrInvalidCredentials)
+	}
+}
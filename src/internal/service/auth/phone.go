@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"goAuth/internal/common"
+	"goAuth/internal/utils/phonenumber"
+)
+
+// phoneRegionList parses a comma-separated list of region codes ("IR") and
+// calling codes ("+98").
+func phoneRegionList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.ToUpper(strings.TrimSpace(entry)); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func phoneRegionMatches(entries []string, n phonenumber.Number) bool {
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, "+") {
+			if strings.HasPrefix(n.E164, entry) {
+				return true
+			}
+		} else if entry == n.Region {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPhoneAllowed fails with common.ErrPhoneRegionNotAllowed when
+// phoneNumber is in PHONE_DENIED_REGIONS, or PHONE_ALLOWED_REGIONS is set and
+// does not list it. Both take region and calling codes; numbers of regions
+// missing from the metadata only match calling codes.
+func checkPhoneAllowed(phoneNumber string) error {
+	n, err := phonenumber.Parse(phoneNumber, phonenumber.DefaultRegion())
+	if err != nil {
+		return fmt.Errorf("%w: %w", common.ErrInvalidIdentifier, err)
+	}
+	if phoneRegionMatches(phoneRegionList(os.Getenv("PHONE_DENIED_REGIONS")), n) {
+		return common.ErrPhoneRegionNotAllowed
+	}
+	if allowed := phoneRegionList(os.Getenv("PHONE_ALLOWED_REGIONS")); len(allowed) > 0 && !phoneRegionMatches(allowed, n) {
+		return common.ErrPhoneRegionNotAllowed
+	}
+	return nil
+}
+
+// isFixedLine reports whether phoneNumber is known to be a landline, which
+// cannot receive text messages.
+func isFixedLine(phoneNumber string) bool {
+	n, err := phonenumber.Parse(phoneNumber, phonenumber.DefaultRegion())
+	return err == nil && n.Type == phonenumber.FixedLine
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/delivery"
+)
+
+func TestOTPRequestNormalizesPhoneNumber(t *testing.T) {
+	s, store, _ := newOTPTestService(t)
+
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: "0912 345 6789"}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+	if _, ok := store.Get(otpPrefix + testPhone); !ok {
+		t.Fatalf("no OTP stored under %s", testPhone)
+	}
+	if msg, _ := s.sender.(*delivery.RecordingSender).Last(); msg.Recipient != testPhone {
+		t.Fatalf("sent to %q, want %q", msg.Recipient, testPhone)
+	}
+	if _, err := s.OTPVerify(schema.PhoneIdentifier("+98 912 345 6789"), testOTP); err != nil {
+		t.Fatalf("OTPVerify() in international format error = %v", err)
+	}
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: "0912345"}); !errors.Is(err, common.ErrInvalidIdentifier) {
+		t.Fatalf("OTPRequest() for a short number error = %v, want %v", err, common.ErrInvalidIdentifier)
+	}
+}
+
+func TestCheckPhoneAllowed(t *testing.T) {
+	tests := []struct {
+		allowed, denied string
+		phone           string
+		want            error
+	}{
+		{"", "", "+442079460958", nil},
+		{"IR", "", testPhone, nil},
+		{"IR", "", "+442079460958", common.ErrPhoneRegionNotAllowed},
+		{"ir, +254", "", "+254712345678", nil},
+		{"", "GB", "+447400123456", common.ErrPhoneRegionNotAllowed},
+		{"", "+9891", testPhone, common.ErrPhoneRegionNotAllowed},
+		{"IR", "+9891", "+989351234567", nil},
+		{"", "US", "+15062345678", nil},
+		{"KZ", "", "+79123456789", common.ErrPhoneRegionNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Setenv("PHONE_ALLOWED_REGIONS", tt.allowed)
+		t.Setenv("PHONE_DENIED_REGIONS", tt.denied)
+		if err := checkPhoneAllowed(tt.phone); !errors.Is(err, tt.want) {
+			t.Errorf("allowed %q, denied %q: checkPhoneAllowed(%s) = %v, want %v", tt.allowed, tt.denied, tt.phone, err, tt.want)
+		}
+	}
+}
+
+func TestLandlinesOnlyGetCalls(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	landline := "+982188887777"
+
+	_, channel, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: landline})
+	if err != nil || channel != delivery.ChannelVoice {
+		t.Fatalf("OTPRequest() = %q, %v; want a voice call", channel, err)
+	}
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: landline, Channel: delivery.ChannelSMS}); !errors.Is(err, common.ErrChannelUnavailable) {
+		t.Fatalf("SMS to a landline error = %v, want %v", err, common.ErrChannelUnavailable)
+	}
+}
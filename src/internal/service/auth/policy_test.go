@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+	"goAuth/internal/service/delivery"
+)
+
+func TestOTPPolicyFromEnv(t *testing.T) {
+	t.Setenv("OTP_LENGTH", "8")
+	t.Setenv("OTP_ALPHABET", "alphanumeric")
+	t.Setenv("OTP_TTL", "5m")
+	t.Setenv("OTP_RESEND_INTERVAL", "30s")
+	t.Setenv("OTP_MAX_SENDS", "0")
+	t.Setenv("OTP_SEND_WINDOW", "bogus")
+
+	want := model.OTPPolicy{
+		Length:            8,
+		Alphabet:          model.AlphabetAlphanumeric,
+		TTL:               5 * time.Minute,
+		ResendInterval:    30 * time.Second,
+		MaxSends:          0,
+		SendWindow:        defaultOTPPolicy.SendWindow,
+		MaxVerifyAttempts: defaultOTPPolicy.MaxVerifyAttempts,
+	}
+	if got := otpPolicyFromEnv(); got != want {
+		t.Fatalf("otpPolicyFromEnv() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOTPRequestUsesClientPolicy(t *testing.T) {
+	s, store, _ := newOTPTestService(t)
+	db := newTestDB(t)
+	s.db = db
+	s.generateOTP = randomOTP
+	db.Create(&model.Client{ClientID: "kiosk", SecretHash: "x", OTPPolicy: model.OTPPolicy{
+		Length:            8,
+		Alphabet:          model.AlphabetAlphanumeric,
+		TTL:               10 * time.Minute,
+		MaxVerifyAttempts: 2,
+	}})
+
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone, ClientID: "kiosk"}); err != nil {
+		t.Fatalf("OTPRequest() error = %v", err)
+	}
+	msg, _ := s.sender.(*delivery.RecordingSender).Last()
+	if len(msg.Code) != 8 || msg.ExpiresIn != 10*time.Minute {
+		t.Fatalf("sent code %q expiring in %s, want 8 characters and 10m", msg.Code, msg.ExpiresIn)
+	}
+	stored, _ := store.Get(otpPrefix + testPhone)
+	if entry := stored.(*otpEntry); entry.maxAttempts != 2 {
+		t.Fatalf("maxAttempts = %d, want 2", entry.maxAttempts)
+	}
+
+	// Alphanumeric codes are accepted regardless of case.
+	lower := []byte(msg.Code)
+	for i, c := range lower {
+		if c >= 'A' && c <= 'Z' {
+			lower[i] = c + 'a' - 'A'
+		}
+	}
+	if ok, err := s.OTPVerify(schema.PhoneIdentifier(testPhone), string(lower)); !ok || err != nil {
+		t.Fatalf("OTPVerify(%q) = %v, %v", lower, ok, err)
+	}
+
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone, ClientID: "unknown"}); !errors.Is(err, common.ErrInvalidClient) {
+		t.Fatalf("unknown client error = %v, want %v", err, common.ErrInvalidClient)
+	}
+}
+
+func TestOTPRequestSendLimits(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+
+	s.policy.ResendInterval = time.Minute
+	phone := "09120000101"
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: phone}); err != nil {
+		t.Fatalf("first OTPRequest() error = %v", err)
+	}
+	_, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: phone})
+	var retry *common.RetryAfterError
+	if !errors.Is(err, common.ErrOTPResendTooSoon) || !errors.As(err, &retry) || retry.RetryAfter <= 0 {
+		t.Fatalf("resend error = %v, want %v with a retry delay", err, common.ErrOTPResendTooSoon)
+	}
+
+	s.policy.ResendInterval, s.policy.MaxSends = 0, 2
+	phone = "09120000102"
+	for range 2 {
+		if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: phone}); err != nil {
+			t.Fatalf("OTPRequest() error = %v", err)
+		}
+	}
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: phone}); !errors.Is(err, common.ErrOTPRateLimited) {
+		t.Fatalf("third OTPRequest() error = %v, want %v", err, common.ErrOTPRateLimited)
+	}
+}
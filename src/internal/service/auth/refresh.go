@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const defaultRefreshExpiry = 30 * 24 * time.Hour
+
+// generateRefreshToken issues a refresh token that starts a new token family
+// for user.
+func (s *service) generateRefreshToken(user *model.User, authn authentication) (refreshToken string, err error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	return s.issueRefreshToken(s.db, user.ID, familyID, authn)
+}
+
+// RefreshToken rotates refreshToken: the presented token is marked as used and
+// a new access/refresh pair is returned. Presenting an already used token
+// revokes every token in its family and returns common.ErrRefreshTokenReused.
+// The session of the token is marked seen from client.
+func (s *service) RefreshToken(refreshToken string, client schema.SessionClient) (accessToken string, newRefreshToken string, err error) {
+	var stored model.RefreshToken
+	if err := s.db.Preload("User").Where("token_hash = ?", hashRefreshToken(refreshToken)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", common.ErrInvalidRefreshToken
+		}
+		s.logger.Error("failed to load refresh token", zap.Error(err))
+		return "", "", err
+	}
+
+	if stored.RevokedAt != nil {
+		return "", "", common.ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		s.revokeFamily(stored.FamilyID)
+		return "", "", common.ErrRefreshTokenReused
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return "", "", common.ErrRefreshTokenExpired
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Guard against two concurrent refreshes with the same token: only one
+		// of them can flip used_at from NULL.
+		res := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return common.ErrRefreshTokenReused
+		}
+
+		newRefreshToken, err = s.issueRefreshToken(tx, stored.UserID, stored.FamilyID, storedAuthentication(&stored))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, common.ErrRefreshTokenReused) {
+			s.revokeFamily(stored.FamilyID)
+		}
+		return "", "", err
+	}
+
+	accessToken, err = s.generateToken(&stored.User, storedAuthentication(&stored))
+	if err != nil {
+		return "", "", err
+	}
+	if stored.SessionID != nil {
+		s.touchSession(*stored.SessionID, client)
+	}
+	return accessToken, newRefreshToken, nil
+}
+
+func (s *service) issueRefreshToken(db *gorm.DB, userID uint8, familyID string, authn authentication) (string, error) {
+	expiry, err := refreshExpiry()
+	if err != nil {
+		s.logger.Error("invalid refreshExpiry duration", zap.Error(err))
+		return "", err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		s.logger.Error("failed to generate refresh token", zap.Error(err))
+		return "", err
+	}
+
+	record := &model.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: time.Now().Add(expiry),
+		AuthTime:  authn.time,
+		AMR:       authn.methods,
+	}
+	if authn.sessionID != 0 {
+		record.SessionID = &authn.sessionID
+	}
+	if err := db.Create(record).Error; err != nil {
+		s.logger.Error("failed to store refresh token", zap.Error(err))
+		return "", err
+	}
+	return token, nil
+}
+
+// storedAuthentication returns the login behind stored. Tokens issued before
+// it was recorded could descend from a login of any age, so they count as
+// authenticated at the Unix epoch and are never fresh.
+func storedAuthentication(stored *model.RefreshToken) authentication {
+	authn := authentication{time: stored.AuthTime, methods: stored.AMR}
+	if authn.time.IsZero() {
+		authn = authentication{time: time.Unix(0, 0)}
+	}
+	if stored.SessionID != nil {
+		authn.sessionID = *stored.SessionID
+	}
+	return authn
+}
+
+func (s *service) revokeFamily(familyID string) {
+	s.logger.Warn("refresh token reuse detected, revoking family", zap.String("familyID", familyID))
+	// The thief may hold access tokens of the session too.
+	if session, err := s.sessionOfFamily(familyID); err == nil && session.RevokedAt == nil {
+		if err := s.revokeSession(session); err != nil {
+			s.logger.Error("failed to revoke session of refresh token family", zap.Error(err), zap.String("familyID", familyID))
+		}
+	}
+	err := s.db.Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		s.logger.Error("failed to revoke refresh token family", zap.Error(err), zap.String("familyID", familyID))
+	}
+}
+
+func refreshExpiry() (time.Duration, error) {
+	expiryStr := os.Getenv("REFRESH_EXPIRY")
+	if expiryStr == "" {
+		return defaultRefreshExpiry, nil
+	}
+	expiry, err := time.ParseDuration(expiryStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid refreshExpiry duration: %w", err)
+	}
+	return expiry, nil
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s, _ := newUserTestService(t)
+	_, first, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	access, second, err := s.RefreshToken(first, schema.SessionClient{})
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if second == first {
+		t.Fatal("RefreshToken() returned the presented token")
+	}
+	mustValidate(t, s, access)
+	if _, _, err := s.RefreshToken(second, schema.SessionClient{}); err != nil {
+		t.Fatalf("RefreshToken() with the rotated token error = %v", err)
+	}
+
+	var stored []model.RefreshToken
+	s.db.Order("id").Find(&stored)
+	if len(stored) != 3 || stored[0].FamilyID != stored[2].FamilyID {
+		t.Fatalf("stored tokens = %+v, want one family of 3", stored)
+	}
+	for _, token := range stored {
+		if token.TokenHash == first || token.TokenHash == second {
+			t.Fatal("refresh token stored in plaintext")
+		}
+	}
+	if _, _, err := s.RefreshToken("not-a-token", schema.SessionClient{}); !errors.Is(err, common.ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshToken() with an unknown token error = %v, want %v", err, common.ErrInvalidRefreshToken)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	s, _ := newUserTestService(t)
+	_, first, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	_, other, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	_, second, err := s.RefreshToken(first, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.RefreshToken(first, schema.SessionClient{}); !errors.Is(err, common.ErrRefreshTokenReused) {
+		t.Fatalf("RefreshToken() with a used token error = %v, want %v", err, common.ErrRefreshTokenReused)
+	}
+	// The legitimate holder's newer token dies with the family.
+	if _, _, err := s.RefreshToken(second, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshToken() with the newest token of a reused family error = %v, want %v", err, common.ErrInvalidRefreshToken)
+	}
+	if _, _, err := s.RefreshToken(first, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshToken() with a revoked token error = %v, want %v", err, common.ErrInvalidRefreshToken)
+	}
+	// Other logins are left alone.
+	if _, _, err := s.RefreshToken(other, schema.SessionClient{}); err != nil {
+		t.Fatalf("RefreshToken() of another family error = %v", err)
+	}
+}
+
+func TestRefreshTokenConcurrentRotation(t *testing.T) {
+	s, _ := newUserTestService(t)
+	_, refresh, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+
+	const racers = 8
+	results := make(chan error, racers)
+	for i := 0; i < racers; i++ {
+		go func() {
+			_, _, err := s.RefreshToken(refresh, schema.SessionClient{})
+			results <- err
+		}()
+	}
+	succeeded := 0
+	for i := 0; i < racers; i++ {
+		err := <-results
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, common.ErrRefreshTokenReused), errors.Is(err, common.ErrInvalidRefreshToken):
+		default:
+			t.Fatalf("RefreshToken() error = %v", err)
+		}
+	}
+	if succeeded > 1 {
+		t.Fatalf("%d concurrent refreshes with one token succeeded, want at most 1", succeeded)
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	s, _ := newUserTestService(t)
+	_, refresh, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err := s.db.Model(&model.RefreshToken{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.RefreshToken(refresh, schema.SessionClient{}); !errors.Is(err, common.ErrRefreshTokenExpired) {
+		t.Fatalf("RefreshToken() with an expired token error = %v, want %v", err, common.ErrRefreshTokenExpired)
+	}
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	revokedJTIPrefix     = "revoked:jti:"
+	revokedUserPrefix    = "revoked:user:"
+	revokedSessionPrefix = "revoked:session:"
+)
+
+// Logout revokes accessToken and, when given, the refresh token family that
+// belongs to the same session. Tokens naming their session end it.
+func (s *service) Logout(accessToken, refreshToken string) error {
+	claims, err := s.ValidateToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	jti := claims.ID
+	if jti == "" {
+		return common.ErrInvalidToken
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return common.ErrInvalidToken
+	}
+	expiresAt := claims.ExpiresAt
+
+	s.inMemo.Set(revokedJTIPrefix+jti, true, time.Until(expiresAt.Time))
+	if err := s.persistRevocation(&model.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt.Time}); err != nil {
+		return err
+	}
+	if sessionID := claims.sessionID(); sessionID != 0 {
+		if err := s.RevokeSession(userID, sessionID); err != nil && !errors.Is(err, common.ErrSessionNotFound) {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	var stored model.RefreshToken
+	dbErr := s.db.Where("token_hash = ? AND user_id = ?", hashRefreshToken(refreshToken), userID).First(&stored).Error
+	if errors.Is(dbErr, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if dbErr != nil {
+		s.logger.Error("failed to load refresh token on logout", zap.Error(dbErr))
+		return dbErr
+	}
+	s.revokeFamily(stored.FamilyID)
+	return nil
+}
+
+// LogoutAll revokes every access and refresh token issued to the owner of
+// accessToken up to now.
+func (s *service) LogoutAll(accessToken string) error {
+	claims, err := s.ValidateToken(accessToken)
+	if err != nil {
+		return err
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return common.ErrInvalidToken
+	}
+	return s.revokeUser(userID)
+}
+
+// revokeUser revokes every access and refresh token issued to the user with
+// userID up to now.
+func (s *service) revokeUser(userID uint8) error {
+	expiry, err := time.ParseDuration(os.Getenv("ACCESS_EXPIRY"))
+	if err != nil {
+		s.logger.Error("invalid accessExpiry duration", zap.Error(err))
+		return err
+	}
+
+	now := time.Now()
+	s.inMemo.Set(revokedUserPrefix+formatUserID(userID), now, expiry)
+	if err := s.persistRevocation(&model.RevokedToken{CreatedAt: now, UserID: userID, ExpiresAt: now.Add(expiry)}); err != nil {
+		return err
+	}
+
+	err = s.db.Model(&model.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+	if err != nil {
+		s.logger.Error("failed to revoke refresh tokens", zap.Error(err), zap.Uint8("userID", userID))
+		return err
+	}
+	err = s.db.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+	if err != nil {
+		s.logger.Error("failed to end sessions", zap.Error(err), zap.Uint8("userID", userID))
+		return err
+	}
+	return nil
+}
+
+// RestoreRevocations loads unexpired revocations from the database into the
+// in-memory revocation list. It is a no-op unless REVOCATION_PERSIST is set.
+func (s *service) RestoreRevocations() error {
+	if !revocationPersistenceEnabled() {
+		return nil
+	}
+
+	var revoked []model.RevokedToken
+	if err := s.db.Where("expires_at > ?", time.Now()).Find(&revoked).Error; err != nil {
+		s.logger.Error("failed to restore revoked tokens", zap.Error(err))
+		return err
+	}
+	for _, r := range revoked {
+		ttl := time.Until(r.ExpiresAt)
+		if r.JTI != "" {
+			s.inMemo.Set(revokedJTIPrefix+r.JTI, true, ttl)
+			continue
+		}
+		if r.SessionID != 0 {
+			s.inMemo.Set(revokedSessionPrefix+formatSessionID(r.SessionID), true, ttl)
+			continue
+		}
+		key := revokedUserPrefix + formatUserID(r.UserID)
+		if cutoff, ok := s.inMemo.Get(key); ok && !cutoff.(time.Time).Before(r.CreatedAt) {
+			continue
+		}
+		s.inMemo.Set(key, r.CreatedAt, ttl)
+	}
+	s.logger.Info("restored revoked tokens", zap.Int("count", len(revoked)))
+	return nil
+}
+
+func (s *service) isRevoked(claims *Claims) bool {
+	if claims.ID != "" {
+		if _, ok := s.inMemo.Get(revokedJTIPrefix + claims.ID); ok {
+			return true
+		}
+	}
+
+	if claims.SessionID != "" {
+		if _, ok := s.inMemo.Get(revokedSessionPrefix + claims.SessionID); ok {
+			return true
+		}
+	}
+
+	cutoff, ok := s.inMemo.Get(revokedUserPrefix + claims.Subject)
+	if !ok {
+		return false
+	}
+	if claims.IssuedAt == nil {
+		return true
+	}
+	// iat has second precision, so a token issued in the same second as the
+	// cutoff counts as issued before it.
+	return !claims.IssuedAt.Time.After(cutoff.(time.Time).Truncate(time.Second))
+}
+
+func (s *service) persistRevocation(revoked *model.RevokedToken) error {
+	if !revocationPersistenceEnabled() {
+		return nil
+	}
+	if err := s.db.Create(revoked).Error; err != nil {
+		s.logger.Error("failed to persist revoked token", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func revocationPersistenceEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("REVOCATION_PERSIST"))
+	return enabled
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/server/api/schema"
+	inmemory "goAuth/internal/service/in-memory"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestLogoutRevokesOnlyItsTokens(t *testing.T) {
+	s, _ := newUserTestService(t)
+	access, refresh, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	otherAccess, otherRefresh, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+
+	if err := s.Logout(access, refresh); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if _, err := s.ValidateToken(access); !errors.Is(err, common.ErrTokenRevoked) {
+		t.Fatalf("ValidateToken() after logout error = %v, want %v", err, common.ErrTokenRevoked)
+	}
+	if _, _, err := s.RefreshToken(refresh, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshToken() after logout error = %v, want %v", err, common.ErrInvalidRefreshToken)
+	}
+	if err := s.Logout(access, ""); !errors.Is(err, common.ErrTokenRevoked) {
+		t.Fatalf("second Logout() error = %v, want %v", err, common.ErrTokenRevoked)
+	}
+
+	mustValidate(t, s, otherAccess)
+	if _, _, err := s.RefreshToken(otherRefresh, schema.SessionClient{}); err != nil {
+		t.Fatalf("RefreshToken() of another login error = %v", err)
+	}
+}
+
+func TestLogoutAllCutoff(t *testing.T) {
+	s, user := newUserTestService(t)
+	access, refresh, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+
+	if err := s.LogoutAll(access); err != nil {
+		t.Fatalf("LogoutAll() error = %v", err)
+	}
+	if _, err := s.ValidateToken(access); !errors.Is(err, common.ErrTokenRevoked) {
+		t.Fatalf("ValidateToken() after logout-all error = %v, want %v", err, common.ErrTokenRevoked)
+	}
+	if _, _, err := s.RefreshToken(refresh, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshToken() after logout-all error = %v, want %v", err, common.ErrInvalidRefreshToken)
+	}
+
+	cutoff, _ := s.inMemo.Get(revokedUserPrefix + formatUserID(user.ID))
+	at := cutoff.(time.Time)
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		revoked  bool
+	}{
+		{"before the cutoff", at.Add(-time.Second), true},
+		{"in the cutoff's second", at.Truncate(time.Second), true},
+		{"in the next second", at.Truncate(time.Second).Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: formatUserID(user.ID), IssuedAt: jwt.NewNumericDate(tt.issuedAt)}}
+		if got := s.isRevoked(claims); got != tt.revoked {
+			t.Errorf("token issued %s: isRevoked() = %v, want %v", tt.name, got, tt.revoked)
+		}
+	}
+	other := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "99", IssuedAt: jwt.NewNumericDate(at.Add(-time.Second))}}
+	if s.isRevoked(other) {
+		t.Error("logout-all revoked another user's token")
+	}
+}
+
+func TestRestoreRevocations(t *testing.T) {
+	t.Setenv("REVOCATION_PERSIST", "true")
+	s, _ := newUserTestService(t)
+	access, _, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	allAccess, _, _ := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err := s.Logout(access, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LogoutAll(allAccess); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart loses the in-memory list.
+	s.inMemo = inmemory.NewInMemoryStore()
+	if err := s.RestoreRevocations(); err != nil {
+		t.Fatalf("RestoreRevocations() error = %v", err)
+	}
+	for _, token := range []string{access, allAccess} {
+		if _, err := s.ValidateToken(token); !errors.Is(err, common.ErrTokenRevoked) {
+			t.Fatalf("ValidateToken() after restore error = %v, want %v", err, common.ErrTokenRevoked)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	maxDeviceNameLength = 64
+	maxUserAgentLength  = 512
+	maxIPLength         = 64
+)
+
+// IssueTokens starts a session for the account of id, which just
+// authenticated with method, one of the schema.Method constants, from client.
+// It returns the session's access and refresh tokens.
+func (s *service) IssueTokens(id schema.Identifier, method string, client schema.SessionClient) (accessToken, refreshToken string, err error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		s.logger.Error("failed to load user for tokens", zap.Error(err))
+		return "", "", err
+	}
+	return s.issueSession(user, newAuthentication(method), client)
+}
+
+// issueSession records a new session of user, authenticated as authn, on
+// client and issues its access and refresh tokens.
+func (s *service) issueSession(user *model.User, authn authentication, client schema.SessionClient) (accessToken, refreshToken string, err error) {
+	now := time.Now()
+	session := &model.Session{
+		CreatedAt:  now,
+		UserID:     user.ID,
+		DeviceName: truncate(client.DeviceName, maxDeviceNameLength),
+		UserAgent:  truncate(client.UserAgent, maxUserAgentLength),
+		IP:         truncate(client.IP, maxIPLength),
+		LastSeenAt: now,
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		s.logger.Error("failed to store session", zap.Error(err))
+		return "", "", err
+	}
+	authn.sessionID = session.ID
+
+	if accessToken, err = s.generateToken(user, authn); err != nil {
+		return "", "", err
+	}
+	if refreshToken, err = s.generateRefreshToken(user, authn); err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// Sessions lists the active sessions of the user with userID, most recently
+// seen first. A session whose refresh token could have expired is not
+// active.
+func (s *service) Sessions(userID uint8) ([]schema.Session, error) {
+	expiry, err := refreshExpiry()
+	if err != nil {
+		s.logger.Error("invalid refreshExpiry duration", zap.Error(err))
+		return nil, err
+	}
+	var records []model.Session
+	err = s.db.Where("user_id = ? AND revoked_at IS NULL AND last_seen_at > ?", userID, time.Now().Add(-expiry)).
+		Order("last_seen_at DESC").
+		Find(&records).Error
+	if err != nil {
+		s.logger.Error("failed to list sessions", zap.Error(err))
+		return nil, err
+	}
+	sessions := make([]schema.Session, len(records))
+	for i, record := range records {
+		sessions[i] = schema.Session{
+			ID:         record.ID,
+			DeviceName: record.DeviceName,
+			UserAgent:  record.UserAgent,
+			IP:         record.IP,
+			CreatedAt:  record.CreatedAt,
+			LastSeenAt: record.LastSeenAt,
+		}
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs the session with sessionID of the user with userID
+// out: its refresh tokens stop working and its access tokens are revoked.
+func (s *service) RevokeSession(userID uint8, sessionID uint) error {
+	var sessions []model.Session
+	err := s.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).Limit(1).Find(&sessions).Error
+	if err != nil {
+		s.logger.Error("failed to load session", zap.Error(err))
+		return err
+	}
+	if len(sessions) == 0 {
+		return common.ErrSessionNotFound
+	}
+	return s.revokeSession(&sessions[0])
+}
+
+func (s *service) revokeSession(session *model.Session) error {
+	expiry, err := time.ParseDuration(os.Getenv("ACCESS_EXPIRY"))
+	if err != nil {
+		s.logger.Error("invalid accessExpiry duration", zap.Error(err))
+		return err
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(session).Where("revoked_at IS NULL").Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&model.RefreshToken{}).
+			Where("session_id = ? AND revoked_at IS NULL", session.ID).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		s.logger.Error("failed to revoke session", zap.Uint("session_id", session.ID), zap.Error(err))
+		return err
+	}
+
+	s.inMemo.Set(revokedSessionPrefix+formatSessionID(session.ID), true, expiry)
+	return s.persistRevocation(&model.RevokedToken{CreatedAt: now, SessionID: session.ID, UserID: session.UserID, ExpiresAt: now.Add(expiry)})
+}
+
+// touchSession records that the session with sessionID was used just now
+// from client.
+func (s *service) touchSession(sessionID uint, client schema.SessionClient) {
+	updates := map[string]any{"last_seen_at": time.Now()}
+	if client.IP != "" {
+		updates["ip"] = truncate(client.IP, maxIPLength)
+	}
+	if client.UserAgent != "" {
+		updates["user_agent"] = truncate(client.UserAgent, maxUserAgentLength)
+	}
+	if err := s.db.Model(&model.Session{}).Where("id = ?", sessionID).Updates(updates).Error; err != nil {
+		s.logger.Error("failed to update session", zap.Uint("session_id", sessionID), zap.Error(err))
+	}
+}
+
+// sessionOfFamily returns the session the refresh token family familyID
+// belongs to.
+func (s *service) sessionOfFamily(familyID string) (*model.Session, error) {
+	var sessions []model.Session
+	err := s.db.Where("id = (?)", s.db.Model(&model.RefreshToken{}).Select("session_id").Where("family_id = ?", familyID).Limit(1)).
+		Limit(1).Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &sessions[0], nil
+}
+
+func formatSessionID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// truncate cuts value to at most limit bytes without splitting a character.
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	for limit > 0 && !utf8.RuneStart(value[limit]) {
+		limit--
+	}
+	return value[:limit]
+}
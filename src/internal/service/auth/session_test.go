@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+)
+
+var testClient = schema.SessionClient{DeviceName: "Pixel 8", UserAgent: "goAuth-test/1.0", IP: "203.0.113.7"}
+
+// login starts a session of testPhone from client.
+func login(t *testing.T, s *service, client schema.SessionClient) (access, refresh string, claims *Claims) {
+	t.Helper()
+	access, refresh, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, client)
+	if err != nil {
+		t.Fatalf("IssueTokens() error = %v", err)
+	}
+	return access, refresh, mustValidate(t, s, access)
+}
+
+func TestSessionsListLogins(t *testing.T) {
+	s, user := newUserTestService(t)
+
+	_, _, laptop := login(t, s, schema.SessionClient{DeviceName: strings.Repeat("é", 40), UserAgent: "laptop", IP: "198.51.100.1"})
+	_, refresh, phone := login(t, s, testClient)
+	if laptop.SessionID == "" || laptop.SessionID == phone.SessionID {
+		t.Fatalf("session ids = %q, %q; want two distinct ids", laptop.SessionID, phone.SessionID)
+	}
+
+	sessions, err := s.Sessions(user.ID)
+	if err != nil {
+		t.Fatalf("Sessions() error = %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Sessions() = %+v, want 2 sessions", sessions)
+	}
+	if got := sessions[1].DeviceName; len(got) != 64 || got != strings.Repeat("é", 32) {
+		t.Fatalf("stored device name = %q, want it cut to 64 bytes on a character boundary", got)
+	}
+
+	// A refresh moves the laptop session to the top and records where it came from.
+	if err := s.db.Model(&model.Session{}).Where("1 = 1").Update("last_seen_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, refresh, err = s.RefreshToken(refresh, schema.SessionClient{IP: "203.0.113.8"})
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	sessions, _ = s.Sessions(user.ID)
+	if got := sessions[0]; formatSessionID(got.ID) != phone.SessionID || got.IP != "203.0.113.8" || got.UserAgent != testClient.UserAgent || got.DeviceName != testClient.DeviceName {
+		t.Fatalf("most recent session = %+v", got)
+	}
+	if !sessions[0].LastSeenAt.After(sessions[1].LastSeenAt) {
+		t.Fatalf("last seen = %v, %v", sessions[0].LastSeenAt, sessions[1].LastSeenAt)
+	}
+
+	// Sessions idle past the refresh token lifetime are not listed.
+	t.Setenv("REFRESH_EXPIRY", "30m")
+	if sessions, _ = s.Sessions(user.ID); len(sessions) != 1 {
+		t.Fatalf("Sessions() with a short refresh expiry = %+v, want 1 session", sessions)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	s, user := newUserTestService(t)
+	access, refresh, claims := login(t, s, testClient)
+	otherAccess, _, _ := login(t, s, testClient)
+
+	other := mustRegister(t, s, schema.PhoneIdentifier("+989123456780"))
+	sessionID := claims.sessionID()
+	if err := s.RevokeSession(other.ID, sessionID); !errors.Is(err, common.ErrSessionNotFound) {
+		t.Fatalf("RevokeSession() of another user's session error = %v, want %v", err, common.ErrSessionNotFound)
+	}
+
+	if err := s.RevokeSession(user.ID, sessionID); err != nil {
+		t.Fatalf("RevokeSession() error = %v", err)
+	}
+	if _, err := s.ValidateToken(access); !errors.Is(err, common.ErrTokenRevoked) {
+		t.Fatalf("ValidateToken() of a signed out session error = %v, want %v", err, common.ErrTokenRevoked)
+	}
+	if _, _, err := s.RefreshToken(refresh, testClient); !errors.Is(err, common.ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshToken() of a signed out session error = %v, want %v", err, common.ErrInvalidRefreshToken)
+	}
+	mustValidate(t, s, otherAccess)
+
+	if err := s.RevokeSession(user.ID, sessionID); !errors.Is(err, common.ErrSessionNotFound) {
+		t.Fatalf("second RevokeSession() error = %v, want %v", err, common.ErrSessionNotFound)
+	}
+	if sessions, _ := s.Sessions(user.ID); len(sessions) != 1 {
+		t.Fatalf("Sessions() after sign out = %+v, want 1 session", sessions)
+	}
+}
+
+func TestLogoutEndsSession(t *testing.T) {
+	s, user := newUserTestService(t)
+	access, refresh, _ := login(t, s, testClient)
+
+	if err := s.Logout(access, refresh); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if sessions, _ := s.Sessions(user.ID); len(sessions) != 0 {
+		t.Fatalf("Sessions() after logout = %+v, want none", sessions)
+	}
+}
+
+func TestRefreshTokenReuseEndsSession(t *testing.T) {
+	s, user := newUserTestService(t)
+	_, refresh, _ := login(t, s, testClient)
+
+	access, _, err := s.RefreshToken(refresh, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.RefreshToken(refresh, testClient); !errors.Is(err, common.ErrRefreshTokenReused) {
+		t.Fatalf("reused RefreshToken() error = %v, want %v", err, common.ErrRefreshTokenReused)
+	}
+	if _, err := s.ValidateToken(access); !errors.Is(err, common.ErrTokenRevoked) {
+		t.Fatalf("ValidateToken() after reuse error = %v, want %v", err, common.ErrTokenRevoked)
+	}
+	if sessions, _ := s.Sessions(user.ID); len(sessions) != 0 {
+		t.Fatalf("Sessions() after reuse = %+v, want none", sessions)
+	}
+}
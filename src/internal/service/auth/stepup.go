@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+
+	"go.uber.org/zap"
+)
+
+// Values of the acr claim.
+const (
+	// ACRSingleFactor is a login with one factor: an OTP, a magic link or a
+	// password.
+	ACRSingleFactor = "1"
+	// ACRMultiFactor is a login with a second factor, or with a passkey,
+	// which verifies the user on the device that holds it.
+	ACRMultiFactor = "2"
+)
+
+const (
+	defaultStepUpExpiry = 5 * time.Minute
+	defaultStepUpMaxAge = 10 * time.Minute
+)
+
+// authentication records when and how a user proved their identity. Access
+// tokens carry it as auth_time, amr and acr; refresh tokens keep it, so
+// refreshing does not make a login recent.
+type authentication struct {
+	time    time.Time
+	methods []string
+	// sessionID is the session started by the login, zero before it is
+	// recorded.
+	sessionID uint
+}
+
+// newAuthentication returns an authentication with methods happening now.
+func newAuthentication(methods ...string) authentication {
+	var unique []string
+	for _, method := range methods {
+		if !slices.Contains(unique, method) {
+			unique = append(unique, method)
+		}
+	}
+	return authentication{time: time.Now(), methods: unique}
+}
+
+func (a authentication) acr() string {
+	if slices.Contains(a.methods, schema.MethodMFA) {
+		return ACRMultiFactor
+	}
+	return ACRSingleFactor
+}
+
+// passkeyMethods returns the amr values of a login with credential.
+func passkeyMethods(credential *model.WebAuthnCredential) []string {
+	if credential.BackupEligible {
+		return []string{schema.MethodSoftwareKey, schema.MethodMFA}
+	}
+	return []string{schema.MethodHardwareKey, schema.MethodMFA}
+}
+
+// StepUp re-authenticates the owner of accessToken and returns a short-lived
+// access token whose auth_time is now. Accounts with a confirmed
+// authenticator app must use it; others prove an identifier with an OTP.
+func (s *service) StepUp(accessToken string, req schema.StepUpRequest) (schema.StepUpToken, error) {
+	claims, err := s.ValidateToken(accessToken)
+	if err != nil {
+		return schema.StepUpToken{}, err
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return schema.StepUpToken{}, common.ErrInvalidToken
+	}
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return schema.StepUpToken{}, err
+	}
+
+	factor, err := s.totpFactor(user.ID)
+	if err != nil && !errors.Is(err, common.ErrMFANotEnrolled) {
+		return schema.StepUpToken{}, err
+	}
+	var authn authentication
+	if err == nil && factor.ConfirmedAt != nil {
+		if req.Code == "" {
+			return schema.StepUpToken{}, common.ErrMFARequired
+		}
+		if err := s.guessSecondFactor(factor, req.Code, ""); err != nil {
+			return schema.StepUpToken{}, err
+		}
+		authn = newAuthentication(schema.MethodOTP, schema.MethodMFA)
+	} else {
+		if req.Code != "" {
+			return schema.StepUpToken{}, common.ErrMFANotEnrolled
+		}
+		id, ok := req.Identifier()
+		if !ok {
+			return schema.StepUpToken{}, common.ErrInvalidIdentifier
+		}
+		if err := s.verifyIdentifierOTP(&user, id, req.OTPCode); err != nil {
+			return schema.StepUpToken{}, err
+		}
+		authn = newAuthentication(schema.MethodOTP)
+	}
+	authn.sessionID = claims.sessionID()
+
+	expiry := stepUpExpiry()
+	token, err := s.signToken(&user, authn, expiry)
+	if err != nil {
+		return schema.StepUpToken{}, err
+	}
+	s.logger.Info("step-up authentication", zap.Uint8("user_id", user.ID), zap.Strings("amr", authn.methods))
+	return schema.StepUpToken{AccessToken: token, TokenType: "Bearer", ExpiresIn: int(expiry / time.Second)}, nil
+}
+
+// stepUpExpiry returns STEP_UP_EXPIRY, the lifetime of step-up access
+// tokens. Invalid values are ignored.
+func stepUpExpiry() time.Duration {
+	if expiry, err := time.ParseDuration(os.Getenv("STEP_UP_EXPIRY")); err == nil && expiry > 0 {
+		return expiry
+	}
+	return defaultStepUpExpiry
+}
+
+// StepUpMaxAge returns STEP_UP_MAX_AGE, how recent the authentication behind
+// an access token must be for sensitive operations. Invalid values are
+// ignored.
+func StepUpMaxAge() time.Duration {
+	if maxAge, err := time.ParseDuration(os.Getenv("STEP_UP_MAX_AGE")); err == nil && maxAge > 0 {
+		return maxAge
+	}
+	return defaultStepUpMaxAge
+}
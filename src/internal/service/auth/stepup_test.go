@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+)
+
+func mustValidate(t *testing.T, s *service, token string) *Claims {
+	t.Helper()
+	claims, err := s.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	return claims
+}
+
+func TestTokenAuthenticationClaims(t *testing.T) {
+	s, user := newUserTestService(t)
+
+	token, _, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodPassword, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := mustValidate(t, s, token)
+	if !slices.Equal(claims.AMR, []string{schema.MethodPassword}) || claims.ACR != ACRSingleFactor {
+		t.Fatalf("amr = %v, acr = %q", claims.AMR, claims.ACR)
+	}
+	if !claims.AuthenticatedWithin(time.Minute) || claims.AuthenticatedWithin(-time.Second) {
+		t.Fatalf("auth_time = %v", claims.AuthTime)
+	}
+
+	secret, _ := enrollTOTP(t, s, user)
+	mfaToken, _ := s.MFAChallenge(schema.PhoneIdentifier(testPhone), schema.MethodPassword)
+	access, _, err := s.CompleteMFA(schema.MFAVerifyRequest{MFAToken: mfaToken, Code: totpCode(secret, totpStep(time.Now()))}, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims = mustValidate(t, s, access)
+	want := []string{schema.MethodPassword, schema.MethodOTP, schema.MethodMFA}
+	if !slices.Equal(claims.AMR, want) || claims.ACR != ACRMultiFactor {
+		t.Fatalf("after mfa amr = %v, acr = %q; want %v, %q", claims.AMR, claims.ACR, want, ACRMultiFactor)
+	}
+}
+
+func TestRefreshKeepsAuthentication(t *testing.T) {
+	s, _ := newUserTestService(t)
+
+	_, refresh, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggedIn := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := s.db.Model(&model.RefreshToken{}).Where("1 = 1").Update("auth_time", loggedIn).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	access, refresh, err := s.RefreshToken(refresh, schema.SessionClient{})
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	claims := mustValidate(t, s, access)
+	if !claims.AuthTime.Time.Equal(loggedIn) || !slices.Equal(claims.AMR, []string{schema.MethodOTP}) {
+		t.Fatalf("refreshed auth_time = %v, amr = %v; want %v, [otp]", claims.AuthTime, claims.AMR, loggedIn)
+	}
+	// The rotated refresh token carries the login on.
+	access, _, err = s.RefreshToken(refresh, schema.SessionClient{})
+	if err != nil {
+		t.Fatalf("second RefreshToken() error = %v", err)
+	}
+	if claims := mustValidate(t, s, access); !claims.AuthTime.Time.Equal(loggedIn) {
+		t.Fatalf("auth_time after two refreshes = %v, want %v", claims.AuthTime, loggedIn)
+	}
+}
+
+func TestRefreshOfUnrecordedLoginIsNeverFresh(t *testing.T) {
+	s, _ := newUserTestService(t)
+
+	_, refresh, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Refresh tokens issued before the login was recorded.
+	if err := s.db.Model(&model.RefreshToken{}).Where("1 = 1").Update("auth_time", time.Time{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		var access string
+		access, refresh, err = s.RefreshToken(refresh, schema.SessionClient{})
+		if err != nil {
+			t.Fatalf("RefreshToken() error = %v", err)
+		}
+		if claims := mustValidate(t, s, access); claims.AuthTime == nil || claims.AuthTime.Unix() != 0 || claims.AuthenticatedWithin(StepUpMaxAge()) {
+			t.Fatalf("auth_time of a refreshed unrecorded login = %v, want the epoch", claims.AuthTime)
+		}
+	}
+}
+
+func TestStepUpWithOTP(t *testing.T) {
+	s, _ := newUserTestService(t)
+	t.Setenv("STEP_UP_EXPIRY", "2m")
+	access, _, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.StepUp(access, schema.StepUpRequest{Code: "123456"}); !errors.Is(err, common.ErrMFANotEnrolled) {
+		t.Fatalf("StepUp() with a code and no app error = %v, want %v", err, common.ErrMFANotEnrolled)
+	}
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: "+989123456780"}); err != nil {
+		t.Fatal(err)
+	}
+	other := schema.StepUpRequest{PhoneNumber: "+989123456780", OTPCode: testOTP}
+	if _, err := s.StepUp(access, other); !errors.Is(err, common.ErrIdentifierNotOwned) {
+		t.Fatalf("StepUp() with another number error = %v, want %v", err, common.ErrIdentifierNotOwned)
+	}
+	if _, err := s.StepUp("not-a-token", other); !errors.Is(err, common.ErrInvalidToken) {
+		t.Fatalf("StepUp() with an invalid token error = %v, want %v", err, common.ErrInvalidToken)
+	}
+
+	if _, _, err := s.OTPRequest(schema.OTPRequest{PhoneNumber: testPhone}); err != nil {
+		t.Fatal(err)
+	}
+	elevated, err := s.StepUp(access, schema.StepUpRequest{PhoneNumber: testPhone, OTPCode: testOTP})
+	if err != nil {
+		t.Fatalf("StepUp() error = %v", err)
+	}
+	if elevated.ExpiresIn != 120 || elevated.TokenType != "Bearer" {
+		t.Fatalf("StepUp() = %+v", elevated)
+	}
+	claims := mustValidate(t, s, elevated.AccessToken)
+	if !claims.AuthenticatedWithin(time.Minute) || !claims.HasMethod(schema.MethodOTP) || claims.ACR != ACRSingleFactor {
+		t.Fatalf("step-up claims auth_time = %v, amr = %v, acr = %q", claims.AuthTime, claims.AMR, claims.ACR)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != 2*time.Minute {
+		t.Fatalf("step-up token lifetime = %v, want 2m", lifetime)
+	}
+	// The OTP is spent.
+	if _, err := s.StepUp(access, schema.StepUpRequest{PhoneNumber: testPhone, OTPCode: testOTP}); err == nil {
+		t.Fatal("StepUp() with a spent OTP succeeded")
+	}
+}
+
+func TestStepUpWithTOTP(t *testing.T) {
+	s, user := newUserTestService(t)
+	secret, _ := enrollTOTP(t, s, user)
+	access, _, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.StepUp(access, schema.StepUpRequest{PhoneNumber: testPhone, OTPCode: testOTP}); !errors.Is(err, common.ErrMFARequired) {
+		t.Fatalf("StepUp() with an OTP on an account with an app error = %v, want %v", err, common.ErrMFARequired)
+	}
+	if _, err := s.StepUp(access, schema.StepUpRequest{Code: "000000"}); !errors.Is(err, common.ErrInvalidMFACode) {
+		t.Fatalf("StepUp() with a wrong code error = %v, want %v", err, common.ErrInvalidMFACode)
+	}
+
+	code := totpCode(secret, totpStep(time.Now()))
+	elevated, err := s.StepUp(access, schema.StepUpRequest{Code: code})
+	if err != nil {
+		t.Fatalf("StepUp() error = %v", err)
+	}
+	if claims := mustValidate(t, s, elevated.AccessToken); claims.ACR != ACRMultiFactor || !claims.HasMethod(schema.MethodMFA) {
+		t.Fatalf("step-up claims amr = %v, acr = %q", claims.AMR, claims.ACR)
+	}
+	if _, err := s.StepUp(access, schema.StepUpRequest{Code: code}); !errors.Is(err, common.ErrInvalidMFACode) {
+		t.Fatalf("StepUp() with a replayed code error = %v, want %v", err, common.ErrInvalidMFACode)
+	}
+}
+
+func TestStepUpTOTPLimitsGuesses(t *testing.T) {
+	s, user := newUserTestService(t)
+	secret, _ := enrollTOTP(t, s, user)
+	access, _, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < mfaMaxAttempts; i++ {
+		if _, err := s.StepUp(access, schema.StepUpRequest{Code: "000000"}); !errors.Is(err, common.ErrInvalidMFACode) {
+			t.Fatalf("attempt %d error = %v, want %v", i+1, err, common.ErrInvalidMFACode)
+		}
+	}
+	code := totpCode(secret, totpStep(time.Now()))
+	if _, err := s.StepUp(access, schema.StepUpRequest{Code: code}); !errors.Is(err, common.ErrMFAAttemptsExceeded) {
+		t.Fatalf("StepUp() after too many wrong codes error = %v, want %v", err, common.ErrMFAAttemptsExceeded)
+	}
+}
+
+func TestStepUpTOTPParallelGuesses(t *testing.T) {
+	s, user := newUserTestService(t)
+	enrollTOTP(t, s, user)
+	access, _, err := s.IssueTokens(schema.PhoneIdentifier(testPhone), schema.MethodOTP, schema.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compared := 0
+	for _, err := range runParallel(32, func(int) error {
+		_, err := s.StepUp(access, schema.StepUpRequest{Code: "000000"})
+		return err
+	}) {
+		switch {
+		case errors.Is(err, common.ErrInvalidMFACode):
+			compared++
+		case errors.Is(err, common.ErrMFAAttemptsExceeded):
+		default:
+			t.Fatalf("StepUp() error = %v", err)
+		}
+	}
+	if compared != mfaMaxAttempts {
+		t.Fatalf("%d parallel guesses were checked, want %d", compared, mfaMaxAttempts)
+	}
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). They are what authenticator apps assume when
+// the provisioning URI leaves them out.
+const (
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// totpSkew is how many steps before and after the current one are
+	// accepted, to allow for clock drift.
+	totpSkew       = 1
+	totpSecretSize = 20
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode returns the code of secret for the time step (RFC 4226 HOTP with
+// the step as counter).
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for range totpDigits {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulus)
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+// totpMatch returns the step within totpSkew of now whose code is code.
+func totpMatch(secret []byte, code string, now time.Time) (step int64, ok bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpProvisioningURI returns the otpauth:// URI authenticator apps import,
+// usually by scanning it as a QR code.
+func totpProvisioningURI(issuer, account string, secret []byte) string {
+	query := url.Values{
+		"secret":    {totpEncoding.EncodeToString(secret)},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod / time.Second))},
+	}
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + query.Encode()
+}
+
+// appName names the service in authenticator apps and passkey prompts:
+// APP_NAME, or goAuth.
+func appName() string {
+	if name := os.Getenv("APP_NAME"); name != "" {
+		return name
+	}
+	return "goAuth"
+}
+
+// mfaKeyFromEnv returns the AES-256 key TOTP secrets are encrypted with,
+// derived from MFA_ENCRYPTION_KEY or else OTP_HMAC_KEY. Without either the
+// key would change on every start, so nil is returned and TOTP is disabled.
+func mfaKeyFromEnv() []byte {
+	secret := os.Getenv("MFA_ENCRYPTION_KEY")
+	if secret == "" {
+		secret = os.Getenv("OTP_HMAC_KEY")
+	}
+	if secret == "" {
+		return nil
+	}
+	key := sha256.Sum256([]byte("totp-secret\x00" + secret))
+	return key[:]
+}
+
+func (s *service) totpCipher() (cipher.AEAD, error) {
+	if s.mfaKey == nil {
+		return nil, errors.New("no MFA_ENCRYPTION_KEY or OTP_HMAC_KEY")
+	}
+	block, err := aes.NewCipher(s.mfaKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealTOTPSecret encrypts secret for storage.
+func (s *service) sealTOTPSecret(secret []byte) (string, error) {
+	aead, err := s.totpCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, secret, nil)), nil
+}
+
+// openTOTPSecret decrypts a secret sealed by sealTOTPSecret.
+func (s *service) openTOTPSecret(sealed string) ([]byte, error) {
+	aead, err := s.totpCipher()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, errors.New("malformed totp secret")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated to six digits.
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(secret, totpStep(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	now := time.Unix(1111111109, 0)
+	if _, ok := totpMatch(secret, "081804", now.Add(totpPeriod)); !ok {
+		t.Error("code of the previous step rejected")
+	}
+	if _, ok := totpMatch(secret, "081804", now.Add(3*totpPeriod)); ok {
+		t.Error("code three steps old accepted")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := totpProvisioningURI("goAuth", "+989123456789", []byte("12345678901234567890"))
+	want := "otpauth://totp/goAuth:+989123456789?algorithm=SHA1&digits=6&issuer=goAuth&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if uri != want {
+		t.Errorf("totpProvisioningURI() = %s\nwant %s", uri, want)
+	}
+}
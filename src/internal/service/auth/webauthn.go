@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	passkeyChallengePrefix = "webauthn:"
+	// passkeyCeremonyTTL is how long a registration or login waits for the
+	// authenticator; browsers time out well before.
+	passkeyCeremonyTTL = 5 * time.Minute
+	passkeyHandleSize  = 32
+	passkeyNameMaxLen  = 64
+)
+
+// passkeyCeremony is what the in-memory store holds for a registration or
+// login waiting for the authenticator, keyed by its challenge.
+type passkeyCeremony struct {
+	session webauthn.SessionData
+	// userID is the registering user; zero for logins.
+	userID uint8
+	used   atomic.Bool
+}
+
+// passkeyUser adapts a user and their credentials to webauthn.User.
+type passkeyUser struct {
+	user        *model.User
+	handle      []byte
+	credentials []model.WebAuthnCredential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte { return u.handle }
+
+func (u *passkeyUser) WebAuthnName() string {
+	if u.user.Email != nil {
+		return *u.user.Email
+	}
+	if u.user.PhoneNumber != nil {
+		return *u.user.PhoneNumber
+	}
+	return fmt.Sprint(u.user.ID)
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string { return u.WebAuthnName() }
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+		for j, t := range c.Transports {
+			transports[j] = protocol.AuthenticatorTransport(t)
+		}
+		credentials[i] = webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{AAGUID: c.AAGUID, SignCount: c.SignCount},
+		}
+	}
+	return credentials
+}
+
+// webAuthnFromEnv configures the relying party from WEBAUTHN_RP_ID and
+// WEBAUTHN_RP_ORIGINS. Without an RP ID passkeys are disabled and nil is
+// returned.
+func webAuthnFromEnv() *webauthn.WebAuthn {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		return nil
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: appName(),
+		RPOrigins:     splitList(os.Getenv("WEBAUTHN_RP_ORIGINS"), "https://"+rpID),
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		},
+	})
+	if err != nil {
+		zap.L().Warn("invalid WebAuthn configuration, passkeys disabled", zap.Error(err))
+		return nil
+	}
+	return w
+}
+
+// BeginPasskeyRegistration starts registering a passkey for the user with
+// userID and returns the options for navigator.credentials.create().
+func (s *service) BeginPasskeyRegistration(userID uint8) (*protocol.CredentialCreation, error) {
+	if s.webAuthn == nil {
+		return nil, common.ErrPasskeyUnavailable
+	}
+	user, err := s.passkeyUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.handle == nil {
+		user.handle = make([]byte, passkeyHandleSize)
+		if _, err := rand.Read(user.handle); err != nil {
+			return nil, err
+		}
+	}
+	creation, session, err := s.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()))
+	if err != nil {
+		s.logger.Error("failed to begin passkey registration", zap.Error(err))
+		return nil, err
+	}
+	s.inMemo.Set(passkeyChallengePrefix+session.Challenge, &passkeyCeremony{session: *session, userID: userID}, passkeyCeremonyTTL)
+	return creation, nil
+}
+
+// FinishPasskeyRegistration verifies the response of the authenticator to
+// BeginPasskeyRegistration and stores the new passkey under name.
+func (s *service) FinishPasskeyRegistration(userID uint8, name string, response []byte) (schema.Passkey, error) {
+	if s.webAuthn == nil {
+		return schema.Passkey{}, common.ErrPasskeyUnavailable
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return schema.Passkey{}, fmt.Errorf("%w: %w", common.ErrInvalidPasskey, err)
+	}
+	ceremony, ok := s.takePasskeyCeremony(parsed.Response.CollectedClientData.Challenge)
+	if !ok || ceremony.userID != userID {
+		return schema.Passkey{}, common.ErrInvalidPasskey
+	}
+	user, err := s.passkeyUser(userID)
+	if err != nil {
+		return schema.Passkey{}, err
+	}
+	if user.handle == nil {
+		user.handle = ceremony.session.UserID
+	} else if !bytes.Equal(user.handle, ceremony.session.UserID) {
+		// Another passkey was registered meanwhile and fixed the handle.
+		return schema.Passkey{}, common.ErrInvalidPasskey
+	}
+	credential, err := s.webAuthn.CreateCredential(user, ceremony.session, parsed)
+	if err != nil {
+		s.logger.Debug("passkey registration rejected", zap.Error(err))
+		return schema.Passkey{}, fmt.Errorf("%w: %w", common.ErrInvalidPasskey, err)
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > passkeyNameMaxLen {
+		name = name[:passkeyNameMaxLen]
+	}
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+	record := model.WebAuthnCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		UserHandle:      user.handle,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		s.logger.Error("failed to store passkey", zap.Error(err))
+		return schema.Passkey{}, err
+	}
+	s.logger.Info("passkey registered", zap.Uint8("user_id", userID), zap.Uint("passkey_id", record.ID))
+	return passkeyInfo(record), nil
+}
+
+// BeginPasskeyLogin starts a login with a discoverable passkey and returns
+// the options for navigator.credentials.get(). The authenticator picks the
+// account, so no identifier is needed.
+func (s *service) BeginPasskeyLogin() (*protocol.CredentialAssertion, error) {
+	if s.webAuthn == nil {
+		return nil, common.ErrPasskeyUnavailable
+	}
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		s.logger.Error("failed to begin passkey login", zap.Error(err))
+		return nil, err
+	}
+	s.inMemo.Set(passkeyChallengePrefix+session.Challenge, &passkeyCeremony{session: *session}, passkeyCeremonyTTL)
+	return assertion, nil
+}
+
+// FinishPasskeyLogin verifies the response of the authenticator to
+// BeginPasskeyLogin and starts a session on client for the account owning
+// the passkey. A signature counter that did not increase means the passkey
+// may have been cloned, and the login is refused.
+func (s *service) FinishPasskeyLogin(response []byte, client schema.SessionClient) (accessToken, refreshToken string, err error) {
+	if s.webAuthn == nil {
+		return "", "", common.ErrPasskeyUnavailable
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", common.ErrInvalidPasskey, err)
+	}
+	ceremony, ok := s.takePasskeyCeremony(parsed.Response.CollectedClientData.Challenge)
+	if !ok || ceremony.userID != 0 {
+		return "", "", common.ErrInvalidPasskey
+	}
+
+	var owner *passkeyUser
+	_, credential, err := s.webAuthn.ValidatePasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		found, err := s.passkeyOwner(rawID, userHandle)
+		owner = found
+		return found, err
+	}, ceremony.session, parsed)
+	if err != nil {
+		s.logger.Debug("passkey login rejected", zap.Error(err))
+		return "", "", fmt.Errorf("%w: %w", common.ErrInvalidPasskey, err)
+	}
+
+	var record *model.WebAuthnCredential
+	for i := range owner.credentials {
+		if bytes.Equal(owner.credentials[i].CredentialID, credential.ID) {
+			record = &owner.credentials[i]
+		}
+	}
+	if credential.Authenticator.CloneWarning {
+		s.logger.Warn("passkey signature counter did not increase, possible clone",
+			zap.Uint8("user_id", owner.user.ID), zap.Uint("passkey_id", record.ID),
+			zap.Uint32("stored", record.SignCount), zap.Uint32("received", parsed.Response.AuthenticatorData.Counter))
+		return "", "", common.ErrPasskeyCounterReused
+	}
+	// Of two logins racing with the same counter, only one moves it.
+	res := s.db.Model(&model.WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", record.ID, record.SignCount).
+		Updates(map[string]any{
+			"sign_count":   credential.Authenticator.SignCount,
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": time.Now(),
+		})
+	if res.Error != nil {
+		s.logger.Error("failed to update passkey", zap.Error(res.Error))
+		return "", "", res.Error
+	}
+	if res.RowsAffected != 1 {
+		return "", "", common.ErrPasskeyCounterReused
+	}
+
+	return s.issueSession(owner.user, newAuthentication(passkeyMethods(record)...), client)
+}
+
+// Passkeys lists the passkeys of the user with userID.
+func (s *service) Passkeys(userID uint8) ([]schema.Passkey, error) {
+	var records []model.WebAuthnCredential
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&records).Error; err != nil {
+		s.logger.Error("failed to list passkeys", zap.Error(err))
+		return nil, err
+	}
+	passkeys := make([]schema.Passkey, len(records))
+	for i, record := range records {
+		passkeys[i] = passkeyInfo(record)
+	}
+	return passkeys, nil
+}
+
+// DeletePasskey removes the passkey with id from the account of userID.
+func (s *service) DeletePasskey(userID uint8, id uint) error {
+	res := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.WebAuthnCredential{})
+	if res.Error != nil {
+		s.logger.Error("failed to delete passkey", zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return common.ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// takePasskeyCeremony returns the ceremony started with challenge and removes
+// it, so each challenge is answered once.
+func (s *service) takePasskeyCeremony(challenge string) (*passkeyCeremony, bool) {
+	key := passkeyChallengePrefix + challenge
+	stored, ok := s.inMemo.Get(key)
+	if !ok {
+		return nil, false
+	}
+	ceremony, ok := stored.(*passkeyCeremony)
+	if !ok || !ceremony.used.CompareAndSwap(false, true) {
+		return nil, false
+	}
+	s.inMemo.Delete(key)
+	return ceremony, true
+}
+
+// passkeyUser loads the user with userID and their passkeys. The handle is
+// nil for a user without passkeys.
+func (s *service) passkeyUser(userID uint8) (*passkeyUser, error) {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	u := &passkeyUser{user: &user}
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&u.credentials).Error; err != nil {
+		return nil, err
+	}
+	if len(u.credentials) > 0 {
+		u.handle = u.credentials[0].UserHandle
+	}
+	return u, nil
+}
+
+// passkeyOwner finds the user whose passkey has credentialID and whose handle
+// is userHandle.
+func (s *service) passkeyOwner(credentialID, userHandle []byte) (*passkeyUser, error) {
+	var records []model.WebAuthnCredential
+	if err := s.db.Where("credential_id = ?", credentialID).Limit(1).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || !bytes.Equal(records[0].UserHandle, userHandle) {
+		return nil, common.ErrPasskeyNotFound
+	}
+	owner, err := s.passkeyUser(records[0].UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, common.ErrPasskeyNotFound
+	}
+	return owner, err
+}
+
+func passkeyInfo(record model.WebAuthnCredential) schema.Passkey {
+	return schema.Passkey{
+		ID:         record.ID,
+		Name:       record.Name,
+		Synced:     record.BackupState,
+		CreatedAt:  record.CreatedAt,
+		LastUsedAt: record.LastUsedAt,
+	}
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+const (
+	testRPID   = "auth.example.com"
+	testOrigin = "https://auth.example.com"
+)
+
+// softAuthenticator is a software passkey: an ES256 key that answers
+// registration and login ceremonies like a platform authenticator would.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	origin       string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID, origin: testOrigin}
+}
+
+// authData builds authenticator data with user presence and verification
+// set, and the attested credential when attested is true.
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	flags := byte(protocol.FlagUserPresent | protocol.FlagUserVerified)
+	if attested {
+		flags |= byte(protocol.FlagAttestedCredentialData)
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	coseKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return append(data, coseKey...)
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    a.origin,
+	})
+	return data
+}
+
+// register answers options from BeginPasskeyRegistration.
+func (a *softAuthenticator) register(options *protocol.CredentialCreation) []byte {
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(true),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.credential(map[string]string{
+		"clientDataJSON":    b64(a.clientData("webauthn.create", options.Response.Challenge)),
+		"attestationObject": b64(attestation),
+	})
+}
+
+// login answers options from BeginPasskeyLogin, increasing the signature
+// counter first.
+func (a *softAuthenticator) login(options *protocol.CredentialAssertion) []byte {
+	a.signCount++
+	authData := a.authData(false)
+	clientData := a.clientData("webauthn.get", options.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.credential(map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(response map[string]string) []byte {
+	body, _ := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	return body
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newPasskeyTestService(t *testing.T) (*service, *model.User) {
+	t.Helper()
+	t.Setenv("WEBAUTHN_RP_ID", testRPID)
+	t.Setenv("WEBAUTHN_RP_ORIGINS", testOrigin)
+	return newUserTestService(t)
+}
+
+// registerPasskey runs a registration ceremony for user with a.
+func registerPasskey(t *testing.T, s *service, user *model.User, a *softAuthenticator) schema.Passkey {
+	t.Helper()
+	options, err := s.BeginPasskeyRegistration(user.ID)
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration() error = %v", err)
+	}
+	passkey, err := s.FinishPasskeyRegistration(user.ID, "laptop", a.register(options))
+	if err != nil {
+		t.Fatalf("FinishPasskeyRegistration() error = %v", err)
+	}
+	return passkey
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	s, user := newPasskeyTestService(t)
+	a := newSoftAuthenticator(t)
+	passkey := registerPasskey(t, s, user, a)
+	if passkey.Name != "laptop" {
+		t.Fatalf("passkey name = %q, want laptop", passkey.Name)
+	}
+
+	options, err := s.BeginPasskeyLogin()
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin() error = %v", err)
+	}
+	response := a.login(options)
+	access, refresh, err := s.FinishPasskeyLogin(response, schema.SessionClient{})
+	if err != nil || access == "" || refresh == "" {
+		t.Fatalf("FinishPasskeyLogin() = %q, %q, %v", access, refresh, err)
+	}
+	claims, err := s.ValidateToken(access)
+	if err != nil || claims.Subject != "1" {
+		t.Fatalf("ValidateToken() = %+v, %v; want subject 1", claims, err)
+	}
+	if claims.ACR != ACRMultiFactor || !claims.HasMethod(schema.MethodMFA) {
+		t.Fatalf("passkey login amr = %v, acr = %q", claims.AMR, claims.ACR)
+	}
+
+	// A challenge is answered once.
+	if _, _, err := s.FinishPasskeyLogin(response, schema.SessionClient{}); !errors.Is(err, common.ErrInvalidPasskey) {
+		t.Fatalf("replayed login error = %v, want %v", err, common.ErrInvalidPasskey)
+	}
+
+	var stored model.WebAuthnCredential
+	s.db.First(&stored, passkey.ID)
+	if stored.SignCount != 1 || stored.LastUsedAt == nil {
+		t.Fatalf("stored sign count %d, last used %v; want 1 and set", stored.SignCount, stored.LastUsedAt)
+	}
+}
+
+func TestPasskeyLoginRejectsStaleSignCount(t *testing.T) {
+	s, user := newPasskeyTestService(t)
+	a := newSoftAuthenticator(t)
+	registerPasskey(t, s, user, a)
+
+	for range 2 {
+		options, _ := s.BeginPasskeyLogin()
+		if _, _, err := s.FinishPasskeyLogin(a.login(options), schema.SessionClient{}); err != nil {
+			t.Fatalf("FinishPasskeyLogin() error = %v", err)
+		}
+	}
+
+	// A clone of the authenticator still counts from an earlier value.
+	clone := *a
+	clone.signCount = 1
+	options, _ := s.BeginPasskeyLogin()
+	if _, _, err := s.FinishPasskeyLogin(clone.login(options), schema.SessionClient{}); !errors.Is(err, common.ErrPasskeyCounterReused) {
+		t.Fatalf("login with a stale counter error = %v, want %v", err, common.ErrPasskeyCounterReused)
+	}
+}
+
+func TestPasskeyLoginRejectsWrongOriginAndKey(t *testing.T) {
+	s, user := newPasskeyTestService(t)
+	a := newSoftAuthenticator(t)
+	registerPasskey(t, s, user, a)
+
+	phished := *a
+	phished.origin = "https://auth.example.com.evil.test"
+	options, _ := s.BeginPasskeyLogin()
+	if _, _, err := s.FinishPasskeyLogin(phished.login(options), schema.SessionClient{}); !errors.Is(err, common.ErrInvalidPasskey) {
+		t.Fatalf("login from another origin error = %v, want %v", err, common.ErrInvalidPasskey)
+	}
+
+	forged := newSoftAuthenticator(t)
+	forged.credentialID, forged.userHandle = a.credentialID, a.userHandle
+	options, _ = s.BeginPasskeyLogin()
+	if _, _, err := s.FinishPasskeyLogin(forged.login(options), schema.SessionClient{}); !errors.Is(err, common.ErrInvalidPasskey) {
+		t.Fatalf("login signed by another key error = %v, want %v", err, common.ErrInvalidPasskey)
+	}
+}
+
+func TestPasskeysListAndDelete(t *testing.T) {
+	s, user := newPasskeyTestService(t)
+	first := registerPasskey(t, s, user, newSoftAuthenticator(t))
+	registerPasskey(t, s, user, newSoftAuthenticator(t))
+
+	var handles []model.WebAuthnCredential
+	s.db.Find(&handles)
+	if len(handles) != 2 || string(handles[0].UserHandle) != string(handles[1].UserHandle) {
+		t.Fatal("passkeys of one user do not share a user handle")
+	}
+
+	if err := s.DeletePasskey(user.ID+1, first.ID); !errors.Is(err, common.ErrPasskeyNotFound) {
+		t.Fatalf("DeletePasskey() of another user error = %v, want %v", err, common.ErrPasskeyNotFound)
+	}
+	if err := s.DeletePasskey(user.ID, first.ID); err != nil {
+		t.Fatalf("DeletePasskey() error = %v", err)
+	}
+	passkeys, err := s.Passkeys(user.ID)
+	if err != nil || len(passkeys) != 1 {
+		t.Fatalf("Passkeys() = %v, %v; want one passkey", passkeys, err)
+	}
+}
+
+func TestPasskeysDisabledWithoutRPID(t *testing.T) {
+	s, _, _ := newOTPTestService(t)
+	if _, err := s.BeginPasskeyLogin(); !errors.Is(err, common.ErrPasskeyUnavailable) {
+		t.Fatalf("BeginPasskeyLogin() error = %v, want %v", err, common.ErrPasskeyUnavailable)
+	}
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type service struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewClientService(db *gorm.DB) *service {
+	return &service{
+		db:     db,
+		logger: zap.L(),
+	}
+}
+
+// Authenticate checks clientID and secret and returns the matching client.
+func (s *service) Authenticate(clientID, secret string) (*model.Client, error) {
+	var client model.Client
+	err := s.db.Where("client_id = ?", clientID).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Hash anyway so unknown clients take as long as wrong secrets.
+		hashSecret(secret)
+		return nil, common.ErrInvalidClient
+	}
+	if err != nil {
+		s.logger.Error("failed to load client", zap.Error(err))
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, common.ErrInvalidClient
+	}
+	return &client, nil
+}
+
+// Create registers a client and returns its generated secret, which is only
+// stored hashed.
+func (s *service) Create(name string) (client *model.Client, secret string, err error) {
+	clientID, err := randomString(12)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err = randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client = &model.Client{
+		ClientID:   clientID,
+		SecretHash: hashSecret(secret),
+		Name:       name,
+	}
+	if err := s.db.Create(client).Error; err != nil {
+		s.logger.Error("failed to create client", zap.Error(err))
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// List returns every registered client.
+func (s *service) List() ([]model.Client, error) {
+	var clients []model.Client
+	if err := s.db.Order("id").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// Get returns the client with clientID.
+func (s *service) Get(clientID string) (*model.Client, error) {
+	var client model.Client
+	err := s.db.Where("client_id = ?", clientID).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, common.ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Delete removes the client with clientID.
+func (s *service) Delete(clientID string) error {
+	res := s.db.Where("client_id = ?", clientID).Delete(&model.Client{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return common.ErrInvalidClient
+	}
+	return nil
+}
+
+// SetOTPPolicy replaces the OTP policy override of the client with clientID
+// and returns the updated client.
+func (s *service) SetOTPPolicy(clientID string, policy model.OTPPolicy) (*model.Client, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := s.Get(clientID)
+	if err != nil {
+		return nil, err
+	}
+	client.OTPPolicy = policy
+	if err := s.db.Model(client).Select("OTPPolicy").Updates(client).Error; err != nil {
+		s.logger.Error("failed to update client otp policy", zap.Error(err))
+		return nil, err
+	}
+	return client, nil
+}
+
+// SetRedirectURIs replaces the redirect URIs of the client with clientID and
+// returns the updated client. URIs must be absolute http(s) URLs without a
+// fragment, since tokens are handed over in the fragment.
+func (s *service) SetRedirectURIs(clientID string, uris []string) (*model.Client, error) {
+	for _, uri := range uris {
+		if err := validateRedirectURI(uri); err != nil {
+			return nil, err
+		}
+	}
+	client, err := s.Get(clientID)
+	if err != nil {
+		return nil, err
+	}
+	client.RedirectURIs = uris
+	if err := s.db.Model(client).Select("RedirectURIs").Updates(client).Error; err != nil {
+		s.logger.Error("failed to update client redirect uris", zap.Error(err))
+		return nil, err
+	}
+	return client, nil
+}
+
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid redirect uri %q: %w", uri, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("invalid redirect uri %q: want an absolute http(s) URL without a fragment", uri)
+	}
+	return nil
+}
+
+// Secrets are 256 bit random values, so a plain SHA-256 is enough to keep
+// them from being usable if the database leaks.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
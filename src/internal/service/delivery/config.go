@@ -0,0 +1,294 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"goAuth/internal/common"
+)
+
+var (
+	// errCodesNotLoggable refuses the senders that write codes in plaintext.
+	errCodesNotLoggable = errors.New("the console and file senders write OTP codes in plaintext and need APP_ENV=development and OTP_LOG_CODES=true")
+	// errQueueKeyRequired refuses a queue whose messages could not be
+	// decrypted after a restart.
+	errQueueKeyRequired = errors.New("the delivery queue needs OTP_HMAC_KEY to encrypt queued messages")
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+
+	defaultQueueMaxAttempts = 5
+)
+
+// ProviderConfig describes one OTP provider. Type is "http", "smtp", "file"
+// or "console"; the remaining fields apply to the matching type.
+type ProviderConfig struct {
+	Type    string `json:"type"`
+	Timeout string `json:"timeout,omitempty"`
+
+	// WebhookSecret verifies the delivery receipts the provider posts back.
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+
+	// http
+	URL   string `json:"url,omitempty"`
+	Token string `json:"token,omitempty"`
+
+	// smtp
+	Host            string `json:"host,omitempty"`
+	Port            int    `json:"port,omitempty"`
+	Username        string `json:"username,omitempty"`
+	Password        string `json:"password,omitempty"`
+	From            string `json:"from,omitempty"`
+	RecipientFormat string `json:"recipient_format,omitempty"`
+
+	// file
+	Path string `json:"path,omitempty"`
+}
+
+// timeout returns the configured timeout or the default.
+func (c ProviderConfig) timeout() time.Duration {
+	if d, err := time.ParseDuration(c.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultTimeout
+}
+
+// Build returns the sender described by c.
+func (c ProviderConfig) Build() (OTPSender, error) {
+	switch c.Type {
+	case "http":
+		if c.URL == "" {
+			return nil, errors.New("url is required for the http sender")
+		}
+		return NewHTTPSender(c.URL, c.Token, c.timeout()), nil
+
+	case "smtp":
+		if c.Host == "" || c.From == "" {
+			return nil, errors.New("host and from are required for the smtp sender")
+		}
+		port := c.Port
+		if port == 0 {
+			port = 587
+		}
+		return &SMTPSender{
+			Host:            c.Host,
+			Port:            port,
+			Username:        c.Username,
+			Password:        c.Password,
+			From:            c.From,
+			RecipientFormat: c.RecipientFormat,
+			Timeout:         c.timeout(),
+		}, nil
+
+	case "file":
+		if c.Path == "" {
+			return nil, errors.New("path is required for the file sender")
+		}
+		if !common.LogOTPCodes() {
+			return nil, errCodesNotLoggable
+		}
+		return NewFileSender(c.Path)
+
+	case "console":
+		if !common.LogOTPCodes() {
+			return nil, errCodesNotLoggable
+		}
+		return NewConsoleSender(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown sender type %q", c.Type)
+	}
+}
+
+// ProviderFromEnv describes the provider selected by OTP_SENDER: "http",
+// "smtp", "file" or "console". Without OTP_SENDER the console sender is used
+// when codes may be logged; elsewhere a sender must be configured so codes
+// are never silently dropped or printed.
+func ProviderFromEnv() (ProviderConfig, error) {
+	kind := os.Getenv("OTP_SENDER")
+	if kind == "" {
+		if !common.LogOTPCodes() {
+			return ProviderConfig{}, errors.New("OTP_SENDER is not set")
+		}
+		kind = "console"
+	}
+
+	port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	return ProviderConfig{
+		Type:            kind,
+		Timeout:         os.Getenv("OTP_SENDER_TIMEOUT"),
+		WebhookSecret:   os.Getenv("OTP_WEBHOOK_SECRET"),
+		URL:             os.Getenv("SMS_GATEWAY_URL"),
+		Token:           os.Getenv("SMS_GATEWAY_TOKEN"),
+		Host:            os.Getenv("SMTP_HOST"),
+		Port:            port,
+		Username:        os.Getenv("SMTP_USERNAME"),
+		Password:        os.Getenv("SMTP_PASSWORD"),
+		From:            os.Getenv("SMTP_FROM"),
+		RecipientFormat: os.Getenv("SMTP_RECIPIENT_FORMAT"),
+		Path:            os.Getenv("OTP_SENDER_FILE"),
+	}, nil
+}
+
+// RoutingConfig is the content of OTP_ROUTING_FILE.
+type RoutingConfig struct {
+	Providers map[string]ProviderConfig `json:"providers"`
+	Routes    []RouteConfig             `json:"routes"`
+}
+
+// RouteConfig sends Channel messages (default "sms") to recipients starting
+// with Prefix through Providers, in order of preference. An empty prefix
+// matches every recipient.
+type RouteConfig struct {
+	Channel   string   `json:"channel,omitempty"`
+	Prefix    string   `json:"prefix"`
+	Providers []string `json:"providers"`
+}
+
+// WebhookSecrets returns the receipt webhook secret of every provider that
+// has one, keyed by provider name.
+func (c RoutingConfig) WebhookSecrets() map[string]string {
+	secrets := make(map[string]string, len(c.Providers))
+	for name, provider := range c.Providers {
+		if provider.WebhookSecret != "" {
+			secrets[name] = provider.WebhookSecret
+		}
+	}
+	return secrets
+}
+
+// RoutingFromEnv reads the routing described by OTP_ROUTING_FILE. Without it
+// SMS goes through the single provider selected by OTP_SENDER, named after
+// its type; see channelsFromEnv for the other channels.
+func RoutingFromEnv() (RoutingConfig, error) {
+	path := os.Getenv("OTP_ROUTING_FILE")
+	if path == "" {
+		provider, err := ProviderFromEnv()
+		if err != nil {
+			return RoutingConfig{}, err
+		}
+		config := RoutingConfig{
+			Providers: map[string]ProviderConfig{provider.Type: provider},
+			Routes:    []RouteConfig{{Channel: ChannelSMS, Providers: []string{provider.Type}}},
+		}
+		channelsFromEnv(&config, provider)
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RoutingConfig{}, err
+	}
+	var config RoutingConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return RoutingConfig{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	// Allow secrets to be kept out of the file as ${VARIABLES}. They are
+	// expanded after parsing, so a value can never change the JSON around it.
+	for name, provider := range config.Providers {
+		provider.expandEnv()
+		config.Providers[name] = provider
+	}
+	return config, nil
+}
+
+// expandEnv replaces ${VARIABLES} in c's string fields.
+func (c *ProviderConfig) expandEnv() {
+	for _, field := range []*string{
+		&c.Timeout, &c.WebhookSecret, &c.URL, &c.Token, &c.Host,
+		&c.Username, &c.Password, &c.From, &c.RecipientFormat, &c.Path,
+	} {
+		*field = os.ExpandEnv(*field)
+	}
+}
+
+// channelsFromEnv adds the non-SMS channels to config: voice calls through the
+// HTTP API at OTP_VOICE_URL, messaging apps through the bot gateway at
+// OTP_MESSAGING_APP_URL and email through SMTP_HOST. The console and file
+// senders write every channel, so they serve all of them.
+func channelsFromEnv(config *RoutingConfig, sms ProviderConfig) {
+	add := func(channel, name string, provider ProviderConfig) {
+		if _, ok := config.Providers[name]; !ok {
+			config.Providers[name] = provider
+		}
+		config.Routes = append(config.Routes, RouteConfig{Channel: channel, Providers: []string{name}})
+	}
+
+	if sms.Type == "console" || sms.Type == "file" {
+		for _, channel := range Channels[1:] {
+			add(channel, sms.Type, sms)
+		}
+		return
+	}
+	for _, gateway := range []struct{ channel, prefix string }{
+		{ChannelVoice, "OTP_VOICE"},
+		{ChannelMessagingApp, "OTP_MESSAGING_APP"},
+	} {
+		channel, prefix := gateway.channel, gateway.prefix
+		if url := os.Getenv(prefix + "_URL"); url != "" {
+			add(channel, channel, ProviderConfig{
+				Type:          "http",
+				Timeout:       sms.Timeout,
+				WebhookSecret: os.Getenv(prefix + "_WEBHOOK_SECRET"),
+				URL:           url,
+				Token:         os.Getenv(prefix + "_TOKEN"),
+			})
+		}
+	}
+	if sms.Host != "" && sms.From != "" {
+		email := sms
+		email.Type, email.WebhookSecret = "smtp", ""
+		add(ChannelEmail, "smtp", email)
+	}
+}
+
+// TemplatesFromEnv loads the message templates, overridden from
+// OTP_TEMPLATES_DIR when set. OTP_DEFAULT_LOCALE (default "en") is used when
+// no locale matches the request and APP_NAME (default "goAuth") is available
+// to templates as {{.AppName}}.
+func TemplatesFromEnv() (*Templates, error) {
+	locale := os.Getenv("OTP_DEFAULT_LOCALE")
+	if locale == "" {
+		locale = "en"
+	}
+	appName := os.Getenv("APP_NAME")
+	if appName == "" {
+		appName = "goAuth"
+	}
+	return LoadTemplates(os.Getenv("OTP_TEMPLATES_DIR"), locale, appName)
+}
+
+// QueueConfigFromEnv reads the delivery queue settings: OTP_DELIVERY_WORKERS
+// (default 0, which delivers inline while the request waits),
+// OTP_DELIVERY_MAX_ATTEMPTS, OTP_DELIVERY_BACKOFF and OTP_DELIVERY_MAX_BACKOFF.
+// Queued messages are encrypted with a key derived from OTP_HMAC_KEY, which
+// the queue requires.
+func QueueConfigFromEnv() (QueueConfig, error) {
+	config := QueueConfig{
+		MaxAttempts: defaultQueueMaxAttempts,
+		BaseBackoff: time.Second,
+		MaxBackoff:  30 * time.Second,
+		Key:         []byte(os.Getenv("OTP_HMAC_KEY")),
+	}
+	if n, err := strconv.Atoi(os.Getenv("OTP_DELIVERY_WORKERS")); err == nil && n >= 0 {
+		config.Workers = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("OTP_DELIVERY_MAX_ATTEMPTS")); err == nil && n > 0 {
+		config.MaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("OTP_DELIVERY_BACKOFF")); err == nil && d > 0 {
+		config.BaseBackoff = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("OTP_DELIVERY_MAX_BACKOFF")); err == nil && d > 0 {
+		config.MaxBackoff = d
+	}
+	if config.Workers > 0 && len(config.Key) == 0 {
+		return QueueConfig{}, errQueueKeyRequired
+	}
+	return config, nil
+}
@@ -0,0 +1,86 @@
+package delivery
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestPlaintextSendersNeedOptIn(t *testing.T) {
+	tests := []struct {
+		env, logCodes string
+		want          error
+	}{
+		{"production", "true", errCodesNotLoggable},
+		{"development", "", errCodesNotLoggable},
+		{"development", "true", nil},
+	}
+	for _, tt := range tests {
+		t.Setenv("APP_ENV", tt.env)
+		t.Setenv("OTP_LOG_CODES", tt.logCodes)
+		for _, config := range []ProviderConfig{{Type: "console"}, {Type: "file", Path: t.TempDir() + "/otp.log"}} {
+			if _, err := config.Build(); !errors.Is(err, tt.want) {
+				t.Errorf("Build() of a %s sender with APP_ENV=%s OTP_LOG_CODES=%q error = %v, want %v", config.Type, tt.env, tt.logCodes, err, tt.want)
+			}
+		}
+	}
+}
+
+func TestProviderFromEnvDefault(t *testing.T) {
+	t.Setenv("OTP_SENDER", "")
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("OTP_LOG_CODES", "")
+	if _, err := ProviderFromEnv(); err == nil {
+		t.Fatal("ProviderFromEnv() without OTP_SENDER or OTP_LOG_CODES fell back to a sender")
+	}
+
+	t.Setenv("OTP_LOG_CODES", "true")
+	config, err := ProviderFromEnv()
+	if err != nil || config.Type != "console" {
+		t.Fatalf("ProviderFromEnv() with OTP_LOG_CODES = %+v, %v, want the console sender", config, err)
+	}
+}
+
+func TestRoutingFromEnvExpandsValuesAfterParsing(t *testing.T) {
+	path := t.TempDir() + "/routing.json"
+	routing := `{
+  "providers": {"sms": {"type": "http", "url": "https://sms.example.com/send", "token": "${SMS_TOKEN}"}},
+  "routes": [{"prefix": "", "providers": ["sms"]}]
+}`
+	if err := os.WriteFile(path, []byte(routing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OTP_ROUTING_FILE", path)
+	// A secret that would rewrite the JSON if expanded before parsing.
+	token := `s3cr"et", "url": "https://attacker.example.com`
+	t.Setenv("SMS_TOKEN", token)
+
+	config, err := RoutingFromEnv()
+	if err != nil {
+		t.Fatalf("RoutingFromEnv() error = %v", err)
+	}
+	if sms := config.Providers["sms"]; sms.Token != token || sms.URL != "https://sms.example.com/send" {
+		t.Fatalf("provider = %+v, want the token expanded verbatim", sms)
+	}
+}
+
+func TestQueueConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		workers, key string
+		want         int
+		wantErr      error
+	}{
+		{"", "", 0, nil},
+		{"0", "", 0, nil},
+		{"4", "", 0, errQueueKeyRequired},
+		{"4", "queue-key", 4, nil},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTP_DELIVERY_WORKERS", tt.workers)
+		t.Setenv("OTP_HMAC_KEY", tt.key)
+		config, err := QueueConfigFromEnv()
+		if !errors.Is(err, tt.wantErr) || config.Workers != tt.want {
+			t.Errorf("QueueConfigFromEnv() with OTP_DELIVERY_WORKERS=%q OTP_HMAC_KEY=%q = %d workers, %v; want %d, %v", tt.workers, tt.key, config.Workers, err, tt.want, tt.wantErr)
+		}
+	}
+}
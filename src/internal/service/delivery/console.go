@@ -0,0 +1,41 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ConsoleSender writes OTPs to a writer instead of delivering them. It is
+// meant for development only.
+type ConsoleSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewConsoleSender writes messages to stdout.
+func NewConsoleSender() *ConsoleSender {
+	return &ConsoleSender{w: os.Stdout}
+}
+
+// NewFileSender appends messages to the file at path.
+func NewFileSender(path string) (*ConsoleSender, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsoleSender{w: f}, nil
+}
+
+func (s *ConsoleSender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.w, "%s [otp] to=%s channel=%s %s\n", time.Now().Format(time.RFC3339), msg.Recipient, msg.DeliveryChannel(), msg.ChannelText())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTemporary, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPSender delivers OTPs through a generic HTTP gateway: an SMS gateway, a
+// voice-call API or a messaging-app bot. It POSTs
+//
+//	{"to": "<recipient>", "channel": "<channel>", "message": "<text>", "reference": "<request id>"}
+//
+// to URL with an optional bearer token; for voice calls the message is the
+// script to read out. Gateways that send delivery receipts should echo the
+// reference.
+type HTTPSender struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+// NewHTTPSender returns an HTTPSender that gives up after timeout.
+func NewHTTPSender(url, token string, timeout time.Duration) *HTTPSender {
+	return &HTTPSender{
+		URL:    url,
+		Token:  token,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *HTTPSender) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string]string{
+		"to":        msg.Recipient,
+		"channel":   msg.DeliveryChannel(),
+		"message":   msg.ChannelText(),
+		"reference": msg.RequestID,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTemporary, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("%w: gateway answered %s", ErrTemporary, resp.Status)
+	default:
+		return fmt.Errorf("%w: gateway answered %s", ErrPermanent, resp.Status)
+	}
+}
@@ -0,0 +1,73 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr error
+	}{
+		{"accepted", http.StatusAccepted, nil},
+		{"rejected", http.StatusBadRequest, ErrPermanent},
+		{"rate limited", http.StatusTooManyRequests, ErrTemporary},
+		{"gateway down", http.StatusBadGateway, ErrTemporary},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer secret" {
+					t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+				}
+				json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			sender := NewHTTPSender(srv.URL, "secret", time.Second)
+			err := sender.Send(context.Background(), Message{Recipient: "09123456789", Code: "123456", ExpiresIn: 2 * time.Minute})
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Send() error = %v, want %v", err, tt.wantErr)
+			}
+			if got["to"] != "09123456789" || got["channel"] != ChannelSMS || got["message"] != "Your goAuth verification code is 123456. It expires in 2 minutes." {
+				t.Fatalf("gateway received %v", got)
+			}
+		})
+	}
+}
+
+func TestHTTPSenderVoice(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	msg := Message{Recipient: "09123456789", Code: "123456", Channel: ChannelVoice, Body: "sms text", VoiceBody: "1 2 3 4 5 6"}
+	if err := NewHTTPSender(srv.URL, "", time.Second).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got["channel"] != ChannelVoice || got["message"] != "1 2 3 4 5 6" {
+		t.Fatalf("voice gateway received %v", got)
+	}
+}
+
+func TestHTTPSenderUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	err := NewHTTPSender(srv.URL, "", time.Second).Send(context.Background(), Message{Recipient: "09123456789", Code: "123456"})
+	if !errors.Is(err, ErrTemporary) {
+		t.Fatalf("Send() error = %v, want ErrTemporary", err)
+	}
+}
@@ -0,0 +1,388 @@
+package delivery
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand/v2"
+	"sync"
+	"time"
+
+	"goAuth/internal/database/model"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// QueueConfig tunes a Queue.
+type QueueConfig struct {
+	// Workers is the number of concurrent deliveries.
+	Workers int
+	// MaxAttempts is how many times a message is tried before it is
+	// dead-lettered.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry; it doubles on every
+	// further attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// PollInterval is how often the queue looks for retries that became due.
+	PollInterval time.Duration
+	// Lease is how long a claimed message is hidden from other claimers, so
+	// messages held by a crashed process are picked up again.
+	Lease time.Duration
+	// SendTimeout bounds a single delivery attempt.
+	SendTimeout time.Duration
+	// Key encrypts queued messages. It is required and must stay the same
+	// across restarts, or messages left over from a previous run cannot be
+	// delivered.
+	Key []byte
+}
+
+// Queue is an OTPSender that stores messages in the database and delivers
+// them from a pool of background workers, retrying temporary failures with
+// exponential backoff. Messages that fail permanently, run out of attempts or
+// expire are moved to the dead-letter table.
+type Queue struct {
+	db      *gorm.DB
+	sender  OTPSender
+	logger  *zap.Logger
+	config  QueueConfig
+	aead    cipher.AEAD
+	tracker Tracker
+
+	wake     chan struct{}
+	jobs     chan model.OTPDelivery
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	// ctx is cancelled when draining runs out of time, aborting in-flight sends.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewQueue returns a queue delivering through sender. Call Start to run the
+// workers.
+func NewQueue(db *gorm.DB, sender OTPSender, config QueueConfig) (*Queue, error) {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = time.Second
+	}
+	if config.MaxBackoff < config.BaseBackoff {
+		config.MaxBackoff = config.BaseBackoff
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.SendTimeout <= 0 {
+		config.SendTimeout = defaultTimeout
+	}
+	if config.Lease <= config.SendTimeout {
+		config.Lease = 2 * config.SendTimeout
+	}
+
+	if len(config.Key) == 0 {
+		return nil, errQueueKeyRequired
+	}
+	sum := sha256.Sum256(append([]byte("goAuth otp delivery queue:"), config.Key...))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		db:     db,
+		sender: sender,
+		logger: zap.L(),
+		config: config,
+		aead:   aead,
+		wake:   make(chan struct{}, 1),
+		jobs:   make(chan model.OTPDelivery),
+		stop:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// Start launches the dispatcher and the workers.
+func (q *Queue) Start() {
+	q.wg.Add(1 + q.config.Workers)
+	go q.dispatch()
+	for range q.config.Workers {
+		go q.work()
+	}
+}
+
+// SetTracker records queued and dead-lettered messages in tracker.
+func (q *Queue) SetTracker(tracker Tracker) {
+	q.tracker = tracker
+}
+
+// Send enqueues msg; it returns once the message is stored, not delivered.
+func (q *Queue) Send(_ context.Context, msg Message) error {
+	select {
+	case <-q.stop:
+		return fmt.Errorf("%w: delivery queue is shutting down", ErrTemporary)
+	default:
+	}
+
+	payload, err := q.seal(msg)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTemporary, err)
+	}
+	now := time.Now().UTC()
+	job := model.OTPDelivery{
+		RequestID:     msg.RequestID,
+		Recipient:     msg.Recipient,
+		Payload:       payload,
+		ExpiresAt:     now.Add(msg.ExpiresIn),
+		NextAttemptAt: now,
+	}
+	if err := q.db.Create(&job).Error; err != nil {
+		return fmt.Errorf("%w: enqueueing otp: %w", ErrTemporary, err)
+	}
+	if q.tracker != nil {
+		q.tracker.Queued(msg)
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Drain stops accepting messages, delivers the ones already due and waits
+// for the workers to finish. When ctx expires first, in-flight deliveries are
+// aborted and rescheduled; undelivered messages stay in the database for the
+// next run.
+func (q *Queue) Drain(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) dispatch() {
+	defer q.wg.Done()
+	defer close(q.jobs)
+
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		q.dispatchDue()
+		select {
+		case <-q.wake:
+		case <-ticker.C:
+		case <-q.stop:
+			// Hand out what is due now, then let the workers finish.
+			q.dispatchDue()
+			return
+		}
+	}
+}
+
+// dispatchDue hands every due message to the workers.
+func (q *Queue) dispatchDue() {
+	for q.ctx.Err() == nil {
+		job, ok := q.claim()
+		if !ok {
+			return
+		}
+		select {
+		case q.jobs <- job:
+		case <-q.ctx.Done():
+			q.release(job)
+			return
+		}
+	}
+}
+
+// claim locks the next due message.
+func (q *Queue) claim() (model.OTPDelivery, bool) {
+	for {
+		now := time.Now().UTC()
+		// Find rather than First: an empty queue is the common case and
+		// should not be logged as a missing record on every poll.
+		var jobs []model.OTPDelivery
+		err := q.db.
+			Where("next_attempt_at <= ? AND (locked_until IS NULL OR locked_until <= ?)", now, now).
+			Order("next_attempt_at").
+			Limit(1).
+			Find(&jobs).Error
+		if err != nil {
+			q.logger.Error("failed to load queued otp", zap.Error(err))
+			return model.OTPDelivery{}, false
+		}
+		if len(jobs) == 0 {
+			return model.OTPDelivery{}, false
+		}
+		job := jobs[0]
+
+		lockedUntil := now.Add(q.config.Lease)
+		result := q.db.Model(&model.OTPDelivery{}).
+			Where("id = ? AND (locked_until IS NULL OR locked_until <= ?)", job.ID, now).
+			Update("locked_until", lockedUntil)
+		if result.Error != nil {
+			q.logger.Error("failed to claim queued otp", zap.Error(result.Error))
+			return job, false
+		}
+		if result.RowsAffected == 1 {
+			job.LockedUntil = &lockedUntil
+			return job, true
+		}
+		// Someone else claimed it first; look for the next one.
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		q.deliver(job)
+	}
+}
+
+func (q *Queue) deliver(job model.OTPDelivery) {
+	msg, err := q.open(job.Payload)
+	if err != nil {
+		q.deadLetter(job, "message cannot be decrypted")
+		return
+	}
+	remaining := time.Until(job.ExpiresAt)
+	if remaining <= 0 {
+		q.deadLetter(job, "expired before delivery")
+		return
+	}
+	if remaining >= time.Minute {
+		msg.ExpiresIn = remaining.Round(time.Minute)
+	} else {
+		msg.ExpiresIn = remaining.Round(time.Second)
+	}
+
+	ctx, cancel := context.WithTimeout(q.ctx, q.config.SendTimeout)
+	err = q.sender.Send(ctx, msg)
+	cancel()
+
+	if err == nil {
+		if err := q.db.Delete(&model.OTPDelivery{}, job.ID).Error; err != nil {
+			q.logger.Error("failed to remove delivered otp", zap.Uint("id", job.ID), zap.Error(err))
+		}
+		return
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	next := time.Now().UTC().Add(q.backoff(job.Attempts))
+	switch {
+	case errors.Is(err, ErrPermanent), job.Attempts >= q.config.MaxAttempts, !next.Before(job.ExpiresAt):
+		q.deadLetter(job, job.LastError)
+	default:
+		q.logger.Warn("otp delivery failed, retrying",
+			zap.String("recipient", job.Recipient), zap.Int("attempt", job.Attempts), zap.Time("next_attempt", next), zap.Error(err))
+		err := q.db.Model(&model.OTPDelivery{}).Where("id = ?", job.ID).Updates(map[string]any{
+			"attempts":        job.Attempts,
+			"last_error":      job.LastError,
+			"next_attempt_at": next,
+			"locked_until":    nil,
+		}).Error
+		if err != nil {
+			q.logger.Error("failed to reschedule otp", zap.Uint("id", job.ID), zap.Error(err))
+		}
+	}
+}
+
+// release unlocks a claimed message without counting an attempt.
+func (q *Queue) release(job model.OTPDelivery) {
+	if err := q.db.Model(&model.OTPDelivery{}).Where("id = ?", job.ID).Update("locked_until", nil).Error; err != nil {
+		q.logger.Error("failed to release queued otp", zap.Uint("id", job.ID), zap.Error(err))
+	}
+}
+
+func (q *Queue) deadLetter(job model.OTPDelivery, reason string) {
+	q.logger.Error("otp delivery failed permanently",
+		zap.String("recipient", job.Recipient), zap.Int("attempts", job.Attempts), zap.String("reason", reason))
+
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&model.OTPDeadLetter{
+			RequestID:  job.RequestID,
+			Recipient:  job.Recipient,
+			EnqueuedAt: job.CreatedAt,
+			Attempts:   job.Attempts,
+			LastError:  reason,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.OTPDelivery{}, job.ID).Error
+	})
+	if err != nil {
+		q.logger.Error("failed to dead-letter otp", zap.Uint("id", job.ID), zap.Error(err))
+	}
+	if q.tracker != nil {
+		q.tracker.Failed(Message{RequestID: job.RequestID, Recipient: job.Recipient}, reason)
+	}
+}
+
+// backoff returns the delay before the given attempt is retried, with up to
+// 20% jitter so retries from a provider outage do not arrive all at once.
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.config.BaseBackoff
+	for i := 1; i < attempts && d < q.config.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, q.config.MaxBackoff)
+	return d - time.Duration(mathrand.Int64N(int64(d)/5+1))
+}
+
+func (q *Queue) seal(msg Message) ([]byte, error) {
+	plain, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, q.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return q.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func (q *Queue) open(payload []byte) (Message, error) {
+	var msg Message
+	size := q.aead.NonceSize()
+	if len(payload) < size {
+		return msg, errors.New("payload too short")
+	}
+	plain, err := q.aead.Open(nil, payload[:size], payload[size:], nil)
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(plain, &msg)
+	return msg, err
+}
@@ -0,0 +1,171 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"goAuth/internal/database/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// flakySender fails the first failures sends with err, then records messages.
+type flakySender struct {
+	RecordingSender
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+}
+
+func (s *flakySender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	s.calls++
+	fail := s.calls <= s.failures
+	s.mu.Unlock()
+	if fail {
+		return s.err
+	}
+	return s.RecordingSender.Send(ctx, msg)
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "delivery.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.OTPDelivery{}, &model.OTPDeadLetter{}, &model.OTPMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestQueue(t *testing.T, sender OTPSender) (*Queue, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t)
+	q, err := NewQueue(db, sender, QueueConfig{
+		Workers:      2,
+		MaxAttempts:  3,
+		BaseBackoff:  10 * time.Millisecond,
+		MaxBackoff:   20 * time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+		Key:          []byte("test-key"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	t.Cleanup(func() { q.Drain(context.Background()) })
+	return q, db
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func count(db *gorm.DB, m any) int64 {
+	var n int64
+	db.Model(m).Count(&n)
+	return n
+}
+
+var testMessage = Message{Recipient: "09123456789", Code: "123456", ExpiresIn: 2 * time.Minute}
+
+func TestQueueRetriesTemporaryFailures(t *testing.T) {
+	sender := &flakySender{failures: 2, err: fmt.Errorf("%w: gateway down", ErrTemporary)}
+	q, db := newTestQueue(t, sender)
+
+	if err := q.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	waitFor(t, func() bool { return len(sender.Messages()) == 1 })
+
+	if got := sender.Messages()[0]; got.Recipient != testMessage.Recipient || got.Code != testMessage.Code || got.ExpiresIn != 2*time.Minute {
+		t.Fatalf("delivered %+v, want %+v", got, testMessage)
+	}
+	waitFor(t, func() bool { return count(db, &model.OTPDelivery{}) == 0 })
+	if n := count(db, &model.OTPDeadLetter{}); n != 0 {
+		t.Fatalf("%d dead letters, want 0", n)
+	}
+}
+
+func TestQueueDeadLetters(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int
+	}{
+		{"permanent failure", fmt.Errorf("%w: invalid number", ErrPermanent), 1},
+		{"attempts exhausted", fmt.Errorf("%w: gateway down", ErrTemporary), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &flakySender{failures: 10, err: tt.err}
+			q, db := newTestQueue(t, sender)
+
+			if err := q.Send(context.Background(), testMessage); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			waitFor(t, func() bool { return count(db, &model.OTPDeadLetter{}) == 1 })
+
+			var letter model.OTPDeadLetter
+			db.First(&letter)
+			if letter.Recipient != testMessage.Recipient || letter.Attempts != tt.wantAttempts {
+				t.Fatalf("dead letter = %+v, want %d attempts", letter, tt.wantAttempts)
+			}
+			if n := count(db, &model.OTPDelivery{}); n != 0 {
+				t.Fatalf("%d messages still queued, want 0", n)
+			}
+		})
+	}
+}
+
+func TestQueueEncryptsPayload(t *testing.T) {
+	sender := &flakySender{failures: 100, err: fmt.Errorf("%w: gateway down", ErrTemporary)}
+	q, db := newTestQueue(t, sender)
+
+	if err := q.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	var job model.OTPDelivery
+	if err := db.First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(job.Payload, []byte(testMessage.Code)) {
+		t.Fatal("queued payload contains the plaintext code")
+	}
+}
+
+func TestQueueDrain(t *testing.T) {
+	sender := &flakySender{}
+	q, _ := newTestQueue(t, sender)
+
+	for range 5 {
+		if err := q.Send(context.Background(), testMessage); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if err := q.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	if n := len(sender.Messages()); n != 5 {
+		t.Fatalf("delivered %d messages before draining finished, want 5", n)
+	}
+	if err := q.Send(context.Background(), testMessage); err == nil {
+		t.Fatal("Send() after Drain() succeeded")
+	}
+}
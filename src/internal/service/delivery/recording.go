@@ -0,0 +1,42 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+)
+
+// RecordingSender keeps every message in memory. It is a fake for tests.
+type RecordingSender struct {
+	mu       sync.Mutex
+	messages []Message
+
+	// Err, when set, is returned by Send instead of recording the message.
+	Err error
+}
+
+func (s *RecordingSender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns the recorded messages.
+func (s *RecordingSender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Last returns the most recent message.
+func (s *RecordingSender) Last() (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) == 0 {
+		return Message{}, false
+	}
+	return s.messages[len(s.messages)-1], true
+}
@@ -0,0 +1,277 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goAuth/internal/server/api/schema"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// statsDecay weighs the latest result in the moving success rate and
+	// latency averages.
+	statsDecay = 0.2
+	// A provider whose success rate drops below degradedSuccessRate is tried
+	// after the healthy ones until degradedCooldown passes without a failure.
+	degradedSuccessRate = 0.5
+	degradedCooldown    = time.Minute
+)
+
+// Router is an OTPSender that picks providers by the message's channel and
+// the recipient's prefix and fails over to the next provider of the route when one fails or times out.
+// It keeps per-provider success and latency statistics and tries degraded
+// providers last.
+type Router struct {
+	logger    *zap.Logger
+	tracker   Tracker
+	providers []*provider
+	// routes are sorted by descending prefix length so the longest match wins.
+	routes []route
+	now    func() time.Time
+}
+
+type route struct {
+	channel   string
+	prefix    string
+	providers []*provider
+}
+
+type provider struct {
+	name    string
+	sender  OTPSender
+	timeout time.Duration
+
+	mu          sync.Mutex
+	sent        uint64
+	failed      uint64
+	successRate float64
+	latency     float64 // nanoseconds
+	lastError   string
+	lastFailure time.Time
+}
+
+// NewRouter builds the providers and routes of config.
+func NewRouter(config RoutingConfig) (*Router, error) {
+	senders := make(map[string]OTPSender, len(config.Providers))
+	timeouts := make(map[string]time.Duration, len(config.Providers))
+	for name, provider := range config.Providers {
+		sender, err := provider.Build()
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %w", name, err)
+		}
+		senders[name], timeouts[name] = sender, provider.timeout()
+	}
+	return newRouter(senders, timeouts, config.Routes)
+}
+
+func newRouter(senders map[string]OTPSender, timeouts map[string]time.Duration, routes []RouteConfig) (*Router, error) {
+	if len(routes) == 0 {
+		return nil, errors.New("no otp routes configured")
+	}
+
+	r := &Router{logger: zap.L(), now: time.Now}
+	byName := make(map[string]*provider, len(senders))
+	for name, sender := range senders {
+		p := &provider{name: name, sender: sender, timeout: timeouts[name], successRate: 1}
+		if p.timeout <= 0 {
+			p.timeout = defaultTimeout
+		}
+		byName[name] = p
+		r.providers = append(r.providers, p)
+	}
+	sort.Slice(r.providers, func(i, j int) bool { return r.providers[i].name < r.providers[j].name })
+
+	for _, rc := range routes {
+		if len(rc.Providers) == 0 {
+			return nil, fmt.Errorf("route %q has no providers", rc.Prefix)
+		}
+		channel := rc.Channel
+		if channel == "" {
+			channel = ChannelSMS
+		}
+		if !slices.Contains(Channels, channel) {
+			return nil, fmt.Errorf("route %q has unknown channel %q", rc.Prefix, rc.Channel)
+		}
+		rt := route{channel: channel, prefix: rc.Prefix}
+		for _, name := range rc.Providers {
+			p, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("route %q uses unknown provider %q", rc.Prefix, name)
+			}
+			rt.providers = append(rt.providers, p)
+		}
+		r.routes = append(r.routes, rt)
+	}
+	sort.SliceStable(r.routes, func(i, j int) bool { return len(r.routes[i].prefix) > len(r.routes[j].prefix) })
+	return r, nil
+}
+
+// Send delivers msg through the first provider of the matching route that
+// succeeds. The error wraps ErrTemporary if any provider failed temporarily,
+// so the message is retried, and ErrPermanent only when all of them rejected it.
+func (r *Router) Send(ctx context.Context, msg Message) error {
+	rt, ok := r.route(msg.DeliveryChannel(), msg.Recipient)
+	if !ok {
+		return fmt.Errorf("%w: no otp provider routes %s to %q", ErrPermanent, msg.DeliveryChannel(), msg.Recipient)
+	}
+
+	var (
+		errs      []error
+		temporary bool
+	)
+	for _, p := range r.rank(rt.providers) {
+		if err := ctx.Err(); err != nil {
+			errs, temporary = append(errs, err), true
+			break
+		}
+		err := r.send(ctx, p, msg)
+		if err == nil {
+			if r.tracker != nil {
+				r.tracker.Sent(msg, p.name)
+			}
+			return nil
+		}
+		r.logger.Warn("otp provider failed", zap.String("provider", p.name), zap.Error(err))
+		errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+		if !errors.Is(err, ErrPermanent) {
+			temporary = true
+		}
+	}
+
+	// Flatten the provider errors so only one of the two classes is wrapped.
+	reason := errors.Join(errs...).Error()
+	if temporary {
+		return fmt.Errorf("%w: %s", ErrTemporary, reason)
+	}
+	return fmt.Errorf("%w: %s", ErrPermanent, reason)
+}
+
+// SetTracker records which provider sent each message in tracker.
+func (r *Router) SetTracker(tracker Tracker) {
+	r.tracker = tracker
+}
+
+// Supports reports whether a route delivers channel to recipient.
+func (r *Router) Supports(channel, recipient string) bool {
+	_, ok := r.route(channel, recipient)
+	return ok
+}
+
+// Timeout returns the longest a Send can take when every provider of a route
+// times out.
+func (r *Router) Timeout() time.Duration {
+	var longest time.Duration
+	for _, rt := range r.routes {
+		var total time.Duration
+		for _, p := range rt.providers {
+			total += p.timeout
+		}
+		longest = max(longest, total)
+	}
+	return longest
+}
+
+// Stats reports every provider's statistics, sorted by name.
+func (r *Router) Stats() []schema.ProviderStats {
+	now := r.now()
+	stats := make([]schema.ProviderStats, 0, len(r.providers))
+	for _, p := range r.providers {
+		p.mu.Lock()
+		s := schema.ProviderStats{
+			Name:        p.name,
+			Sent:        p.sent,
+			Failed:      p.failed,
+			SuccessRate: p.successRate,
+			LatencyMS:   p.latency / float64(time.Millisecond),
+			Degraded:    p.degradedLocked(now),
+			LastError:   p.lastError,
+		}
+		if !p.lastFailure.IsZero() {
+			at := p.lastFailure
+			s.LastFailureAt = &at
+		}
+		p.mu.Unlock()
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+func (r *Router) route(channel, recipient string) (route, bool) {
+	for _, rt := range r.routes {
+		if rt.channel == channel && strings.HasPrefix(recipient, rt.prefix) {
+			return rt, true
+		}
+	}
+	return route{}, false
+}
+
+// rank returns providers in configured order with degraded ones moved last.
+func (r *Router) rank(providers []*provider) []*provider {
+	now := r.now()
+	ranked := slices.Clone(providers)
+	slices.SortStableFunc(ranked, func(a, b *provider) int {
+		da, db := a.degraded(now), b.degraded(now)
+		switch {
+		case da == db:
+			return 0
+		case db:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return ranked
+}
+
+func (r *Router) send(ctx context.Context, p *provider, msg Message) error {
+	attemptCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	start := r.now()
+	err := p.sender.Send(attemptCtx, msg)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up; that says nothing about the provider.
+		return err
+	}
+	p.record(err, r.now().Sub(start), r.now())
+	return err
+}
+
+func (p *provider) record(err error, latency time.Duration, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := 1.0
+	if err != nil {
+		result = 0
+		p.failed++
+		p.lastError = err.Error()
+		p.lastFailure = now
+	} else {
+		p.sent++
+	}
+	p.successRate = (1-statsDecay)*p.successRate + statsDecay*result
+	if p.sent+p.failed == 1 {
+		p.latency = float64(latency)
+	} else {
+		p.latency = (1-statsDecay)*p.latency + statsDecay*float64(latency)
+	}
+}
+
+func (p *provider) degraded(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.degradedLocked(now)
+}
+
+func (p *provider) degradedLocked(now time.Time) bool {
+	return p.successRate < degradedSuccessRate && now.Sub(p.lastFailure) < degradedCooldown
+}
@@ -0,0 +1,152 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestRouter(t *testing.T, senders map[string]OTPSender, routes ...RouteConfig) *Router {
+	t.Helper()
+	r, err := newRouter(senders, nil, routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRouterPicksLongestPrefix(t *testing.T) {
+	local, global := &RecordingSender{}, &RecordingSender{}
+	r := newTestRouter(t, map[string]OTPSender{"local": local, "global": global},
+		RouteConfig{Prefix: "", Providers: []string{"global"}},
+		RouteConfig{Prefix: "+98", Providers: []string{"local"}},
+	)
+
+	for _, recipient := range []string{"+989123456789", "+12025550123"} {
+		if err := r.Send(context.Background(), Message{Recipient: recipient}); err != nil {
+			t.Fatalf("Send(%s) error = %v", recipient, err)
+		}
+	}
+	if m, _ := local.Last(); len(local.Messages()) != 1 || m.Recipient != "+989123456789" {
+		t.Fatalf("local provider got %v", local.Messages())
+	}
+	if m, _ := global.Last(); len(global.Messages()) != 1 || m.Recipient != "+12025550123" {
+		t.Fatalf("global provider got %v", global.Messages())
+	}
+}
+
+func TestRouterNoRoute(t *testing.T) {
+	r := newTestRouter(t, map[string]OTPSender{"local": &RecordingSender{}},
+		RouteConfig{Prefix: "+98", Providers: []string{"local"}},
+	)
+	if err := r.Send(context.Background(), Message{Recipient: "+12025550123"}); !errors.Is(err, ErrPermanent) {
+		t.Fatalf("Send() error = %v, want ErrPermanent", err)
+	}
+}
+
+func TestRouterRoutesByChannel(t *testing.T) {
+	sms, voice := &RecordingSender{}, &RecordingSender{}
+	r := newTestRouter(t, map[string]OTPSender{"sms": sms, "voice": voice},
+		RouteConfig{Providers: []string{"sms"}},
+		RouteConfig{Channel: ChannelVoice, Prefix: "+98", Providers: []string{"voice"}},
+	)
+
+	if err := r.Send(context.Background(), Message{Recipient: "+989123456789", Channel: ChannelVoice}); err != nil {
+		t.Fatalf("Send(voice) error = %v", err)
+	}
+	if err := r.Send(context.Background(), Message{Recipient: "+989123456789"}); err != nil {
+		t.Fatalf("Send(sms) error = %v", err)
+	}
+	if len(voice.Messages()) != 1 || len(sms.Messages()) != 1 {
+		t.Fatalf("voice got %v, sms got %v", voice.Messages(), sms.Messages())
+	}
+
+	for _, tt := range []struct {
+		channel, recipient string
+		want               bool
+	}{
+		{ChannelSMS, "+12025550123", true},
+		{ChannelVoice, "+989123456789", true},
+		{ChannelVoice, "+12025550123", false},
+		{ChannelMessagingApp, "+989123456789", false},
+	} {
+		if got := r.Supports(tt.channel, tt.recipient); got != tt.want {
+			t.Errorf("Supports(%s, %s) = %v, want %v", tt.channel, tt.recipient, got, tt.want)
+		}
+	}
+	if err := r.Send(context.Background(), Message{Recipient: "+12025550123", Channel: ChannelVoice}); !errors.Is(err, ErrPermanent) {
+		t.Fatalf("Send(unrouted voice) error = %v, want ErrPermanent", err)
+	}
+}
+
+func TestRouterFailsOver(t *testing.T) {
+	primary := &RecordingSender{Err: fmt.Errorf("%w: outage", ErrTemporary)}
+	backup := &RecordingSender{}
+	r := newTestRouter(t, map[string]OTPSender{"primary": primary, "backup": backup},
+		RouteConfig{Providers: []string{"primary", "backup"}},
+	)
+
+	if err := r.Send(context.Background(), Message{Recipient: "09123456789"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(backup.Messages()) != 1 {
+		t.Fatal("backup provider was not used")
+	}
+
+	stats := r.Stats()
+	if stats[1].Name != "primary" || stats[1].Failed != 1 || stats[1].LastError == "" {
+		t.Fatalf("primary stats = %+v", stats[1])
+	}
+	if stats[0].Name != "backup" || stats[0].Sent != 1 {
+		t.Fatalf("backup stats = %+v", stats[0])
+	}
+}
+
+func TestRouterErrorClass(t *testing.T) {
+	rejected := &RecordingSender{Err: fmt.Errorf("%w: bad number", ErrPermanent)}
+	down := &RecordingSender{Err: fmt.Errorf("%w: outage", ErrTemporary)}
+
+	r := newTestRouter(t, map[string]OTPSender{"a": rejected, "b": rejected}, RouteConfig{Providers: []string{"a", "b"}})
+	if err := r.Send(context.Background(), Message{}); !errors.Is(err, ErrPermanent) || errors.Is(err, ErrTemporary) {
+		t.Fatalf("all rejected: error = %v, want only ErrPermanent", err)
+	}
+
+	r = newTestRouter(t, map[string]OTPSender{"a": rejected, "b": down}, RouteConfig{Providers: []string{"a", "b"}})
+	if err := r.Send(context.Background(), Message{}); !errors.Is(err, ErrTemporary) || errors.Is(err, ErrPermanent) {
+		t.Fatalf("one unavailable: error = %v, want only ErrTemporary", err)
+	}
+}
+
+func TestRouterDownRanksFailingProvider(t *testing.T) {
+	flaky, steady := &RecordingSender{Err: fmt.Errorf("%w: outage", ErrTemporary)}, &RecordingSender{}
+	r := newTestRouter(t, map[string]OTPSender{"flaky": flaky, "steady": steady},
+		RouteConfig{Providers: []string{"flaky", "steady"}},
+	)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	// Each failure lowers flaky's success rate until it is degraded.
+	for range 4 {
+		r.Send(context.Background(), Message{})
+	}
+	if !r.Stats()[0].Degraded {
+		t.Fatalf("flaky not degraded: %+v", r.Stats()[0])
+	}
+	failures := r.Stats()[0].Failed
+
+	// Degraded providers are tried last, so flaky is no longer called.
+	r.Send(context.Background(), Message{})
+	if got := r.Stats()[0].Failed; got != failures {
+		t.Fatalf("degraded provider was tried first: failed %d, want %d", got, failures)
+	}
+
+	// Once the cooldown passes it gets its configured position back.
+	now = now.Add(degradedCooldown)
+	flaky.Err = nil
+	r.Send(context.Background(), Message{})
+	if len(flaky.Messages()) != 1 {
+		t.Fatal("provider was not retried after the cooldown")
+	}
+}
@@ -0,0 +1,125 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrPermanent marks a delivery the provider rejected; retrying will not help.
+	ErrPermanent = errors.New("otp delivery rejected")
+	// ErrTemporary marks a delivery that failed because the provider was
+	// unreachable or overloaded; it may succeed later.
+	ErrTemporary = errors.New("otp delivery unavailable")
+)
+
+// Delivery channels.
+const (
+	ChannelSMS          = "sms"
+	ChannelVoice        = "voice"
+	ChannelMessagingApp = "messaging-app"
+	ChannelEmail        = "email"
+)
+
+// Channels lists every delivery channel.
+var Channels = []string{ChannelSMS, ChannelVoice, ChannelMessagingApp, ChannelEmail}
+
+// Message is an OTP to deliver.
+type Message struct {
+	// RequestID identifies the OTP request; providers echo it in receipts.
+	RequestID string
+	// Recipient is the phone number or email address the code is sent to.
+	Recipient string
+	Code      string
+	ExpiresIn time.Duration
+	// Channel is how the code reaches the recipient; empty means SMS.
+	Channel string
+	// Locale is the recipient's language preference: a language tag or an
+	// Accept-Language value.
+	Locale string
+	// Link, when set, is a sign-in URL sent by email instead of Code.
+	Link string
+
+	// Body, VoiceBody, Subject and EmailBody are filled in from the locale's
+	// templates just before delivery.
+	Body      string
+	VoiceBody string
+	Subject   string
+	EmailBody string
+}
+
+// DeliveryChannel returns the channel of the message, defaulting to SMS.
+func (m Message) DeliveryChannel() string {
+	if m.Channel == "" {
+		return ChannelSMS
+	}
+	return m.Channel
+}
+
+// Text returns the short text body of the message, used for SMS.
+func (m Message) Text() string {
+	if m.Body != "" {
+		return m.Body
+	}
+	if m.Link != "" {
+		return fmt.Sprintf("Sign in to goAuth: %s. The link expires in %s.", m.Link, humanDuration(m.ExpiresIn))
+	}
+	return fmt.Sprintf("Your goAuth verification code is %s. It expires in %s.", m.Code, humanDuration(m.ExpiresIn))
+}
+
+// VoiceText returns the script read out by voice calls.
+func (m Message) VoiceText() string {
+	if m.VoiceBody != "" {
+		return m.VoiceBody
+	}
+	return m.Text()
+}
+
+// ChannelText returns the text fitting the message's channel: the voice
+// script for calls, the email body for email and the SMS text otherwise.
+func (m Message) ChannelText() string {
+	switch m.DeliveryChannel() {
+	case ChannelVoice:
+		return m.VoiceText()
+	case ChannelEmail:
+		return m.EmailText()
+	default:
+		return m.Text()
+	}
+}
+
+// EmailSubject returns the subject of the message when sent by email.
+func (m Message) EmailSubject() string {
+	if m.Subject != "" {
+		return m.Subject
+	}
+	return "Your verification code"
+}
+
+// EmailText returns the body of the message when sent by email.
+func (m Message) EmailText() string {
+	if m.EmailBody != "" {
+		return m.EmailBody
+	}
+	return m.Text()
+}
+
+// OTPSender delivers OTP codes to users. Errors should wrap ErrPermanent or
+// ErrTemporary so callers can tell the two apart.
+type OTPSender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute && d%time.Minute == 0:
+		if d == time.Minute {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
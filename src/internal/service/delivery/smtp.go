@@ -0,0 +1,139 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPSender delivers OTPs by email.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+
+	// RecipientFormat turns a phone number into an email address, e.g.
+	// "%s@sms.example.com" for an email-to-SMS gateway. Recipients that are
+	// email addresses already are used as is.
+	RecipientFormat string
+
+	Timeout time.Duration
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	to := msg.Recipient
+	if s.RecipientFormat != "" && !strings.Contains(to, "@") {
+		to = fmt.Sprintf(s.RecipientFormat, to)
+	}
+	if !strings.Contains(to, "@") {
+		return fmt.Errorf("%w: %q is not an email address", ErrPermanent, to)
+	}
+
+	addr := net.JoinHostPort(s.Host, fmt.Sprint(s.Port))
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	var text bytes.Buffer
+	qp := quotedprintable.NewWriter(&text)
+	qp.Write([]byte(msg.EmailText()))
+	qp.Close()
+
+	body := strings.Join([]string{
+		"From: " + s.From,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("UTF-8", msg.EmailSubject()),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		text.String(),
+	}, "\r\n")
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := s.sendMail(ctx, addr, auth, to, []byte(body))
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: smtp timed out: %w", ErrTemporary, err)
+	}
+
+	// 5xx replies are permanent per RFC 5321; anything else may recover.
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return fmt.Errorf("%w: %w", ErrTemporary, err)
+}
+
+// sendMail is smtp.SendMail over a connection bound to ctx: net/smtp has no
+// context support, so the connection's deadline is set from ctx and it is
+// closed if ctx ends first, which unblocks any exchange in flight.
+func (s *SMTPSender) sendMail(ctx context.Context, addr string, auth smtp.Auth, to string, body []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,114 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP answers one connection. rcptReply is sent for RCPT TO; an empty
+// rcptReply never greets the client. The received message is sent to data.
+func fakeSMTP(t *testing.T, rcptReply string) (addr string, data <-chan string, closed <-chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	dataCh, closedCh := make(chan string, 1), make(chan struct{})
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		defer close(closedCh)
+		if rcptReply == "" {
+			io.Copy(io.Discard, conn)
+			return
+		}
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch verb, _, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+			case "EHLO":
+				tp.PrintfLine("250 fake")
+			case "RCPT":
+				tp.PrintfLine("%s", rcptReply)
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				lines, _ := tp.ReadDotLines()
+				dataCh <- strings.Join(lines, "\n")
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), dataCh, closedCh
+}
+
+func newTestSMTPSender(t *testing.T, addr string) *SMTPSender {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SMTPSender{Host: host, Port: p, From: "otp@example.com", RecipientFormat: "%s@sms.example.com", Timeout: 200 * time.Millisecond}
+}
+
+func TestSMTPSenderSends(t *testing.T) {
+	addr, data, _ := fakeSMTP(t, "250 ok")
+	msg := Message{Recipient: "+989123456789", Code: "482913", ExpiresIn: time.Minute, Channel: ChannelEmail}
+	if err := newTestSMTPSender(t, addr).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if body := <-data; !strings.Contains(body, "To: +989123456789@sms.example.com") || !strings.Contains(body, "482913") {
+		t.Fatalf("sent message = %q", body)
+	}
+}
+
+func TestSMTPSenderRejectedRecipientIsPermanent(t *testing.T) {
+	addr, _, _ := fakeSMTP(t, "550 no such user")
+	err := newTestSMTPSender(t, addr).Send(context.Background(), Message{Recipient: "user@example.com"})
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("Send() error = %v, want %v", err, ErrPermanent)
+	}
+}
+
+func TestSMTPSenderTimeoutClosesConnection(t *testing.T) {
+	addr, _, closed := fakeSMTP(t, "")
+	sender := newTestSMTPSender(t, addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := sender.Send(ctx, Message{Recipient: "user@example.com"}); !errors.Is(err, ErrTemporary) {
+		t.Fatalf("Send() to a stalled server error = %v, want %v", err, ErrTemporary)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("Send() took %s, want it bounded by the context", elapsed)
+	}
+
+	// The exchange is abandoned, not left running against the server.
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection to the stalled server was left open")
+	}
+}
@@ -0,0 +1,341 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Template files of a locale directory.
+const (
+	smsTemplate          = "sms.tmpl"
+	voiceTemplate        = "voice.tmpl"
+	emailSubjectTemplate = "email_subject.tmpl"
+	emailBodyTemplate    = "email_body.tmpl"
+
+	magicLinkSubjectTemplate = "magic_link_subject.tmpl"
+	magicLinkBodyTemplate    = "magic_link_body.tmpl"
+)
+
+var templateFiles = []string{
+	smsTemplate, voiceTemplate, emailSubjectTemplate, emailBodyTemplate,
+	magicLinkSubjectTemplate, magicLinkBodyTemplate,
+}
+
+//go:embed templates
+var builtinTemplates embed.FS
+
+// TemplateData is what OTP templates are rendered with.
+type TemplateData struct {
+	AppName string
+	Code    string
+	// SpacedCode separates the digits so text-to-speech reads them one by one.
+	SpacedCode       string
+	ExpiresIn        time.Duration
+	ExpiresInMinutes int
+	Locale           string
+	// Link is the sign-in URL of a magic-link email.
+	Link string
+}
+
+// Templates renders OTP messages in the recipient's language. Every locale
+// is a directory holding sms.tmpl, voice.tmpl, email_subject.tmpl,
+// email_body.tmpl, magic_link_subject.tmpl and magic_link_body.tmpl, written
+// with text/template. Built-in en, fa and ar templates can be
+// overridden, and new locales added, from a directory on disk; files missing
+// from a locale fall back to the default locale's.
+type Templates struct {
+	dir           string
+	defaultLocale string
+	appName       string
+	logger        *zap.Logger
+
+	mu      sync.RWMutex
+	locales map[string]map[string]*template.Template
+	modTime time.Time
+}
+
+// LoadTemplates loads the built-in templates overridden by those in dir,
+// which may be empty.
+func LoadTemplates(dir, defaultLocale, appName string) (*Templates, error) {
+	t := &Templates{
+		dir:           dir,
+		defaultLocale: strings.ToLower(defaultLocale),
+		appName:       appName,
+		logger:        zap.L(),
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Locales returns the available locales, sorted.
+func (t *Templates) Locales() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	locales := make([]string, 0, len(t.locales))
+	for locale := range t.locales {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// Match returns the best available locale for preference, which is either a
+// single language tag or an Accept-Language header value. Regional tags fall
+// back to their base language ("fa-IR" matches "fa"); without a match the
+// default locale is returned.
+func (t *Templates) Match(preference string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, tag := range parseAcceptLanguage(preference) {
+		if _, ok := t.locales[tag]; ok {
+			return tag
+		}
+		if base, _, found := strings.Cut(tag, "-"); found {
+			if _, ok := t.locales[base]; ok {
+				return base
+			}
+		}
+	}
+	return t.defaultLocale
+}
+
+// Render fills in the SMS body, voice script, email subject and email body of
+// msg in the locale best matching msg.Locale. Messages carrying a Link get the
+// magic-link email instead of the code email.
+func (t *Templates) Render(msg Message) (Message, error) {
+	locale := t.Match(msg.Locale)
+	data := TemplateData{
+		AppName:          t.appName,
+		Code:             msg.Code,
+		SpacedCode:       strings.Join(strings.Split(msg.Code, ""), " "),
+		ExpiresIn:        msg.ExpiresIn,
+		ExpiresInMinutes: max(1, int((msg.ExpiresIn+time.Minute-1)/time.Minute)),
+		Locale:           locale,
+		Link:             msg.Link,
+	}
+
+	t.mu.RLock()
+	set := t.locales[locale]
+	t.mu.RUnlock()
+
+	rendered := make(map[string]string, len(templateFiles))
+	for _, name := range templateFiles {
+		var buf bytes.Buffer
+		if err := set[name].Execute(&buf, data); err != nil {
+			return msg, fmt.Errorf("rendering %s/%s: %w", locale, name, err)
+		}
+		rendered[name] = strings.TrimSpace(buf.String())
+	}
+	msg.Locale = locale
+	msg.Body, msg.VoiceBody = rendered[smsTemplate], rendered[voiceTemplate]
+	msg.Subject, msg.EmailBody = rendered[emailSubjectTemplate], rendered[emailBodyTemplate]
+	if msg.Link != "" {
+		msg.Subject, msg.EmailBody = rendered[magicLinkSubjectTemplate], rendered[magicLinkBodyTemplate]
+	}
+	return msg, nil
+}
+
+// Localize returns a sender that renders messages before passing them to
+// next. A broken template falls back to the plain English text rather than
+// blocking the code.
+func (t *Templates) Localize(next OTPSender) OTPSender {
+	return localizedSender{next: next, templates: t}
+}
+
+type localizedSender struct {
+	next      OTPSender
+	templates *Templates
+}
+
+func (s localizedSender) Send(ctx context.Context, msg Message) error {
+	rendered, err := s.templates.Render(msg)
+	if err != nil {
+		s.templates.logger.Error("failed to render otp message", zap.String("locale", msg.Locale), zap.Error(err))
+		rendered = msg
+	}
+	return s.next.Send(ctx, rendered)
+}
+
+// Reload reloads the templates when a file in the directory changed.
+func (t *Templates) Reload() error {
+	if t.dir == "" {
+		return nil
+	}
+	modTime, err := latestModTime(t.dir)
+	if err != nil {
+		return err
+	}
+	t.mu.RLock()
+	unchanged := modTime.Equal(t.modTime)
+	t.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	return t.load()
+}
+
+// Watch reloads the templates every interval. It runs until the process exits.
+func (t *Templates) Watch(interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := t.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (t *Templates) load() error {
+	sources := map[string]map[string]string{}
+	builtin, _ := fs.Sub(builtinTemplates, "templates")
+	if err := readTemplates(builtin, sources); err != nil {
+		return err
+	}
+
+	var modTime time.Time
+	if t.dir != "" {
+		var err error
+		if modTime, err = latestModTime(t.dir); err != nil {
+			return err
+		}
+		if err := readTemplates(os.DirFS(t.dir), sources); err != nil {
+			return err
+		}
+	}
+
+	defaults, ok := sources[t.defaultLocale]
+	if !ok {
+		return fmt.Errorf("no templates for default locale %q", t.defaultLocale)
+	}
+
+	locales := make(map[string]map[string]*template.Template, len(sources))
+	for locale, files := range sources {
+		set := make(map[string]*template.Template, len(templateFiles))
+		for _, name := range templateFiles {
+			text, ok := files[name]
+			if !ok {
+				text, ok = defaults[name]
+			}
+			if !ok {
+				return fmt.Errorf("default locale %q has no %s", t.defaultLocale, name)
+			}
+			tmpl, err := template.New(locale + "/" + name).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return err
+			}
+			set[name] = tmpl
+		}
+		locales[locale] = set
+	}
+
+	t.mu.Lock()
+	t.locales, t.modTime = locales, modTime
+	t.mu.Unlock()
+	return nil
+}
+
+// readTemplates adds the <locale>/<file>.tmpl files of fsys to sources,
+// replacing files already present.
+func readTemplates(fsys fs.FS, sources map[string]map[string]string) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		locale := strings.ToLower(entry.Name())
+		for _, name := range templateFiles {
+			data, err := fs.ReadFile(fsys, path.Join(entry.Name(), name))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if sources[locale] == nil {
+				sources[locale] = map[string]string{}
+			}
+			sources[locale][name] = string(data)
+		}
+	}
+	return nil
+}
+
+func latestModTime(dir string) (time.Time, error) {
+	var latest time.Time
+	err := fs.WalkDir(os.DirFS(dir), ".", func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest, err
+}
+
+// parseAcceptLanguage returns the language tags of an Accept-Language value,
+// lower-cased and ordered by preference.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag: strings.ReplaceAll(tag, "_", "-"), q: q})
+		}
+	}
+	slices.SortStableFunc(tags, func(a, b weighted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
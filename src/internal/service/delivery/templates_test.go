@@ -0,0 +1,143 @@
+package delivery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplatesMatch(t *testing.T) {
+	templates, err := LoadTemplates("", "en", "goAuth")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		preference string
+		want       string
+	}{
+		{"", "en"},
+		{"fa", "fa"},
+		{"FA-ir", "fa"},
+		{"de-DE,de;q=0.9,ar;q=0.8,en;q=0.7", "ar"},
+		{"en;q=0.5, fa;q=0.9", "fa"},
+		{"fa;q=0, en", "en"},
+		{"de, *", "en"},
+	}
+	for _, tt := range tests {
+		if got := templates.Match(tt.preference); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.preference, got, tt.want)
+		}
+	}
+}
+
+func TestTemplatesRender(t *testing.T) {
+	templates, err := LoadTemplates("", "en", "Acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := templates.Render(Message{Code: "482913", ExpiresIn: 2 * time.Minute, Locale: "fa-IR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Locale != "fa" {
+		t.Fatalf("Locale = %q, want fa", msg.Locale)
+	}
+	for name, text := range map[string]string{"sms": msg.Text(), "email": msg.EmailText()} {
+		if !strings.Contains(text, "482913") || !strings.Contains(text, "Acme") || !strings.Contains(text, "دقیقه") {
+			t.Errorf("%s text %q lacks the code, app name or Persian copy", name, text)
+		}
+	}
+	if !strings.Contains(msg.EmailSubject(), "Acme") {
+		t.Errorf("EmailSubject() = %q", msg.EmailSubject())
+	}
+	if !strings.Contains(msg.VoiceText(), "4 8 2 9 1 3") {
+		t.Errorf("VoiceText() = %q, want the digits spaced out", msg.VoiceText())
+	}
+}
+
+func TestTemplatesRenderMagicLink(t *testing.T) {
+	templates, err := LoadTemplates("", "en", "Acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := "https://auth.example.com/api/v1/auth/magic-link/callback?token=abc"
+	msg, err := templates.Render(Message{Link: link, ExpiresIn: 15 * time.Minute, Channel: ChannelEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg.EmailText(), link) || !strings.Contains(msg.EmailText(), "15 minutes") {
+		t.Errorf("EmailText() = %q, want the link and its lifetime", msg.EmailText())
+	}
+	if msg.EmailSubject() != "Sign in to Acme" {
+		t.Errorf("EmailSubject() = %q", msg.EmailSubject())
+	}
+}
+
+func TestTemplatesDirectory(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("en/sms.tmpl", "Code {{.Code}}")
+	write("de/sms.tmpl", "Ihr Code: {{.Code}}")
+
+	templates, err := LoadTemplates(dir, "en", "goAuth")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, _ := templates.Render(Message{Code: "1", Locale: "en"})
+	if msg.Text() != "Code 1" {
+		t.Errorf("overridden en sms = %q", msg.Text())
+	}
+	msg, _ = templates.Render(Message{Code: "1", Locale: "de"})
+	if msg.Text() != "Ihr Code: 1" {
+		t.Errorf("added de sms = %q", msg.Text())
+	}
+	// de has no email templates, so the default locale's are used.
+	if !strings.Contains(msg.EmailText(), "verification code") {
+		t.Errorf("de email body = %q, want the en fallback", msg.EmailText())
+	}
+
+	write("en/sms.tmpl", "New code {{.Code}}")
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "en/sms.tmpl"), future, future)
+	if err := templates.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ = templates.Render(Message{Code: "1", Locale: "en"})
+	if msg.Text() != "New code 1" {
+		t.Errorf("reloaded en sms = %q", msg.Text())
+	}
+}
+
+func TestLocalizeFallsBackOnBrokenTemplate(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "en"), 0o755)
+	os.WriteFile(filepath.Join(dir, "en", "sms.tmpl"), []byte("{{.Missing}}"), 0o644)
+
+	templates, err := LoadTemplates(dir, "en", "goAuth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &RecordingSender{}
+	if err := templates.Localize(sender).Send(context.Background(), Message{Code: "123456"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := sender.Last(); !strings.Contains(msg.Text(), "123456") {
+		t.Fatalf("fallback text = %q", msg.Text())
+	}
+}
@@ -0,0 +1,304 @@
+package delivery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+	"goAuth/internal/server/api/schema"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// receiptTolerance is how far a receipt's signature timestamp may be from
+	// now. Receipts seen within it are remembered so none applies twice.
+	receiptTolerance = 5 * time.Minute
+
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// Tracker records what happens to OTP messages. Failures to record are
+// logged and never fail the delivery itself.
+type Tracker interface {
+	Queued(msg Message)
+	Sent(msg Message, provider string)
+	Failed(msg Message, reason string)
+}
+
+// Tracking stores the delivery status of every OTP request, applies the
+// receipts providers post back and answers history queries.
+type Tracking struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	// secrets holds each provider's webhook signing secret.
+	secrets map[string][]byte
+	now     func() time.Time
+
+	mu sync.Mutex
+	// seen maps the signature of every receipt applied within
+	// receiptTolerance to when its timestamp leaves the tolerance.
+	seen map[string]time.Time
+}
+
+// receiptTransitions lists, for each status a receipt may report, the
+// statuses it may replace. Delivered and failed are final, so a receipt
+// arriving late cannot move a message backwards.
+var receiptTransitions = map[string][]string{
+	model.MessageSent:      {model.MessageQueued, model.MessageSent},
+	model.MessageDelivered: {model.MessageQueued, model.MessageSent},
+	model.MessageFailed:    {model.MessageQueued, model.MessageSent},
+}
+
+// NewTracking returns a Tracking accepting receipts from the providers in
+// secrets, keyed by provider name.
+func NewTracking(db *gorm.DB, secrets map[string]string) *Tracking {
+	t := &Tracking{
+		db:      db,
+		logger:  zap.L(),
+		secrets: make(map[string][]byte, len(secrets)),
+		now:     time.Now,
+		seen:    make(map[string]time.Time),
+	}
+	for name, secret := range secrets {
+		if secret != "" {
+			t.secrets[name] = []byte(secret)
+		}
+	}
+	return t
+}
+
+func (t *Tracking) Queued(msg Message) {
+	err := t.db.Create(&model.OTPMessage{
+		RequestID: msg.RequestID,
+		Recipient: msg.Recipient,
+		Channel:   msg.DeliveryChannel(),
+		Status:    model.MessageQueued,
+	}).Error
+	if err != nil {
+		t.logger.Error("failed to track queued otp", zap.String("request_id", msg.RequestID), zap.Error(err))
+	}
+}
+
+func (t *Tracking) Sent(msg Message, provider string) {
+	now := t.now().UTC()
+	t.update(msg, map[string]any{
+		"status":   model.MessageSent,
+		"provider": provider,
+		"error":    "",
+		"sent_at":  now,
+	})
+}
+
+func (t *Tracking) Failed(msg Message, reason string) {
+	now := t.now().UTC()
+	t.update(msg, map[string]any{
+		"status":    model.MessageFailed,
+		"error":     reason,
+		"failed_at": now,
+	})
+}
+
+// update applies fields to the message of msg, creating it when it was
+// never queued.
+func (t *Tracking) update(msg Message, fields map[string]any) {
+	result := t.db.Model(&model.OTPMessage{}).Where("request_id = ?", msg.RequestID).Updates(fields)
+	if result.Error == nil && result.RowsAffected == 0 {
+		t.Queued(msg)
+		result = t.db.Model(&model.OTPMessage{}).Where("request_id = ?", msg.RequestID).Updates(fields)
+	}
+	if result.Error != nil {
+		t.logger.Error("failed to track otp", zap.String("request_id", msg.RequestID), zap.Error(result.Error))
+	}
+}
+
+// Track returns a sender that records messages sent through next without a
+// queue: queued before the attempt and failed when it errors.
+func (t *Tracking) Track(next OTPSender) OTPSender {
+	return trackedSender{next: next, tracker: t}
+}
+
+type trackedSender struct {
+	next    OTPSender
+	tracker Tracker
+}
+
+func (s trackedSender) Send(ctx context.Context, msg Message) error {
+	s.tracker.Queued(msg)
+	err := s.next.Send(ctx, msg)
+	if err != nil {
+		s.tracker.Failed(msg, err.Error())
+	}
+	return err
+}
+
+// HandleReceipt verifies and applies a delivery receipt posted by provider.
+// signature is "sha256=" followed by the hex HMAC-SHA256, under the provider's
+// webhook secret, of timestamp, a dot and the raw body; timestamp is in Unix
+// seconds. A receipt is applied at most once.
+func (t *Tracking) HandleReceipt(provider string, body []byte, timestamp, signature string) (err error) {
+	mac, signedAt, err := t.verifySignature(provider, body, timestamp, signature)
+	if err != nil {
+		return err
+	}
+	key := provider + ":" + hex.EncodeToString(mac)
+	if !t.claimReceipt(key, signedAt.Add(receiptTolerance)) {
+		return common.ErrReceiptReplayed
+	}
+	defer func() {
+		// Let the provider retry a receipt that could not be applied.
+		if err != nil && !errors.Is(err, common.ErrInvalidDeliveryReceipt) {
+			t.releaseReceipt(key)
+		}
+	}()
+
+	var receipt schema.DeliveryReceipt
+	if err := json.Unmarshal(body, &receipt); err != nil {
+		return fmt.Errorf("%w: %w", common.ErrInvalidDeliveryReceipt, err)
+	}
+	if receipt.Reference == "" {
+		return fmt.Errorf("%w: missing reference", common.ErrInvalidDeliveryReceipt)
+	}
+
+	now := t.now().UTC()
+	fields := map[string]any{}
+	switch strings.ToLower(receipt.Status) {
+	case "sent", "accepted":
+		fields["status"] = model.MessageSent
+	case "delivered":
+		fields["status"] = model.MessageDelivered
+		fields["delivered_at"] = now
+	case "failed", "undelivered", "rejected":
+		fields["status"] = model.MessageFailed
+		fields["failed_at"] = now
+		fields["error"] = receipt.Error
+	default:
+		return fmt.Errorf("%w: unknown status %q", common.ErrInvalidDeliveryReceipt, receipt.Status)
+	}
+	if receipt.MessageID != "" {
+		fields["provider_message_id"] = receipt.MessageID
+	}
+
+	// Providers may only report on messages they sent, and only move them
+	// forward, even when receipts arrive out of order.
+	result := t.db.Model(&model.OTPMessage{}).
+		Where("request_id = ? AND provider = ? AND status IN ?", receipt.Reference, provider, receiptTransitions[fields["status"].(string)]).
+		Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		t.db.Model(&model.OTPMessage{}).Where("request_id = ? AND provider = ?", receipt.Reference, provider).Count(&count)
+		if count == 0 {
+			return common.ErrMessageNotFound
+		}
+	}
+	return nil
+}
+
+// verifySignature checks a receipt's signature and returns it along with the
+// time it was signed.
+func (t *Tracking) verifySignature(provider string, body []byte, timestamp, signature string) ([]byte, time.Time, error) {
+	secret, ok := t.secrets[provider]
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("%w: no webhook secret for provider %q", common.ErrInvalidWebhookSignature, provider)
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: invalid timestamp", common.ErrInvalidWebhookSignature)
+	}
+	signedAt := time.Unix(unix, 0)
+	if skew := t.now().Sub(signedAt); skew > receiptTolerance || skew < -receiptTolerance {
+		return nil, time.Time{}, fmt.Errorf("%w: timestamp outside tolerance", common.ErrInvalidWebhookSignature)
+	}
+
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: malformed signature", common.ErrInvalidWebhookSignature)
+	}
+	if !hmac.Equal(got, SignReceipt(secret, timestamp, body)) {
+		return nil, time.Time{}, common.ErrInvalidWebhookSignature
+	}
+	return got, signedAt, nil
+}
+
+// claimReceipt records the receipt identified by key until expires and
+// reports whether it was new. Receipts past expires fail verification, so
+// forgetting them then is safe.
+func (t *Tracking) claimReceipt(key string, expires time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for k, until := range t.seen {
+		if now.After(until) {
+			delete(t.seen, k)
+		}
+	}
+	if _, ok := t.seen[key]; ok {
+		return false
+	}
+	t.seen[key] = expires
+	return true
+}
+
+func (t *Tracking) releaseReceipt(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.seen, key)
+}
+
+// SignReceipt returns the HMAC-SHA256 a provider signs a receipt with.
+func SignReceipt(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// History returns the most recent OTP messages sent to recipient, newest
+// first.
+func (t *Tracking) History(recipient string, limit int) ([]schema.DeliveryMessage, error) {
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	var messages []model.OTPMessage
+	err := t.db.Where("recipient = ?", recipient).Order("created_at DESC, id DESC").Limit(limit).Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]schema.DeliveryMessage, 0, len(messages))
+	for _, m := range messages {
+		history = append(history, schema.DeliveryMessage{
+			RequestID:         m.RequestID,
+			Recipient:         m.Recipient,
+			Channel:           m.Channel,
+			Status:            m.Status,
+			Provider:          m.Provider,
+			ProviderMessageID: m.ProviderMessageID,
+			Error:             m.Error,
+			CreatedAt:         m.CreatedAt,
+			SentAt:            m.SentAt,
+			DeliveredAt:       m.DeliveredAt,
+			FailedAt:          m.FailedAt,
+		})
+	}
+	return history, nil
+}
@@ -0,0 +1,176 @@
+package delivery
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+)
+
+const testWebhookSecret = "receipt-secret"
+
+func signedReceipt(t *testing.T, tracking *Tracking, provider, body string) error {
+	t.Helper()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := "sha256=" + hex.EncodeToString(SignReceipt([]byte(testWebhookSecret), timestamp, []byte(body)))
+	return tracking.HandleReceipt(provider, []byte(body), timestamp, signature)
+}
+
+func TestTrackingLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	tracking := NewTracking(db, map[string]string{"sms": testWebhookSecret})
+	r := newTestRouter(t, map[string]OTPSender{"sms": &RecordingSender{}}, RouteConfig{Providers: []string{"sms"}})
+	r.SetTracker(tracking)
+
+	msg := Message{RequestID: "req-1", Recipient: "09123456789", Code: "123456"}
+	tracking.Queued(msg)
+	if err := r.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := tracking.History(msg.Recipient, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Status != model.MessageSent || history[0].Provider != "sms" || history[0].SentAt == nil {
+		t.Fatalf("history after send = %+v", history)
+	}
+
+	if err := signedReceipt(t, tracking, "sms", `{"reference":"req-1","message_id":"m-42","status":"delivered"}`); err != nil {
+		t.Fatalf("HandleReceipt(delivered) error = %v", err)
+	}
+	// A late "sent" receipt must not undo the delivery.
+	if err := signedReceipt(t, tracking, "sms", `{"reference":"req-1","status":"sent"}`); err != nil {
+		t.Fatalf("HandleReceipt(sent) error = %v", err)
+	}
+
+	history, _ = tracking.History(msg.Recipient, 0)
+	if history[0].Status != model.MessageDelivered || history[0].ProviderMessageID != "m-42" || history[0].DeliveredAt == nil {
+		t.Fatalf("history after receipt = %+v", history[0])
+	}
+}
+
+func TestTrackingInlineFailure(t *testing.T) {
+	db := newTestDB(t)
+	tracking := NewTracking(db, nil)
+	sender := tracking.Track(&RecordingSender{Err: fmt.Errorf("%w: bad number", ErrPermanent)})
+
+	msg := Message{RequestID: "req-1", Recipient: "09123456789"}
+	if err := sender.Send(context.Background(), msg); err == nil {
+		t.Fatal("Send() succeeded")
+	}
+	history, _ := tracking.History(msg.Recipient, 0)
+	if len(history) != 1 || history[0].Status != model.MessageFailed || history[0].Error == "" || history[0].FailedAt == nil {
+		t.Fatalf("history = %+v", history)
+	}
+}
+
+func TestTrackingRejectsBadReceipts(t *testing.T) {
+	db := newTestDB(t)
+	tracking := NewTracking(db, map[string]string{"sms": testWebhookSecret, "other": testWebhookSecret})
+	tracking.Sent(Message{RequestID: "req-1", Recipient: "09123456789"}, "sms")
+
+	body := `{"reference":"req-1","status":"delivered"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	sign := func(timestamp string) string {
+		return "sha256=" + hex.EncodeToString(SignReceipt([]byte(testWebhookSecret), timestamp, []byte(body)))
+	}
+
+	tests := []struct {
+		name      string
+		provider  string
+		body      string
+		timestamp string
+		signature string
+		want      error
+	}{
+		{"wrong signature", "sms", body, now, "sha256=" + hex.EncodeToString([]byte("nope")), common.ErrInvalidWebhookSignature},
+		{"tampered body", "sms", `{"reference":"req-1","status":"failed"}`, now, sign(now), common.ErrInvalidWebhookSignature},
+		{"stale timestamp", "sms", body, stale, sign(stale), common.ErrInvalidWebhookSignature},
+		{"unknown provider", "nobody", body, now, sign(now), common.ErrInvalidWebhookSignature},
+		{"other provider's message", "other", body, now, sign(now), common.ErrMessageNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tracking.HandleReceipt(tt.provider, []byte(tt.body), tt.timestamp, tt.signature)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("HandleReceipt() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if err := signedReceipt(t, tracking, "sms", `{"reference":"req-1","status":"exploded"}`); !errors.Is(err, common.ErrInvalidDeliveryReceipt) {
+		t.Fatalf("unknown status: error = %v, want ErrInvalidDeliveryReceipt", err)
+	}
+
+	history, _ := tracking.History("09123456789", 0)
+	if history[0].Status != model.MessageSent {
+		t.Fatalf("status = %s after rejected receipts, want sent", history[0].Status)
+	}
+}
+
+func TestTrackingRejectsReplayedReceipts(t *testing.T) {
+	db := newTestDB(t)
+	tracking := NewTracking(db, map[string]string{"sms": testWebhookSecret})
+	tracking.Sent(Message{RequestID: "req-1", Recipient: "09123456789"}, "sms")
+
+	body := []byte(`{"reference":"req-1","status":"delivered"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := "sha256=" + hex.EncodeToString(SignReceipt([]byte(testWebhookSecret), timestamp, body))
+	if err := tracking.HandleReceipt("sms", body, timestamp, signature); err != nil {
+		t.Fatalf("HandleReceipt() error = %v", err)
+	}
+	if err := tracking.HandleReceipt("sms", body, timestamp, signature); !errors.Is(err, common.ErrReceiptReplayed) {
+		t.Fatalf("HandleReceipt() of the same receipt error = %v, want %v", err, common.ErrReceiptReplayed)
+	}
+
+	// Once the receipt's timestamp is outside the tolerance it is forgotten,
+	// and rejected for its age instead.
+	tracking.now = func() time.Time { return time.Now().Add(receiptTolerance + time.Minute) }
+	if err := tracking.HandleReceipt("sms", body, timestamp, signature); !errors.Is(err, common.ErrInvalidWebhookSignature) {
+		t.Fatalf("HandleReceipt() of an expired receipt error = %v, want %v", err, common.ErrInvalidWebhookSignature)
+	}
+	later := strconv.FormatInt(tracking.now().Unix(), 10)
+	if err := tracking.HandleReceipt("sms", body, later, "sha256="+hex.EncodeToString(SignReceipt([]byte(testWebhookSecret), later, body))); err != nil {
+		t.Fatalf("HandleReceipt() of a newly signed receipt error = %v", err)
+	}
+	if len(tracking.seen) != 1 {
+		t.Fatalf("remembered %d receipts, want only the newest", len(tracking.seen))
+	}
+}
+
+func TestTrackingReceiptsOnlyMoveForward(t *testing.T) {
+	tests := []struct {
+		name     string
+		receipts []string
+		want     string
+	}{
+		{"sent then delivered", []string{"sent", "delivered"}, model.MessageDelivered},
+		{"sent then failed", []string{"sent", "failed"}, model.MessageFailed},
+		{"late sent after failed", []string{"failed", "sent"}, model.MessageFailed},
+		{"late sent after delivered", []string{"delivered", "sent"}, model.MessageDelivered},
+		{"failed after delivered", []string{"delivered", "failed"}, model.MessageDelivered},
+		{"delivered after failed", []string{"failed", "delivered"}, model.MessageFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracking := NewTracking(newTestDB(t), map[string]string{"sms": testWebhookSecret})
+			tracking.Sent(Message{RequestID: "req-1", Recipient: "09123456789"}, "sms")
+			for _, status := range tt.receipts {
+				if err := signedReceipt(t, tracking, "sms", fmt.Sprintf(`{"reference":"req-1","status":%q}`, status)); err != nil {
+					t.Fatalf("HandleReceipt(%s) error = %v", status, err)
+				}
+			}
+			if history, _ := tracking.History("09123456789", 0); history[0].Status != tt.want {
+				t.Fatalf("status = %s, want %s", history[0].Status, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package inmemory
 
 import (
-	"fmt"
 	"sync"
 	"time"
 )
@@ -41,7 +40,6 @@ func (s *InMemoryStore) Set(key string, value any, duration time.Duration) {
 		entry.expireAt = time.Now().Add(duration)
 	}
 	s.data[key] = entry
-	fmt.Printf("Key: %s \nOTP Code: %v\n", key, entry.value)
 }
 
 // Get retrieves the value for a key. Returns (value, true) if found and not expired, else (nil, false).
@@ -61,6 +59,26 @@ func (s *InMemoryStore) Get(key string) (any, bool) {
 	return entry.value, true
 }
 
+// GetOrSet returns the value for key, or stores value with the given
+// duration when the key is missing or expired. loaded reports whether the
+// value was already there. Concurrent callers all get the same value.
+func (s *InMemoryStore) GetOrSet(key string, value any, duration time.Duration) (actual any, loaded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.data[key]; ok && (!entry.hasExpiry || time.Now().Before(entry.expireAt)) {
+		return entry.value, true
+	}
+	entry := inMemoryValue{
+		value:     value,
+		hasExpiry: duration > 0,
+	}
+	if duration > 0 {
+		entry.expireAt = time.Now().Add(duration)
+	}
+	s.data[key] = entry
+	return value, false
+}
+
 // Delete removes a key from the store.
 func (s *InMemoryStore) Delete(key string) {
 	s.mu.Lock()
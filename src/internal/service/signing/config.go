@@ -0,0 +1,48 @@
+package signing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	defaultKeysDir = "./keys"
+
+	// minSecretKeyLength is the shortest SECRET_KEY accepted for HS256, the
+	// size of its SHA-256 output.
+	minSecretKeyLength = 32
+)
+
+var ErrWeakSecretKey = errors.New("SECRET_KEY is too short")
+
+// FromEnv builds the key ring from JWT_ALGORITHM. HS256 (the default) signs
+// with SECRET_KEY, which must be at least 32 bytes; asymmetric algorithms use
+// the ring stored in JWT_KEYS_DIR, generating the first key on first boot.
+func FromEnv() (*KeyRing, error) {
+	alg := Algorithm()
+	if alg == HS256 {
+		secret := os.Getenv("SECRET_KEY")
+		if len(secret) < minSecretKeyLength {
+			return nil, fmt.Errorf("%w: HS256 needs at least %d bytes, got %d", ErrWeakSecretKey, minSecretKeyLength, len(secret))
+		}
+		return NewStaticRing(NewSecretKey([]byte(secret))), nil
+	}
+	return OpenRing(alg, KeysDir())
+}
+
+// Algorithm returns the configured JWT_ALGORITHM, defaulting to HS256.
+func Algorithm() string {
+	if alg := os.Getenv("JWT_ALGORITHM"); alg != "" {
+		return alg
+	}
+	return HS256
+}
+
+// KeysDir returns the configured JWT_KEYS_DIR.
+func KeysDir() string {
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		return dir
+	}
+	return defaultKeysDir
+}
@@ -0,0 +1,30 @@
+package signing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFromEnvSecretKeyLength(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   error
+	}{
+		{"", ErrWeakSecretKey},
+		{"Some secret key", ErrWeakSecretKey},
+		{strings.Repeat("k", minSecretKeyLength-1), ErrWeakSecretKey},
+		{strings.Repeat("k", minSecretKeyLength), nil},
+	}
+	t.Setenv("JWT_ALGORITHM", HS256)
+	for _, tt := range tests {
+		t.Setenv("SECRET_KEY", tt.secret)
+		r, err := FromEnv()
+		if !errors.Is(err, tt.want) {
+			t.Errorf("FromEnv() with a %d byte SECRET_KEY error = %v, want %v", len(tt.secret), err, tt.want)
+		}
+		if err == nil && r.Active() == nil {
+			t.Errorf("FromEnv() with a %d byte SECRET_KEY has no active key", len(tt.secret))
+		}
+	}
+}
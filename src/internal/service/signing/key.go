@@ -0,0 +1,218 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"goAuth/internal/server/api/schema"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// Algorithms lists every supported signing algorithm.
+var Algorithms = []string{HS256, RS256, ES256, EdDSA}
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+// Key is a JWT signing key identified by its kid.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	private crypto.Signer
+	secret  []byte
+}
+
+// NewSecretKey returns an HS256 key for the given shared secret.
+func NewSecretKey(secret []byte) *Key {
+	sum := sha256.Sum256(append([]byte("kid:"), secret...))
+	return &Key{
+		ID:        base64.RawURLEncoding.EncodeToString(sum[:8]),
+		Algorithm: HS256,
+		secret:    secret,
+	}
+}
+
+// NewKey wraps an asymmetric private key. The algorithm is derived from the
+// key type and the kid is the RFC 7638 thumbprint of the public key.
+func NewKey(private crypto.Signer) (*Key, error) {
+	var alg string
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		alg = RS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: ecdsa curve %s", ErrUnsupportedAlgorithm, k.Curve.Params().Name)
+		}
+		alg = ES256
+	case ed25519.PrivateKey:
+		alg = EdDSA
+	default:
+		return nil, fmt.Errorf("%w: key type %T", ErrUnsupportedAlgorithm, private)
+	}
+
+	key := &Key{Algorithm: alg, private: private}
+	kid, err := thumbprint(key.publicJWK())
+	if err != nil {
+		return nil, err
+	}
+	key.ID = kid
+	return key, nil
+}
+
+// Generate creates a new asymmetric key for alg.
+func Generate(alg string) (*Key, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch alg {
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", alg, err)
+	}
+	return NewKey(private)
+}
+
+// Load reads a PKCS#8 PEM private key from path.
+func Load(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s does not contain a PKCS#8 private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: key type %T", ErrUnsupportedAlgorithm, parsed)
+	}
+	return NewKey(private)
+}
+
+// Save writes the private key to path as PKCS#8 PEM with owner-only permissions.
+func (k *Key) Save(path string) error {
+	if k.private == nil {
+		return fmt.Errorf("%s keys cannot be saved", k.Algorithm)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+}
+
+// SigningMethod returns the jwt signing method for the key.
+func (k *Key) SigningMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// SigningKey returns the value passed to jwt.Token.SignedString.
+func (k *Key) SigningKey() any {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.private
+}
+
+// VerificationKey returns the value returned from a jwt.Keyfunc.
+func (k *Key) VerificationKey() any {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.private.Public()
+}
+
+// JWK returns the public key as a JWK. Symmetric keys are never published, so
+// ok is false for HS256 keys.
+func (k *Key) JWK() (jwk schema.JWK, ok bool) {
+	if k.private == nil {
+		return schema.JWK{}, false
+	}
+	jwk = k.publicJWK()
+	jwk.KeyID = k.ID
+	jwk.Use = "sig"
+	jwk.Algorithm = k.Algorithm
+	return jwk, true
+}
+
+func (k *Key) publicJWK() schema.JWK {
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		return schema.JWK{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return schema.JWK{
+			KeyType: "EC",
+			Curve:   pub.Curve.Params().Name,
+			X:       base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:       base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		return schema.JWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(pub),
+		}
+	}
+	return schema.JWK{}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint, which only covers the
+// required members in lexicographic order.
+func thumbprint(jwk schema.JWK) (string, error) {
+	var canonical string
+	switch jwk.KeyType {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk.Curve, jwk.X, jwk.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Curve, jwk.X)
+	default:
+		return "", fmt.Errorf("%w: key type %q", ErrUnsupportedAlgorithm, jwk.KeyType)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,415 @@
+package signing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"goAuth/internal/server/api/schema"
+)
+
+const (
+	manifestFile = "keyring.json"
+	legacyKey    = "signing.pem"
+)
+
+// Key states reported by KeyRing.Keys.
+const (
+	StatusActive  = "active"
+	StatusPending = "pending"
+	StatusRetired = "retired"
+	StatusExpired = "expired"
+)
+
+var (
+	ErrKeyNotFound   = errors.New("signing key not found")
+	ErrKeyActive     = errors.New("signing key is active")
+	ErrNoActiveKey   = errors.New("key ring has no active key")
+	ErrStaticKeyRing = errors.New("key ring is not backed by a directory")
+
+	ErrAlgorithmMismatch = errors.New("signing key does not match the configured algorithm")
+)
+
+// KeyInfo describes a key in the ring.
+type KeyInfo struct {
+	ID          string     `json:"kid"`
+	Algorithm   string     `json:"alg"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+	RetireAt    *time.Time `json:"retire_at,omitempty"`
+}
+
+// Status reports the state of the key at now.
+func (i KeyInfo) Status(activeID string, now time.Time) string {
+	switch {
+	case i.ID == activeID:
+		return StatusActive
+	case i.RetireAt != nil && !now.Before(*i.RetireAt):
+		return StatusExpired
+	case i.RetireAt != nil:
+		return StatusRetired
+	default:
+		return StatusPending
+	}
+}
+
+type manifest struct {
+	Active string    `json:"active"`
+	Keys   []KeyInfo `json:"keys"`
+}
+
+// KeyRing holds the active signing key together with pending keys (published
+// ahead of promotion) and retired keys that still verify tokens until their
+// retirement date. Its state lives in a directory of PEM files described by
+// keyring.json.
+type KeyRing struct {
+	dir string
+	alg string
+
+	mu       sync.RWMutex
+	manifest manifest
+	keys     map[string]*Key
+	modTime  time.Time
+}
+
+// NewStaticRing returns a ring holding a single key that is never rotated.
+func NewStaticRing(key *Key) *KeyRing {
+	now := time.Now()
+	return &KeyRing{
+		alg: key.Algorithm,
+		manifest: manifest{
+			Active: key.ID,
+			Keys:   []KeyInfo{{ID: key.ID, Algorithm: key.Algorithm, CreatedAt: now, ActivatedAt: &now}},
+		},
+		keys: map[string]*Key{key.ID: key},
+	}
+}
+
+// OpenRing loads the key ring stored in dir. On first boot, when dir has no
+// keyring.json, a legacy signing.pem in dir is imported, otherwise a new alg
+// key is generated and made active. Only alg keys are ever made active: a
+// ring whose active key is another algorithm is refused, so a changed
+// JWT_ALGORITHM fails at startup instead of being ignored.
+func OpenRing(alg, dir string) (*KeyRing, error) {
+	r := &KeyRing{dir: dir, alg: alg}
+	switch _, err := os.Stat(filepath.Join(dir, manifestFile)); {
+	case err == nil:
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+		return r, nil
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	key, err := Load(filepath.Join(dir, legacyKey))
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = Generate(alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAlgorithm(key, alg); err != nil {
+		return nil, err
+	}
+
+	r.keys = map[string]*Key{}
+	if err := r.add(key); err != nil {
+		return nil, err
+	}
+	if err := r.Promote(key.ID, 0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func checkAlgorithm(key *Key, alg string) error {
+	if key.Algorithm != alg {
+		return fmt.Errorf("%w: key %s is %s, JWT_ALGORITHM is %s", ErrAlgorithmMismatch, key.ID, key.Algorithm, alg)
+	}
+	return nil
+}
+
+// Active returns the key new tokens are signed with.
+func (r *KeyRing) Active() *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[r.manifest.Active]
+}
+
+// Lookup returns the key for kid if it may still verify tokens.
+func (r *KeyRing) Lookup(kid string) (*Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, info := range r.manifest.Keys {
+		if info.ID == kid && info.Status(r.manifest.Active, time.Now()) != StatusExpired {
+			key, ok := r.keys[kid]
+			return key, ok
+		}
+	}
+	return nil, false
+}
+
+// Keys lists every key in the ring, including expired ones not yet pruned.
+func (r *KeyRing) Keys() (activeID string, keys []KeyInfo) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.manifest.Active, append([]KeyInfo(nil), r.manifest.Keys...)
+}
+
+// JWKS publishes the active, pending and retired keys. Keys past their
+// retirement date are left out.
+func (r *KeyRing) JWKS() schema.JWKS {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	jwks := schema.JWKS{Keys: []schema.JWK{}}
+	now := time.Now()
+	for _, info := range r.manifest.Keys {
+		if info.Status(r.manifest.Active, now) == StatusExpired {
+			continue
+		}
+		if jwk, ok := r.keys[info.ID].JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// Generate adds a new pending key for the ring's algorithm.
+func (r *KeyRing) Generate() (*Key, error) {
+	if r.dir == "" {
+		return nil, ErrStaticKeyRing
+	}
+	key, err := Generate(r.alg)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.add(key); err != nil {
+		return nil, err
+	}
+	return key, r.save()
+}
+
+// Promote makes kid the active signing key. The previously active key is
+// retired after retireAfter so tokens it signed keep verifying until then. A
+// key of another algorithm than the ring's is refused.
+func (r *KeyRing) Promote(kid string, retireAfter time.Duration) error {
+	if r.dir == "" {
+		return ErrStaticKeyRing
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info := r.find(kid)
+	if info == nil {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+	}
+	now := time.Now()
+	if info.Status(r.manifest.Active, now) == StatusExpired {
+		return fmt.Errorf("%w: %s is expired", ErrKeyNotFound, kid)
+	}
+	if err := checkAlgorithm(r.keys[kid], r.alg); err != nil {
+		return err
+	}
+
+	if previous := r.find(r.manifest.Active); previous != nil && previous.ID != kid {
+		retireAt := now.Add(retireAfter)
+		previous.RetireAt = &retireAt
+	}
+	info.ActivatedAt = &now
+	info.RetireAt = nil
+	r.manifest.Active = kid
+	return r.save()
+}
+
+// Retire schedules kid to stop verifying tokens at at. The active key cannot
+// be retired; promote another key first.
+func (r *KeyRing) Retire(kid string, at time.Time) error {
+	if r.dir == "" {
+		return ErrStaticKeyRing
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if kid == r.manifest.Active {
+		return fmt.Errorf("%w: %s", ErrKeyActive, kid)
+	}
+	info := r.find(kid)
+	if info == nil {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+	}
+	info.RetireAt = &at
+	return r.save()
+}
+
+// Prune deletes expired keys and, beyond maxRetired, the oldest retired keys.
+// A negative maxRetired keeps every retired key.
+func (r *KeyRing) Prune(maxRetired int) (removed []string, err error) {
+	if r.dir == "" {
+		return nil, ErrStaticKeyRing
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var retired []KeyInfo
+	kept := make([]KeyInfo, 0, len(r.manifest.Keys))
+	for _, info := range r.manifest.Keys {
+		switch info.Status(r.manifest.Active, now) {
+		case StatusExpired:
+			removed = append(removed, info.ID)
+		case StatusRetired:
+			retired = append(retired, info)
+		default:
+			kept = append(kept, info)
+		}
+	}
+
+	// Keep the retired keys that stay valid the longest.
+	sort.Slice(retired, func(i, j int) bool { return retired[i].RetireAt.After(*retired[j].RetireAt) })
+	for i, info := range retired {
+		if maxRetired >= 0 && i >= maxRetired {
+			removed = append(removed, info.ID)
+			continue
+		}
+		kept = append(kept, info)
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	r.manifest.Keys = kept
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	for _, kid := range removed {
+		delete(r.keys, kid)
+		if err := os.Remove(r.keyPath(kid)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// Reload re-reads the ring from disk when keyring.json changed, so keys
+// rotated with the CLI are picked up without a restart. The current keys are
+// kept when the new active key is of another algorithm.
+func (r *KeyRing) Reload() error {
+	if r.dir == "" {
+		return nil
+	}
+	stat, err := os.Stat(filepath.Join(r.dir, manifestFile))
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	unchanged := stat.ModTime().Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	return r.load()
+}
+
+// Watch reloads the ring every interval. It runs until the process exits.
+func (r *KeyRing) Watch(interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := r.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (r *KeyRing) load() error {
+	path := filepath.Join(r.dir, manifestFile)
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	keys := make(map[string]*Key, len(m.Keys))
+	for _, info := range m.Keys {
+		key, err := Load(r.keyPath(info.ID))
+		if err != nil {
+			return err
+		}
+		if key.ID != info.ID {
+			return fmt.Errorf("key file for %s has kid %s", info.ID, key.ID)
+		}
+		keys[info.ID] = key
+	}
+	active, ok := keys[m.Active]
+	if !ok {
+		return ErrNoActiveKey
+	}
+	if err := checkAlgorithm(active, r.alg); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.manifest, r.keys, r.modTime = m, keys, stat.ModTime()
+	r.mu.Unlock()
+	return nil
+}
+
+// add stores key on disk and in the manifest; callers hold r.mu or own r.
+func (r *KeyRing) add(key *Key) error {
+	if err := key.Save(r.keyPath(key.ID)); err != nil {
+		return err
+	}
+	r.keys[key.ID] = key
+	r.manifest.Keys = append(r.manifest.Keys, KeyInfo{ID: key.ID, Algorithm: key.Algorithm, CreatedAt: time.Now()})
+	return nil
+}
+
+// save writes the manifest atomically; callers hold r.mu.
+func (r *KeyRing) save() error {
+	data, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(r.dir, manifestFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if stat, err := os.Stat(path); err == nil {
+		r.modTime = stat.ModTime()
+	}
+	return nil
+}
+
+func (r *KeyRing) find(kid string) *KeyInfo {
+	for i := range r.manifest.Keys {
+		if r.manifest.Keys[i].ID == kid {
+			return &r.manifest.Keys[i]
+		}
+	}
+	return nil
+}
+
+func (r *KeyRing) keyPath(kid string) string {
+	return filepath.Join(r.dir, kid+".pem")
+}
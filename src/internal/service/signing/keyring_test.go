@@ -0,0 +1,221 @@
+package signing
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func jwksIDs(r *KeyRing) map[string]bool {
+	ids := map[string]bool{}
+	for _, jwk := range r.JWKS().Keys {
+		ids[jwk.KeyID] = true
+	}
+	return ids
+}
+
+func TestOpenRingFirstBoot(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenRing(ES256, dir)
+	if err != nil {
+		t.Fatalf("OpenRing() error = %v", err)
+	}
+	active := r.Active()
+	if active == nil || active.Algorithm != ES256 {
+		t.Fatalf("Active() = %+v, want an ES256 key", active)
+	}
+
+	reopened, err := OpenRing(ES256, dir)
+	if err != nil {
+		t.Fatalf("reopening OpenRing() error = %v", err)
+	}
+	if reopened.Active().ID != active.ID {
+		t.Fatalf("reopened active kid = %s, want %s", reopened.Active().ID, active.ID)
+	}
+}
+
+func TestOpenRingAlgorithmMismatch(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := OpenRing(ES256, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenRing(RS256, dir); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Fatalf("OpenRing() with another algorithm error = %v, want %v", err, ErrAlgorithmMismatch)
+	}
+
+	// A legacy key of the wrong type is not imported.
+	legacyDir := t.TempDir()
+	key, _ := Generate(EdDSA)
+	if err := key.Save(filepath.Join(legacyDir, legacyKey)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenRing(ES256, legacyDir); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Fatalf("OpenRing() importing an EdDSA key as ES256 error = %v, want %v", err, ErrAlgorithmMismatch)
+	}
+	if _, err := os.Stat(filepath.Join(legacyDir, manifestFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("refused import wrote a manifest: %v", err)
+	}
+	r, err := OpenRing(EdDSA, legacyDir)
+	if err != nil {
+		t.Fatalf("OpenRing() importing the legacy key error = %v", err)
+	}
+	if r.Active().ID != key.ID {
+		t.Fatalf("active kid = %s, want the imported %s", r.Active().ID, key.ID)
+	}
+}
+
+func TestOpenRingMissingKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenRing(ES256, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := r.Active()
+	if err := os.Remove(r.keyPath(active.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A ring that lost a key is an error, not a first boot.
+	if _, err := OpenRing(ES256, dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("OpenRing() with a missing key file error = %v, want %v", err, os.ErrNotExist)
+	}
+	activeID, keys := r.Keys()
+	data, _ := os.ReadFile(filepath.Join(dir, manifestFile))
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil || m.Active != activeID || len(m.Keys) != len(keys) {
+		t.Fatalf("manifest after refused OpenRing() = %+v, %v; want it untouched", m, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	r, err := OpenRing(ES256, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := r.Active()
+
+	next, err := r.Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	// A pending key is published before it signs anything.
+	if r.Active().ID != old.ID || !jwksIDs(r)[next.ID] {
+		t.Fatalf("after Generate() active = %s, jwks = %v", r.Active().ID, jwksIDs(r))
+	}
+	if key, ok := r.Lookup(next.ID); !ok || key.ID != next.ID {
+		t.Fatalf("Lookup(pending) = %v, %v", key, ok)
+	}
+
+	if err := r.Promote(next.ID, time.Hour); err != nil {
+		t.Fatalf("Promote() error = %v", err)
+	}
+	if r.Active().ID != next.ID {
+		t.Fatalf("active = %s, want %s", r.Active().ID, next.ID)
+	}
+	// The previous key keeps verifying until it is retired.
+	if _, ok := r.Lookup(old.ID); !ok {
+		t.Fatal("Lookup() of the retired key failed before its retirement date")
+	}
+	if err := r.Retire(next.ID, time.Now()); !errors.Is(err, ErrKeyActive) {
+		t.Fatalf("Retire(active) error = %v, want %v", err, ErrKeyActive)
+	}
+	if err := r.Retire(old.ID, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Retire() error = %v", err)
+	}
+	if _, ok := r.Lookup(old.ID); ok {
+		t.Fatal("Lookup() of an expired key succeeded")
+	}
+	if jwksIDs(r)[old.ID] {
+		t.Fatal("expired key still published")
+	}
+	if _, ok := r.Lookup("unknown-kid"); ok {
+		t.Fatal("Lookup() of an unknown kid succeeded")
+	}
+
+	removed, err := r.Prune(0)
+	if err != nil || len(removed) != 1 || removed[0] != old.ID {
+		t.Fatalf("Prune() = %v, %v; want [%s]", removed, err, old.ID)
+	}
+	if _, err := os.Stat(r.keyPath(old.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("pruned key file still exists: %v", err)
+	}
+}
+
+func TestKeyRingReload(t *testing.T) {
+	dir := t.TempDir()
+	server, err := OpenRing(ES256, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The CLI rotates the ring through its own handle.
+	cli, _ := OpenRing(ES256, dir)
+	next, _ := cli.Generate()
+	if err := cli.Promote(next.ID, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the manifest's modification time moves on coarse filesystems.
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(filepath.Join(dir, manifestFile), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if server.Active().ID != next.ID {
+		t.Fatalf("active after Reload() = %s, want %s", server.Active().ID, next.ID)
+	}
+}
+
+func TestRingRefusesOtherAlgorithms(t *testing.T) {
+	dir := t.TempDir()
+	server, err := OpenRing(ES256, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := server.Active()
+
+	// An EdDSA key slipped into an ES256 ring is never made active.
+	cli, _ := OpenRing(ES256, dir)
+	key, _ := Generate(EdDSA)
+	if err := cli.add(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Promote(key.ID, time.Hour); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Fatalf("Promote() of an EdDSA key error = %v, want %v", err, ErrAlgorithmMismatch)
+	}
+
+	// Nor picked up from a manifest that names it active.
+	cli.manifest.Active = key.ID
+	if err := cli.save(); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(filepath.Join(dir, manifestFile), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Reload(); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Fatalf("Reload() of an EdDSA active key error = %v, want %v", err, ErrAlgorithmMismatch)
+	}
+	if server.Active().ID != active.ID {
+		t.Fatalf("active after refused Reload() = %s, want %s", server.Active().ID, active.ID)
+	}
+}
+
+func TestStaticRing(t *testing.T) {
+	key := NewSecretKey([]byte("secret"))
+	r := NewStaticRing(key)
+	if got, ok := r.Lookup(key.ID); !ok || got != key {
+		t.Fatalf("Lookup() = %v, %v", got, ok)
+	}
+	if len(r.JWKS().Keys) != 0 {
+		t.Fatalf("JWKS() = %+v, want shared secrets left out", r.JWKS())
+	}
+	if _, err := r.Generate(); !errors.Is(err, ErrStaticKeyRing) {
+		t.Fatalf("Generate() error = %v, want %v", err, ErrStaticKeyRing)
+	}
+}
@@ -1,9 +1,16 @@
 package user
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"goAuth/internal/common"
 	"goAuth/internal/database/model"
 	"goAuth/internal/server/api/schema"
 	paginator "goAuth/internal/utils/pagination"
+	"goAuth/internal/utils/phonenumber"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -27,19 +34,19 @@ func (s *service) GetUser(id uint8) *schema.User {
 		s.logger.Error("failed to get user", zap.Error(err))
 		return nil
 	}
-	return &schema.User{
-		ID:          user.ID,
-		PhoneNumber: user.PhoneNumber,
-	}
+	return toSchema(user)
 }
 
-func (s *service) GetUsers(page, pageSize int, baseURL string, phoneNumber *string) *schema.UserList {
+func (s *service) GetUsers(page, pageSize int, baseURL string, phoneNumber, email *string) *schema.UserList {
 	page, pageSize = paginator.ValidatePagination(page, pageSize)
 
 	query := s.db.Model(&model.User{})
 	if phoneNumber != nil {
 		query = query.Where("phone_number LIKE ?", "%"+*phoneNumber+"%")
 	}
+	if email != nil {
+		query = query.Where("email LIKE ?", "%"+strings.ToLower(*email)+"%")
+	}
 
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
@@ -56,13 +63,118 @@ func (s *service) GetUsers(page, pageSize int, baseURL string, phoneNumber *stri
 
 	var schemaUsers []schema.User
 	for _, u := range users {
-		schemaUsers = append(schemaUsers, schema.User{
-			ID:          u.ID,
-			PhoneNumber: u.PhoneNumber,
-		})
+		schemaUsers = append(schemaUsers, *toSchema(u))
 	}
 
 	pagination := paginator.NewPagination(page, pageSize, total, baseURL)
 
 	return paginator.NewPaginatedResponse(schemaUsers, pagination)
 }
+
+// NormalizePhoneNumbers rewrites phone numbers stored before numbers were
+// kept in E.164 form, reading them in the default region. Numbers that do not
+// parse, or whose canonical form belongs to another account, are logged and
+// left as they are. It returns how many numbers were rewritten.
+func (s *service) NormalizePhoneNumbers() (int, error) {
+	if !s.db.Migrator().HasTable(&model.User{}) {
+		return 0, nil
+	}
+	var users []model.User
+	if err := s.db.Where("phone_number IS NOT NULL AND phone_number NOT LIKE '+%'").Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, user := range users {
+		normalized, err := phonenumber.Normalize(*user.PhoneNumber)
+		if err == nil {
+			err = s.db.Model(&user).Update("phone_number", normalized).Error
+		}
+		if err != nil {
+			s.logger.Warn("phone number left unnormalized", zap.Uint8("user_id", user.ID), zap.Error(err))
+			continue
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// BackfillRoles gives the user role to accounts created before roles were
+// stored. It returns how many accounts were updated.
+func (s *service) BackfillRoles() (int, error) {
+	if !s.db.Migrator().HasTable(&model.User{}) {
+		return 0, nil
+	}
+	res := s.db.Model(&model.User{}).
+		Where("roles IS NULL OR roles IN ('', 'null', '[]')").
+		Select("roles").
+		Updates(&model.User{Roles: []string{model.RoleUser}})
+	return int(res.RowsAffected), res.Error
+}
+
+// Roles returns the roles the user with userID holds now. Unknown users hold
+// none.
+func (s *service) Roles(userID uint8) ([]string, error) {
+	var users []model.User
+	if err := s.db.Select("roles").Where("id = ?", userID).Limit(1).Find(&users).Error; err != nil {
+		s.logger.Error("failed to load user roles", zap.Error(err))
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return users[0].Roles, nil
+}
+
+// GrantRole gives role to the user with userID and returns the user's roles.
+func (s *service) GrantRole(userID uint8, role string) ([]string, error) {
+	return s.updateRoles(userID, role, func(roles []string) []string {
+		if slices.Contains(roles, role) {
+			return roles
+		}
+		return append(roles, role)
+	})
+}
+
+// RevokeRole takes role from the user with userID and returns the user's
+// roles. It applies to the user's current access tokens at once, since
+// role checks read the stored roles.
+func (s *service) RevokeRole(userID uint8, role string) ([]string, error) {
+	return s.updateRoles(userID, role, func(roles []string) []string {
+		return slices.DeleteFunc(roles, func(r string) bool { return r == role })
+	})
+}
+
+func (s *service) updateRoles(userID uint8, role string, update func([]string) []string) ([]string, error) {
+	if !slices.Contains(model.Roles, role) {
+		return nil, fmt.Errorf("%w %q, expected one of %s", common.ErrUnknownRole, role, strings.Join(model.Roles, ", "))
+	}
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, common.ErrUserNotFound
+		}
+		return nil, err
+	}
+	roles := update(slices.Clone(user.Roles))
+	if err := s.db.Model(&user).Select("roles").Updates(&model.User{Roles: roles}).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func toSchema(user model.User) *schema.User {
+	u := &schema.User{
+		ID:            user.ID,
+		PhoneVerified: user.PhoneVerified,
+		EmailVerified: user.EmailVerified,
+		HasPassword:   user.PasswordHash != nil,
+	}
+	if user.PhoneNumber != nil {
+		u.PhoneNumber = *user.PhoneNumber
+	}
+	if user.Email != nil {
+		u.Email = *user.Email
+	}
+	return u
+}
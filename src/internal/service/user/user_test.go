@@ -0,0 +1,75 @@
+package user
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"goAuth/internal/common"
+	"goAuth/internal/database/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T) *service {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "users.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.User{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewUserService(db)
+}
+
+func TestBackfillRoles(t *testing.T) {
+	s := newTestService(t)
+	phones := []string{"+989123456781", "+989123456782", "+989123456783"}
+	s.db.Create(&model.User{PhoneNumber: &phones[0]})
+	s.db.Create(&model.User{PhoneNumber: &phones[1], Roles: []string{}})
+	s.db.Create(&model.User{PhoneNumber: &phones[2], Roles: []string{model.RoleAdmin}})
+
+	updated, err := s.BackfillRoles()
+	if err != nil || updated != 2 {
+		t.Fatalf("BackfillRoles() = %d, %v; want 2", updated, err)
+	}
+	for id, want := range map[uint8][]string{1: {model.RoleUser}, 2: {model.RoleUser}, 3: {model.RoleAdmin}} {
+		if roles, _ := s.Roles(id); !slices.Equal(roles, want) {
+			t.Errorf("roles of user %d = %v, want %v", id, roles, want)
+		}
+	}
+	if updated, _ := s.BackfillRoles(); updated != 0 {
+		t.Fatalf("second BackfillRoles() updated %d accounts", updated)
+	}
+}
+
+func TestGrantAndRevokeRole(t *testing.T) {
+	s := newTestService(t)
+	phone := "+989123456781"
+	user := &model.User{PhoneNumber: &phone, Roles: []string{model.RoleUser}}
+	s.db.Create(user)
+
+	if _, err := s.GrantRole(user.ID, "root"); !errors.Is(err, common.ErrUnknownRole) {
+		t.Fatalf("GrantRole() of an unknown role error = %v, want %v", err, common.ErrUnknownRole)
+	}
+	if _, err := s.GrantRole(42, model.RoleAdmin); !errors.Is(err, common.ErrUserNotFound) {
+		t.Fatalf("GrantRole() to an unknown user error = %v, want %v", err, common.ErrUserNotFound)
+	}
+	for range 2 {
+		if roles, err := s.GrantRole(user.ID, model.RoleAdmin); err != nil || !slices.Equal(roles, []string{model.RoleUser, model.RoleAdmin}) {
+			t.Fatalf("GrantRole() = %v, %v", roles, err)
+		}
+	}
+	if roles, _ := s.Roles(user.ID); !slices.Equal(roles, []string{model.RoleUser, model.RoleAdmin}) {
+		t.Fatalf("stored roles = %v", roles)
+	}
+	if roles, err := s.RevokeRole(user.ID, model.RoleAdmin); err != nil || !slices.Equal(roles, []string{model.RoleUser}) {
+		t.Fatalf("RevokeRole() = %v, %v", roles, err)
+	}
+	if roles, _ := s.Roles(42); roles != nil {
+		t.Fatalf("roles of an unknown user = %v, want none", roles)
+	}
+}
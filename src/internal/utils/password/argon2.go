@@ -0,0 +1,107 @@
+// Package password hashes passwords with Argon2id and checks new passwords
+// against a length and breached-password policy.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// ErrMalformedHash is returned for stored hashes this package cannot read.
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// Params are the Argon2id cost parameters. Memory is in KiB.
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follow the second recommended option of RFC 9106 scaled
+// down to 64 MiB, which hashes in well under a second on a server core.
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// ParamsFromEnv returns DefaultParams overridden by PASSWORD_ARGON2_MEMORY
+// (KiB), PASSWORD_ARGON2_ITERATIONS and PASSWORD_ARGON2_PARALLELISM. Invalid
+// values are ignored.
+func ParamsFromEnv() Params {
+	p := DefaultParams
+	if n, err := strconv.ParseUint(os.Getenv("PASSWORD_ARGON2_MEMORY"), 10, 32); err == nil && n >= 8*uint64(p.Parallelism) {
+		p.Memory = uint32(n)
+	}
+	if n, err := strconv.ParseUint(os.Getenv("PASSWORD_ARGON2_ITERATIONS"), 10, 32); err == nil && n > 0 {
+		p.Iterations = uint32(n)
+	}
+	if n, err := strconv.ParseUint(os.Getenv("PASSWORD_ARGON2_PARALLELISM"), 10, 8); err == nil && n > 0 && uint32(n)*8 <= p.Memory {
+		p.Parallelism = uint8(n)
+	}
+	return p
+}
+
+// Hash returns the PHC string of password hashed under p with a random
+// salt, e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>.
+func Hash(password string, p Params) (string, error) {
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches encoded, and whether encoded was
+// hashed under other parameters than p and should be replaced by a new hash.
+func Verify(password, encoded string, p Params) (ok, rehash bool, err error) {
+	stored, salt, key, err := decode(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, stored.Iterations, stored.Memory, stored.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false, nil
+	}
+	rehash = stored.Memory != p.Memory || stored.Iterations != p.Iterations ||
+		stored.Parallelism != p.Parallelism || uint32(len(key)) != p.KeyLength
+	return true, rehash, nil
+}
+
+func decode(encoded string) (p Params, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return Params{}, nil, nil, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Params{}, nil, nil, ErrMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Params{}, nil, nil, ErrMalformedHash
+	}
+	if p.Iterations == 0 || p.Parallelism == 0 {
+		return Params{}, nil, nil, ErrMalformedHash
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return Params{}, nil, nil, ErrMalformedHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return Params{}, nil, nil, ErrMalformedHash
+	}
+	return p, salt, key, nil
+}
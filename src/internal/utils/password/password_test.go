@@ -0,0 +1,153 @@
+package password
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testParams keep the tests fast; the cost does not change the logic.
+var testParams = Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashAndVerify(t *testing.T) {
+	encoded, err := Hash("correct horse battery staple", testParams)
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want a PHC argon2id string", encoded)
+	}
+	if other, _ := Hash("correct horse battery staple", testParams); other == encoded {
+		t.Fatal("two hashes of one password are equal; salt not random")
+	}
+
+	if ok, rehash, err := Verify("correct horse battery staple", encoded, testParams); !ok || rehash || err != nil {
+		t.Fatalf("Verify() = %v, %v, %v; want true, false, nil", ok, rehash, err)
+	}
+	if ok, _, err := Verify("correct horse battery stable", encoded, testParams); ok || err != nil {
+		t.Fatalf("Verify() with a wrong password = %v, %v", ok, err)
+	}
+
+	stronger := testParams
+	stronger.Iterations = 2
+	if ok, rehash, _ := Verify("correct horse battery staple", encoded, stronger); !ok || !rehash {
+		t.Fatalf("Verify() after a parameter change = %v, rehash %v; want true, true", ok, rehash)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"plaintext",
+		"$2a$10$abcdefghijklmnopqrstuv",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!$a2V5",
+	} {
+		if _, _, err := Verify("x", encoded, testParams); !errors.Is(err, ErrMalformedHash) {
+			t.Errorf("Verify(%q) error = %v, want %v", encoded, err, ErrMalformedHash)
+		}
+	}
+}
+
+func TestParamsFromEnv(t *testing.T) {
+	t.Setenv("PASSWORD_ARGON2_MEMORY", "131072")
+	t.Setenv("PASSWORD_ARGON2_ITERATIONS", "0")
+	t.Setenv("PASSWORD_ARGON2_PARALLELISM", "4")
+
+	p := ParamsFromEnv()
+	if p.Memory != 131072 || p.Iterations != DefaultParams.Iterations || p.Parallelism != 4 {
+		t.Fatalf("ParamsFromEnv() = %+v", p)
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	content := "password123\n" +
+		"\n" +
+		// SHA-1 of "letmein12345", as in the Have I Been Pwned downloads.
+		"3533DC31B5B114D597E3AA2D198BC0965D17905F:12\n"
+	if err := os.WriteFile(list, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PASSWORD_MIN_LENGTH", "10")
+	t.Setenv("PASSWORD_BREACHED_FILE", list)
+	p, err := PolicyFromEnv()
+	if err != nil {
+		t.Fatalf("PolicyFromEnv() error = %v", err)
+	}
+	if p.Breached() != 2 {
+		t.Fatalf("Breached() = %d, want 2", p.Breached())
+	}
+
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{"short", ErrTooShort},
+		{"رمز-عبور-ب", nil}, // 10 characters, 19 bytes
+		{strings.Repeat("a", DefaultMaxLength+1), ErrTooLong},
+		{"password123", ErrBreached},
+		{"letmein12345", ErrBreached},
+		{"User@Example.com", ErrIsIdentifier},
+		{"plum-kettle-orbit", nil},
+	}
+	for _, tt := range tests {
+		if err := p.Check(tt.password, "+989123456789", "user@example.com"); !errors.Is(err, tt.want) {
+			t.Errorf("Check(%q) error = %v, want %v", tt.password, err, tt.want)
+		}
+	}
+}
+
+func TestPolicySortedHashFile(t *testing.T) {
+	var hashes []string
+	for i := range 2000 {
+		hashes = append(hashes, fmt.Sprintf("%X:%d", sha1.Sum([]byte(fmt.Sprintf("breached-%d", i))), i))
+	}
+	sort.Strings(hashes)
+	list := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(list, []byte(strings.Join(hashes, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := DefaultPolicy()
+	if err := p.LoadBreached(list); err != nil {
+		t.Fatalf("LoadBreached() error = %v", err)
+	}
+	if p.Breached() != 0 {
+		t.Fatalf("Breached() = %d, want the sorted file left on disk", p.Breached())
+	}
+	for i := range 2000 {
+		if err := p.Check(fmt.Sprintf("breached-%d", i)); !errors.Is(err, ErrBreached) {
+			t.Fatalf("Check(breached-%d) error = %v, want %v", i, err, ErrBreached)
+		}
+		if err := p.Check(fmt.Sprintf("not-breached-%d", i)); err != nil {
+			t.Fatalf("Check(not-breached-%d) error = %v, want nil", i, err)
+		}
+	}
+}
+
+func TestLoadBreachedTooLargeForMemory(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(list, []byte("password123\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(list, maxBreachedInMemory+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefaultPolicy().LoadBreached(list); err == nil || !strings.Contains(err.Error(), "sorted") {
+		t.Fatalf("LoadBreached() of a large unsorted file error = %v, want one asking for sorted hashes", err)
+	}
+}
+
+func TestPolicyFromEnvMissingFile(t *testing.T) {
+	t.Setenv("PASSWORD_BREACHED_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+	if _, err := PolicyFromEnv(); err == nil {
+		t.Fatal("PolicyFromEnv() with a missing breached file succeeded")
+	}
+}
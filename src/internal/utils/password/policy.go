@@ -0,0 +1,273 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrTooShort     = errors.New("password too short")
+	ErrTooLong      = errors.New("password too long")
+	ErrBreached     = errors.New("password appears in a breach")
+	ErrIsIdentifier = errors.New("password equals the account's phone number or email")
+	// ErrBreachedUnreadable is returned by Check when a breached-password
+	// file searched on disk cannot be read.
+	ErrBreachedUnreadable = errors.New("breached password list unreadable")
+)
+
+const (
+	DefaultMinLength = 10
+	// DefaultMaxLength bounds the work a login with a huge password causes.
+	DefaultMaxLength = 128
+
+	// maxBreachedInMemory is the largest breached-password file loaded into
+	// memory. Sorted hash files of any size are searched on disk instead.
+	maxBreachedInMemory = 64 << 20
+	// sortedCheckLines is how many lines of a hash file are checked for
+	// order when it is loaded.
+	sortedCheckLines = 1000
+	// maxHashLine bounds the lines of a sorted hash file: a hex digest, and
+	// a count after a colon.
+	maxHashLine = 128
+)
+
+// Policy decides which new passwords are accepted. Lengths count characters,
+// not bytes.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// breached holds SHA-1 digests of known breached passwords.
+	breached map[[sha1.Size]byte]struct{}
+	// breachedFiles are sorted hash files searched on disk.
+	breachedFiles []*hashFile
+}
+
+// DefaultPolicy returns a policy with the default lengths and no breached
+// password list.
+func DefaultPolicy() *Policy {
+	return &Policy{MinLength: DefaultMinLength, MaxLength: DefaultMaxLength}
+}
+
+// PolicyFromEnv returns the policy configured by PASSWORD_MIN_LENGTH,
+// PASSWORD_MAX_LENGTH and PASSWORD_BREACHED_FILE. Invalid lengths are
+// ignored; a breached-password file that cannot be read is an error.
+func PolicyFromEnv() (*Policy, error) {
+	p := DefaultPolicy()
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		p.MinLength = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_LENGTH")); err == nil && n >= p.MinLength {
+		p.MaxLength = n
+	}
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		if err := p.LoadBreached(path); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// LoadBreached adds the passwords listed in the file at path to the breached
+// list. Each line holds a password, or the hex SHA-1 of one as in the Have I
+// Been Pwned downloads ("HASH" or "HASH:count"). Blank lines are skipped.
+// Files of hashes sorted by hash, like the Have I Been Pwned download ordered
+// by hash, are binary-searched on disk and may be of any size; other files
+// are loaded into memory and must not exceed maxBreachedInMemory.
+func (p *Policy) LoadBreached(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open breached password file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to read breached password file: %w", err)
+	}
+	hashes := &hashFile{f: f, size: info.Size()}
+	if hashes.sorted() {
+		p.breachedFiles = append(p.breachedFiles, hashes)
+		return nil
+	}
+	defer f.Close()
+	if info.Size() > maxBreachedInMemory {
+		return fmt.Errorf("breached password file is %d MiB: files over %d MiB must hold SHA-1 hashes sorted by hash, one per line",
+			info.Size()>>20, maxBreachedInMemory>>20)
+	}
+
+	if p.breached == nil {
+		p.breached = make(map[[sha1.Size]byte]struct{})
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		p.breached[breachedDigest(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read breached password file: %w", err)
+	}
+	return nil
+}
+
+// Breached returns the number of passwords on the breached list loaded into
+// memory. Files searched on disk are not counted.
+func (p *Policy) Breached() int {
+	return len(p.breached)
+}
+
+// Check returns why password is not acceptable, or nil. identifiers are the
+// account's phone number and email, which make poor passwords.
+func (p *Policy) Check(password string, identifiers ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters", ErrTooShort, p.MinLength)
+	}
+	if length > p.MaxLength {
+		return fmt.Errorf("%w: at most %d characters", ErrTooLong, p.MaxLength)
+	}
+	for _, id := range identifiers {
+		if id != "" && strings.EqualFold(password, id) {
+			return ErrIsIdentifier
+		}
+	}
+	digest := sha1.Sum([]byte(password))
+	if _, ok := p.breached[digest]; ok {
+		return ErrBreached
+	}
+	for _, hashes := range p.breachedFiles {
+		found, err := hashes.contains(digest)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrBreachedUnreadable, err)
+		}
+		if found {
+			return ErrBreached
+		}
+	}
+	return nil
+}
+
+// breachedDigest returns the SHA-1 digest a line of the breached list stands
+// for: the hex digest it holds, or the digest of the line as a password.
+func breachedDigest(line string) [sha1.Size]byte {
+	hash, _, _ := strings.Cut(line, ":")
+	var digest [sha1.Size]byte
+	if len(hash) == 2*sha1.Size {
+		if _, err := hex.Decode(digest[:], []byte(hash)); err == nil {
+			return digest
+		}
+	}
+	return sha1.Sum([]byte(line))
+}
+
+// hashFile is a breached-password file of hex SHA-1 digests sorted by
+// digest, one per line and each optionally followed by ":count". It is
+// binary-searched on disk.
+type hashFile struct {
+	f    *os.File
+	size int64
+}
+
+// sorted reports whether the first lines of h are digests in order.
+func (h *hashFile) sorted() bool {
+	scanner := bufio.NewScanner(io.NewSectionReader(h.f, 0, h.size))
+	var previous [sha1.Size]byte
+	lines := 0
+	for ; lines < sortedCheckLines && scanner.Scan(); lines++ {
+		digest, ok := parseDigest(scanner.Bytes())
+		if !ok || bytes.Compare(digest[:], previous[:]) < 0 {
+			return false
+		}
+		previous = digest
+	}
+	return lines > 0 && scanner.Err() == nil
+}
+
+// contains binary-searches h for digest. lo is always the start of a line.
+func (h *hashFile) contains(digest [sha1.Size]byte) (bool, error) {
+	lo, hi := int64(0), h.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := h.lineStart(mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+		line, err := h.line(start)
+		if err != nil {
+			return false, err
+		}
+		lineDigest, ok := parseDigest(line)
+		if !ok {
+			return false, fmt.Errorf("malformed line at offset %d", start)
+		}
+		switch bytes.Compare(lineDigest[:], digest[:]) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineStart returns the offset of the first line starting at or after off,
+// or the file size when there is none.
+func (h *hashFile) lineStart(off int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+	buf := make([]byte, maxHashLine)
+	n, err := h.f.ReadAt(buf, off-1)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+		return off + int64(i), nil
+	}
+	if n < len(buf) {
+		return h.size, nil
+	}
+	return 0, fmt.Errorf("line longer than %d bytes near offset %d", maxHashLine, off)
+}
+
+// line returns the line starting at start, without its newline.
+func (h *hashFile) line(start int64) ([]byte, error) {
+	buf := make([]byte, maxHashLine)
+	n, err := h.f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+		return buf[:i], nil
+	}
+	if n < len(buf) {
+		return buf[:n], nil
+	}
+	return nil, fmt.Errorf("line longer than %d bytes at offset %d", maxHashLine, start)
+}
+
+// parseDigest reads the digest of a line of a sorted hash file.
+func parseDigest(line []byte) (digest [sha1.Size]byte, ok bool) {
+	hash, _, _ := bytes.Cut(bytes.TrimRight(line, "\r"), []byte(":"))
+	if len(hash) != 2*sha1.Size {
+		return digest, false
+	}
+	_, err := hex.Decode(digest[:], hash)
+	return digest, err == nil
+}
@@ -0,0 +1,139 @@
+// Package phonenumber parses phone numbers written in international or
+// national format into E.164 and tells mobile numbers from fixed lines,
+// using the libphonenumber metadata.
+package phonenumber
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// ErrInvalid is returned for input that is not a phone number.
+var ErrInvalid = errors.New("invalid phone number")
+
+// DefaultRegionCode is the region of national numbers when
+// PHONE_DEFAULT_REGION is unset.
+const DefaultRegionCode = "IR"
+
+// LineType is the kind of line a number belongs to.
+type LineType string
+
+const (
+	Mobile    LineType = "mobile"
+	FixedLine LineType = "fixed-line"
+	// Unknown is used where the numbering plan does not tell the two apart,
+	// as in the North American plan, and for other services such as VoIP.
+	Unknown LineType = "unknown"
+)
+
+// Number is a parsed phone number.
+type Number struct {
+	// E164 is the canonical form: "+", the calling code and the national
+	// significant number.
+	E164        string
+	CallingCode string
+	// Region is the ISO 3166 code of the number's country, found from its
+	// area code where countries share a calling code. It is empty for
+	// non-geographic numbers.
+	Region   string
+	National string
+	Type     LineType
+}
+
+func (n Number) String() string {
+	return n.E164
+}
+
+// DefaultRegion returns PHONE_DEFAULT_REGION, the region national numbers
+// are read in, or DefaultRegionCode.
+func DefaultRegion() string {
+	if code := strings.ToUpper(strings.TrimSpace(os.Getenv("PHONE_DEFAULT_REGION"))); phonenumbers.GetSupportedRegions()[code] {
+		return code
+	}
+	return DefaultRegionCode
+}
+
+// Normalize returns raw in E.164 form, reading national numbers in the
+// default region.
+func Normalize(raw string) (string, error) {
+	n, err := Parse(raw, DefaultRegion())
+	if err != nil {
+		return "", err
+	}
+	return n.E164, nil
+}
+
+// Parse reads raw, which may contain spaces, dashes, dots and parentheses
+// as well as Persian or Arabic digits. Numbers starting with "+" or "00" are
+// international; the rest are national numbers of defaultRegion, with or
+// without their trunk prefix, or its numbers with the calling code but
+// without "+".
+func Parse(raw, defaultRegion string) (Number, error) {
+	digits, international, err := cleanDigits(raw)
+	if err != nil {
+		return Number{}, err
+	}
+	if !international && strings.HasPrefix(digits, "00") {
+		international, digits = true, digits[2:]
+	}
+	region := strings.ToUpper(defaultRegion)
+	if international {
+		digits = "+" + digits
+	} else if !phonenumbers.GetSupportedRegions()[region] {
+		return Number{}, fmt.Errorf("%w: unknown region %q", ErrInvalid, defaultRegion)
+	}
+
+	parsed, err := phonenumbers.Parse(digits, region)
+	if err != nil {
+		return Number{}, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if !phonenumbers.IsValidNumber(parsed) {
+		return Number{}, fmt.Errorf("%w: not a number in the numbering plan of +%d", ErrInvalid, parsed.GetCountryCode())
+	}
+	n := Number{
+		E164:        phonenumbers.Format(parsed, phonenumbers.E164),
+		CallingCode: strconv.Itoa(int(parsed.GetCountryCode())),
+		National:    phonenumbers.GetNationalSignificantNumber(parsed),
+		Type:        Unknown,
+	}
+	if code := phonenumbers.GetRegionCodeForNumber(parsed); phonenumbers.GetSupportedRegions()[code] {
+		n.Region = code
+	}
+	switch phonenumbers.GetNumberType(parsed) {
+	case phonenumbers.MOBILE:
+		n.Type = Mobile
+	case phonenumbers.FIXED_LINE:
+		n.Type = FixedLine
+	}
+	return n, nil
+}
+
+// cleanDigits strips formatting from raw and reports whether it started
+// with "+".
+func cleanDigits(raw string) (digits string, plus bool, err error) {
+	var b strings.Builder
+	for _, c := range strings.TrimSpace(raw) {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c >= '۰' && c <= '۹': // Persian
+			b.WriteRune('0' + c - '۰')
+		case c >= '٠' && c <= '٩': // Arabic-Indic
+			b.WriteRune('0' + c - '٠')
+		case c == '+' && b.Len() == 0 && !plus:
+			plus = true
+		case strings.ContainsRune(" -.()/ ", c):
+		default:
+			return "", false, fmt.Errorf("%w: unexpected %q", ErrInvalid, c)
+		}
+	}
+	if b.Len() == 0 {
+		return "", false, fmt.Errorf("%w: no digits", ErrInvalid)
+	}
+	return b.String(), plus, nil
+}
@@ -0,0 +1,63 @@
+package phonenumber
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw    string
+		region string
+		e164   string
+		code   string
+		kind   LineType
+	}{
+		{"09123456789", "IR", "+989123456789", "IR", Mobile},
+		{"9123456789", "IR", "+989123456789", "IR", Mobile},
+		{"989123456789", "IR", "+989123456789", "IR", Mobile},
+		{"+98 912 345 6789", "US", "+989123456789", "IR", Mobile},
+		{"0098-912-345-6789", "IR", "+989123456789", "IR", Mobile},
+		{"+98 (0)912 345 6789", "IR", "+989123456789", "IR", Mobile},
+		{"۰۹۱۲۳۴۵۶۷۸۹", "IR", "+989123456789", "IR", Mobile},
+		{"021 8888 7777", "IR", "+982188887777", "IR", FixedLine},
+		{"(201) 555-0123", "US", "+12015550123", "US", Unknown},
+		{"1 201 555 0123", "US", "+12015550123", "US", Unknown},
+		{"(506) 234-5678", "US", "+15062345678", "CA", Unknown},
+		{"+1 416 555 0123", "IR", "+14165550123", "CA", Unknown},
+		{"07400 123456", "GB", "+447400123456", "GB", Mobile},
+		{"+44 20 7946 0958", "IR", "+442079460958", "GB", FixedLine},
+		{"+7 912 345 6789", "IR", "+79123456789", "RU", Mobile},
+		{"+7 701 234 5678", "IR", "+77012345678", "KZ", Mobile},
+		{"+254 712 345678", "IR", "+254712345678", "KE", Mobile},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.raw, tt.region)
+		if err != nil {
+			t.Errorf("Parse(%q, %s) error = %v", tt.raw, tt.region, err)
+			continue
+		}
+		if n.E164 != tt.e164 || n.Region != tt.code || n.Type != tt.kind {
+			t.Errorf("Parse(%q, %s) = %s %q %s, want %s %q %s", tt.raw, tt.region, n.E164, n.Region, n.Type, tt.e164, tt.code, tt.kind)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, raw := range []string{"", "invalid", "0912345678", "091234567890", "+98 912 345", "+0123456789", "+1234567890123456", "0912-abc-6789"} {
+		if n, err := Parse(raw, "IR"); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %s, %v; want %v", raw, n.E164, err, ErrInvalid)
+		}
+	}
+}
+
+func TestDefaultRegion(t *testing.T) {
+	t.Setenv("PHONE_DEFAULT_REGION", "gb")
+	if got, _ := Normalize("07400 123456"); got != "+447400123456" {
+		t.Errorf("Normalize() in GB = %q", got)
+	}
+	t.Setenv("PHONE_DEFAULT_REGION", "XX")
+	if DefaultRegion() != DefaultRegionCode {
+		t.Errorf("DefaultRegion() with an unknown region = %q, want %q", DefaultRegion(), DefaultRegionCode)
+	}
+}
@@ -0,0 +1,45 @@
+package verifier
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClaimsKey is the fiber.Ctx.Locals key holding the verified *Claims.
+const ClaimsKey = "goauth_claims"
+
+// Fiber returns a Fiber middleware that rejects requests without a valid
+// bearer token with 401 and stores the claims under ClaimsKey.
+func (v *Verifier) Fiber() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, ok := BearerToken(c.Get(fiber.HeaderAuthorization))
+		if !ok {
+			return fiberError(c, ErrMissingToken)
+		}
+		claims, err := v.Verify(c.UserContext(), token)
+		if err != nil {
+			return fiberError(c, err)
+		}
+		c.Locals(ClaimsKey, claims)
+		c.SetUserContext(NewContext(c.UserContext(), claims))
+		return c.Next()
+	}
+}
+
+// FiberClaims returns the claims stored by the Fiber middleware.
+func FiberClaims(c *fiber.Ctx) (*Claims, bool) {
+	claims, ok := c.Locals(ClaimsKey).(*Claims)
+	return claims, ok && claims != nil
+}
+
+func fiberError(c *fiber.Ctx, err error) error {
+	message := errorMessage(err)
+	c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, message))
+	return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+		"statusCode": http.StatusUnauthorized,
+		"status":     "error",
+		"message":    message,
+	})
+}
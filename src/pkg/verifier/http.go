@@ -0,0 +1,78 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the claims stored by the net/http middleware or the
+// gRPC interceptors.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// Middleware rejects requests without a valid bearer token with 401 and
+// stores the claims in the request context for next.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := BearerToken(r.Header.Get("Authorization"))
+		if !ok {
+			writeHTTPError(w, ErrMissingToken)
+			return
+		}
+		claims, err := v.Verify(r.Context(), token)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>"
+// header value.
+func BearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	token = strings.TrimSpace(token)
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// errorMessage maps verification errors to the message returned to clients.
+func errorMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		return "missing bearer access token"
+	case errors.Is(err, ErrExpiredToken):
+		return "access token expired"
+	default:
+		return "invalid access token"
+	}
+}
+
+// writeHTTPError answers 401 using goAuth's error envelope.
+func writeHTTPError(w http.ResponseWriter, err error) {
+	message := errorMessage(err)
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, message))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]any{
+		"statusCode": http.StatusUnauthorized,
+		"status":     "error",
+		"message":    message,
+	})
+}
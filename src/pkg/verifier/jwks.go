@@ -0,0 +1,205 @@
+package verifier
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+}
+
+type verificationKey struct {
+	algorithm string
+	public    crypto.PublicKey
+}
+
+// keyCache caches the JWKS and refetches it when it gets stale or a token
+// references an unknown kid. Fetches, failed or not, are at least
+// MinRefreshInterval apart; while the endpoint is down the cached keys keep
+// verifying tokens.
+type keyCache struct {
+	config Config
+
+	mu          sync.RWMutex
+	keys        map[string]verificationKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	lastErr     error
+
+	// fetching serializes refreshes so concurrent misses trigger one request.
+	fetching sync.Mutex
+}
+
+func newKeyCache(config Config) *keyCache {
+	return &keyCache{config: config}
+}
+
+func (c *keyCache) get(ctx context.Context, kid string) (verificationKey, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	stale := time.Since(c.fetchedAt) > c.config.RefreshInterval
+	lastAttempt := c.lastAttempt
+	c.mu.RUnlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+	if time.Since(lastAttempt) > c.config.MinRefreshInterval {
+		if err := c.refresh(ctx, lastAttempt); err != nil && !ok {
+			return verificationKey{}, fmt.Errorf("%w: %w", ErrUnknownKey, err)
+		}
+		c.mu.RLock()
+		key, ok = c.keys[kid]
+		c.mu.RUnlock()
+	}
+	if !ok {
+		return verificationKey{}, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// attempted returns when the key set was last fetched, successfully or not.
+func (c *keyCache) attempted() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastAttempt
+}
+
+// refresh fetches the key set. If another fetch finished since lastAttempt,
+// the attempt the caller saw, its result is shared instead.
+func (c *keyCache) refresh(ctx context.Context, lastAttempt time.Time) error {
+	c.fetching.Lock()
+	defer c.fetching.Unlock()
+
+	c.mu.RLock()
+	fetched, err := !c.lastAttempt.Equal(lastAttempt), c.lastErr
+	c.mu.RUnlock()
+	if fetched {
+		return err
+	}
+
+	keys, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastAttempt, c.lastErr = time.Now(), err
+	if err != nil {
+		return err
+	}
+	c.keys, c.fetchedAt = keys, c.lastAttempt
+	return nil
+}
+
+func (c *keyCache) fetch(ctx context.Context) (map[string]verificationKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks: unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding jwks: %w", err)
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		public, err := k.publicKey()
+		if err != nil {
+			// Skip keys we cannot use rather than rejecting the whole set.
+			continue
+		}
+		keys[k.KeyID] = verificationKey{algorithm: k.Algorithm, public: public}
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !public.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on the curve")
+		}
+		return public, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,175 @@
+// Package verifier validates goAuth access tokens in downstream services.
+//
+// A Verifier fetches the JSON Web Key Set published by a goAuth instance at
+// /.well-known/jwks.json, caches it and verifies tokens offline: signature,
+// expiry, not-before, issuer and audience. Revocation cannot be checked
+// offline; services that need it should call the goAuth introspection
+// endpoint instead.
+//
+//	v, err := verifier.New(verifier.Config{
+//		JWKSURL:  "https://auth.example.com/.well-known/jwks.json",
+//		Issuer:   "goAuth",
+//		Audience: "orders",
+//	})
+//	mux.Handle("/orders", v.Middleware(ordersHandler))
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrMissingToken = errors.New("verifier: missing bearer token")
+	ErrInvalidToken = errors.New("verifier: invalid token")
+	ErrExpiredToken = errors.New("verifier: token expired")
+	ErrUnknownKey   = errors.New("verifier: unknown signing key")
+)
+
+// Claims are the claims carried by goAuth access tokens.
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles         []string `json:"roles,omitempty"`
+	Tenant        string   `json:"tenant,omitempty"`
+	PhoneVerified *bool    `json:"phone_verified,omitempty"`
+	EmailVerified *bool    `json:"email_verified,omitempty"`
+
+	// AuthTime, AMR and ACR tell when and how the user last authenticated.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	ACR      string           `json:"acr,omitempty"`
+}
+
+// UserID returns the goAuth user ID held in the sub claim.
+func (c *Claims) UserID() (uint64, error) {
+	return strconv.ParseUint(c.Subject, 10, 64)
+}
+
+// HasRole reports whether the token grants role.
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// AuthenticatedWithin reports whether the user authenticated no longer than
+// maxAge ago, for operations that need a recent login.
+func (c *Claims) AuthenticatedWithin(maxAge time.Duration) bool {
+	return c.AuthTime != nil && time.Since(c.AuthTime.Time) <= maxAge
+}
+
+// Config configures a Verifier.
+type Config struct {
+	// JWKSURL is the goAuth JWKS endpoint, e.g.
+	// https://auth.example.com/.well-known/jwks.json.
+	JWKSURL string
+
+	// Issuer is the expected iss claim (goAuth's JWT_ISSUER).
+	Issuer string
+
+	// Audience is the audience this service accepts. Empty disables the check.
+	Audience string
+
+	// Algorithms restricts accepted signing algorithms. Defaults to RS256,
+	// ES256 and EdDSA.
+	Algorithms []string
+
+	// RefreshInterval is how long a fetched key set is cached. Defaults to 5
+	// minutes.
+	RefreshInterval time.Duration
+
+	// MinRefreshInterval limits refetches triggered by tokens with an unknown
+	// kid. Defaults to 30 seconds.
+	MinRefreshInterval time.Duration
+
+	// Leeway tolerates clock skew on exp and nbf.
+	Leeway time.Duration
+
+	// HTTPClient fetches the key set. Defaults to a client with a 10 second
+	// timeout.
+	HTTPClient *http.Client
+}
+
+// Verifier validates goAuth access tokens against a cached JWKS. It is safe
+// for concurrent use.
+type Verifier struct {
+	config Config
+	keys   *keyCache
+	parser *jwt.Parser
+}
+
+// New returns a Verifier for config. Keys are fetched lazily on first use;
+// call Refresh to fail fast at startup.
+func New(config Config) (*Verifier, error) {
+	if config.JWKSURL == "" {
+		return nil, errors.New("verifier: JWKSURL is required")
+	}
+	if config.Issuer == "" {
+		return nil, errors.New("verifier: Issuer is required")
+	}
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []string{"RS256", "ES256", "EdDSA"}
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 5 * time.Minute
+	}
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = 30 * time.Second
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(config.Algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithLeeway(config.Leeway),
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+
+	return &Verifier{
+		config: config,
+		keys:   newKeyCache(config),
+		parser: jwt.NewParser(options...),
+	}, nil
+}
+
+// Refresh fetches the key set now.
+func (v *Verifier) Refresh(ctx context.Context) error {
+	return v.keys.refresh(ctx, v.keys.attempted())
+}
+
+// Verify validates token and returns its claims. Errors wrap ErrInvalidToken,
+// ErrExpiredToken or ErrUnknownKey.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.keys.get(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.algorithm != "" && key.algorithm != t.Method.Alg() {
+			return nil, fmt.Errorf("key %q does not sign with %s", kid, t.Method.Alg())
+		}
+		return key.public, nil
+	})
+	switch {
+	case err == nil:
+		return claims, nil
+	case errors.Is(err, ErrUnknownKey):
+		return nil, err
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, fmt.Errorf("%w: %w", ErrExpiredToken, err)
+	default:
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+}
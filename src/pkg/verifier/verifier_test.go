@@ -0,0 +1,255 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "goAuth"
+
+// jwksServer publishes a changeable key set and counts fetches.
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+	failing atomic.Bool
+
+	mu   sync.Mutex
+	keys []map[string]string
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		if s.failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) publish(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func newECKey(t *testing.T, kid string) (*ecdsa.PrivateKey, map[string]string) {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private, map[string]string{
+		"kty": "EC", "kid": kid, "use": "sig", "alg": "ES256", "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(private.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(private.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validClaims() jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Issuer:    testIssuer,
+		Subject:   "7",
+		Audience:  jwt.ClaimStrings{"orders"},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+}
+
+func newTestVerifier(t *testing.T, server *jwksServer) *Verifier {
+	t.Helper()
+	v, err := New(Config{JWKSURL: server.URL, Issuer: testIssuer, Audience: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	server := newJWKSServer(t)
+	private, jwk := newECKey(t, "k1")
+	server.publish(jwk)
+	v := newTestVerifier(t, server)
+
+	claims, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodES256, private, "k1", validClaims()))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if id, _ := claims.UserID(); id != 7 {
+		t.Fatalf("UserID() = %d, want 7", id)
+	}
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	otherAudience := validClaims()
+	otherAudience.Audience = jwt.ClaimStrings{"billing"}
+	otherIssuer := validClaims()
+	otherIssuer.Issuer = "someone-else"
+	noExpiry := validClaims()
+	noExpiry.ExpiresAt = nil
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", sign(t, jwt.SigningMethodES256, private, "k1", expired), ErrExpiredToken},
+		{"other audience", sign(t, jwt.SigningMethodES256, private, "k1", otherAudience), ErrInvalidToken},
+		{"other issuer", sign(t, jwt.SigningMethodES256, private, "k1", otherIssuer), ErrInvalidToken},
+		{"without exp", sign(t, jwt.SigningMethodES256, private, "k1", noExpiry), ErrInvalidToken},
+		{"wrong algorithm for the kid", sign(t, jwt.SigningMethodEdDSA, edKey, "k1", validClaims()), ErrInvalidToken},
+		{"shared secret", sign(t, jwt.SigningMethodHS256, []byte("secret"), "k1", validClaims()), ErrInvalidToken},
+		{"garbage", "not.a.token", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		if _, err := v.Verify(context.Background(), tt.token); !errors.Is(err, tt.want) {
+			t.Errorf("Verify() of a token %s error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestKeyCache(t *testing.T) {
+	server := newJWKSServer(t)
+	first, firstJWK := newECKey(t, "k1")
+	server.publish(firstJWK)
+	v := newTestVerifier(t, server)
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodES256, first, "k1", validClaims())); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Fatalf("fetched the jwks %d times for one key, want 1", got)
+	}
+
+	// A rotated-in key is picked up on its first token.
+	second, secondJWK := newECKey(t, "k2")
+	server.publish(firstJWK, secondJWK)
+	v.keys.mu.Lock()
+	v.keys.lastAttempt = time.Now().Add(-time.Minute)
+	v.keys.mu.Unlock()
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodES256, second, "k2", validClaims())); err != nil {
+		t.Fatalf("Verify() with a new kid error = %v", err)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Fatalf("fetches after a new kid = %d, want 2", got)
+	}
+
+	// Unknown kids cannot make the verifier hammer the server.
+	for range 5 {
+		if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodES256, second, "unknown", validClaims())); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("Verify() with an unknown kid error = %v, want %v", err, ErrUnknownKey)
+		}
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Fatalf("fetches after unknown kids = %d, want 2", got)
+	}
+
+	// A stale set is refetched, dropping keys no longer published.
+	server.publish(secondJWK)
+	v.keys.mu.Lock()
+	v.keys.fetchedAt = time.Now().Add(-time.Hour)
+	v.keys.lastAttempt = time.Now().Add(-time.Hour)
+	v.keys.mu.Unlock()
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodES256, first, "k1", validClaims())); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Verify() with a retired kid error = %v, want %v", err, ErrUnknownKey)
+	}
+	if got := server.fetches.Load(); got != 3 {
+		t.Fatalf("fetches after the set went stale = %d, want 3", got)
+	}
+}
+
+func TestKeyCacheKeepsKeysWhenFetchFails(t *testing.T) {
+	server := newJWKSServer(t)
+	private, jwk := newECKey(t, "k1")
+	server.publish(jwk)
+	v := newTestVerifier(t, server)
+	if err := v.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	server.failing.Store(true)
+	v.keys.mu.Lock()
+	v.keys.fetchedAt = time.Now().Add(-time.Hour)
+	v.keys.lastAttempt = time.Now().Add(-time.Hour)
+	v.keys.mu.Unlock()
+	for range 5 {
+		if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodES256, private, "k1", validClaims())); err != nil {
+			t.Fatalf("Verify() while the jwks is unreachable error = %v", err)
+		}
+	}
+	// A failed fetch is not retried on every token.
+	if got := server.fetches.Load(); got != 2 {
+		t.Fatalf("fetches while the jwks is unreachable = %d, want 2", got)
+	}
+
+	v.keys.mu.Lock()
+	v.keys.lastAttempt = time.Now().Add(-time.Minute)
+	v.keys.mu.Unlock()
+	server.failing.Store(false)
+	if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodES256, private, "k1", validClaims())); err != nil {
+		t.Fatalf("Verify() after the jwks recovered error = %v", err)
+	}
+	if got := server.fetches.Load(); got != 3 {
+		t.Fatalf("fetches after MinRefreshInterval = %d, want 3", got)
+	}
+}
+
+func TestKeyCacheSharesConcurrentFetches(t *testing.T) {
+	server := newJWKSServer(t)
+	server.failing.Store(true)
+	v := newTestVerifier(t, server)
+	private, _ := newECKey(t, "k1")
+	token := sign(t, jwt.SigningMethodES256, private, "k1", validClaims())
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("Verify() while the jwks is unreachable error = %v, want %v", err, ErrUnknownKey)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := server.fetches.Load(); got != 1 {
+		t.Fatalf("concurrent verifications fetched the failing jwks %d times, want 1", got)
+	}
+}